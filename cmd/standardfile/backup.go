@@ -0,0 +1,101 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/knadh/koanf/v2"
+	"github.com/mdouchement/standardfile/internal/server/service"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	backupOutput string
+	backupGzip   bool
+	backupServer string
+)
+
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Take a consistent snapshot of the database",
+	Long: "Take a consistent snapshot of the database, it can be restored by replacing the database file while the server is stopped.\n" +
+		"With --server, the snapshot is downloaded from the admin API of the running server using admin.token.\n" +
+		"Otherwise the database is opened directly, the storm database can't be opened while the server is running, unlike the sqlite one.",
+	Args: cobra.ExactArgs(0),
+	RunE: func(_ *cobra.Command, _ []string) error {
+		konf, err := loadConfig()
+		if err != nil {
+			return err
+		}
+
+		f, err := os.OpenFile(backupOutput, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err != nil {
+			return errors.Wrap(err, "could not create backup file")
+		}
+		defer f.Close()
+
+		if backupServer != "" {
+			err = downloadBackup(f, backupServer, konf.String("admin.token"))
+		} else {
+			err = writeBackup(f, konf)
+		}
+		if err == nil {
+			err = errors.Wrap(f.Close(), "could not close backup file")
+		}
+		if err != nil {
+			os.Remove(backupOutput)
+			return err
+		}
+
+		log.Println("Backup written to", backupOutput)
+		return nil
+	},
+}
+
+// writeBackup writes to w a snapshot of the configured database.
+func writeBackup(w io.Writer, konf *koanf.Koanf) error {
+	db, err := openDatabase(konf)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return service.NewBackup(db, service.BackupPolicy{}).Write(w, backupGzip)
+}
+
+// downloadBackup writes to w the snapshot served by the admin API of the given server.
+func downloadBackup(w io.Writer, server, token string) error {
+	if token == "" {
+		return errors.New("admin.token must be defined to download a backup")
+	}
+
+	endpoint, err := url.JoinPath(server, "/admin/backup")
+	if err != nil {
+		return errors.Wrap(err, "invalid server URL")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, endpoint+"?gzip="+strconv.FormatBool(backupGzip), nil)
+	if err != nil {
+		return errors.Wrap(err, "could not create request")
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "could not request backup")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("could not request backup: %s", resp.Status)
+	}
+
+	// An aborted download is reported as an unexpected EOF.
+	_, err = io.Copy(w, resp.Body)
+	return errors.Wrap(err, "could not download backup")
+}
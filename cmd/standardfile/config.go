@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/knadh/koanf/parsers/yaml"
+	"github.com/knadh/koanf/providers/env/v2"
+	"github.com/knadh/koanf/providers/file"
+	"github.com/knadh/koanf/v2"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// envPrefix is the prefix of the environment variables overriding the configuration.
+// Nested keys are separated by a double underscore (e.g. STANDARDFILE_SESSION__ACCESS_TOKEN_TTL for session.access_token_ttl).
+const envPrefix = "STANDARDFILE_"
+
+var (
+	// defaults are the values used when they are defined neither in the configuration file nor in the environment.
+	defaults = map[string]any{
+		"address":                   "localhost:5000",
+		"database.codec":            "msgpack",
+		"cors.allow_origins":        []string{}, // any origin
+		"cors.allow_methods":        []string{"GET", "HEAD", "PUT", "PATCH", "POST", "DELETE"},
+		"session.access_token_ttl":  "1440h",
+		"session.refresh_token_ttl": "8760h",
+		"lockout.max_attempts":      6,
+		"lockout.max_ip_attempts":   30,
+		"lockout.duration":          "1m",
+		"lockout.max_duration":      "1h",
+		"log.format":                "text",
+		"log.level":                 "info",
+		"shutdown_timeout":          "30s",
+		"janitor.interval":          "1h",
+		"revisions.retention_count": 30,
+		"revisions.retention_age":   "720h",
+		"revisions.prune_interval":  "1h",
+		"backup.interval":           "24h",
+		"backup.count":              7,
+		"backup.gzip":               true,
+		"audit.retention":           "2160h",
+		"files.enabled":             true,
+		"files.quota":               "1GB",
+		"files.upload_ttl":          "24h",
+	}
+
+	// envValues converts the environment variables that are not plain strings.
+	envValues = map[string]func(string) (any, error){
+		"cors.allow_origins":           list,
+		"cors.allow_methods":           list,
+		"trusted_proxies":              list,
+		"registration.allowed_domains": list,
+		"socket_mode": func(v string) (any, error) {
+			return strconv.ParseInt(v, 8, 64)
+		},
+	}
+
+	// secrets are redacted when the configuration is printed.
+	secrets = []string{"secret_key", "session.secret", "admin.token"}
+)
+
+// loadConfig loads the configuration file given by the `--config' flag, if any,
+// overridden by the STANDARDFILE_ environment variables.
+func loadConfig() (*koanf.Koanf, error) {
+	konf := koanf.New(".")
+	for key, value := range defaults {
+		if err := konf.Set(key, value); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg != "" {
+		if err := konf.Load(file.Provider(cfg), yaml.Parser()); err != nil {
+			return nil, err
+		}
+	}
+
+	var errs []error
+	provider := env.Provider(".", env.Opt{
+		Prefix: envPrefix,
+		TransformFunc: func(k, v string) (string, any) {
+			key := strings.ToLower(strings.ReplaceAll(strings.TrimPrefix(k, envPrefix), "__", "."))
+			convert, ok := envValues[key]
+			if !ok {
+				return key, v
+			}
+
+			value, err := convert(v)
+			if err != nil {
+				errs = append(errs, errors.Wrapf(err, "invalid value for %s", k))
+			}
+			return key, value
+		},
+	})
+	if err := konf.Load(provider, nil); err != nil {
+		return nil, errors.Wrap(err, "could not load environment variables")
+	}
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+
+	return konf, nil
+}
+
+// trustedProxies parses the trusted_proxies setting, each entry is an IP address or a CIDR.
+func trustedProxies(konf *koanf.Koanf) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range konf.Strings("trusted_proxies") {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, errors.Errorf("invalid trusted proxy: %s", entry)
+			}
+
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid trusted proxy: %s", entry)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// configureLogger sets the format and the level of the logger.
+func configureLogger(konf *koanf.Koanf) error {
+	level, err := logrus.ParseLevel(konf.String("log.level"))
+	if err != nil {
+		return errors.Wrap(err, "invalid log.level")
+	}
+
+	var formatter logrus.Formatter
+	switch format := konf.String("log.format"); format {
+	case "text":
+		formatter = &logrus.TextFormatter{FullTimestamp: true}
+	case "json":
+		formatter = &logrus.JSONFormatter{}
+	default:
+		return errors.Errorf("invalid log.format: %s", format)
+	}
+
+	logrus.SetFormatter(formatter)
+	logrus.SetLevel(level)
+	return nil
+}
+
+// list converts a comma separated value.
+func list(v string) (any, error) {
+	values := strings.Split(v, ",")
+	for i := range values {
+		values[i] = strings.TrimSpace(values[i])
+	}
+	return values, nil
+}
+
+var (
+	configCmd = &cobra.Command{
+		Use:   "config",
+		Short: "Configuration commands",
+	}
+
+	//
+	configPrintCmd = &cobra.Command{
+		Use:   "print",
+		Short: "Print the effective configuration with secrets redacted",
+		Args:  cobra.ExactArgs(0),
+		RunE: func(_ *cobra.Command, _ []string) error {
+			konf, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			for _, key := range secrets {
+				if konf.Exists(key) {
+					if err = konf.Set(key, "REDACTED"); err != nil {
+						return err
+					}
+				}
+			}
+
+			payload, err := konf.Marshal(yaml.Parser())
+			if err != nil {
+				return errors.Wrap(err, "could not marshal configuration")
+			}
+
+			fmt.Print(string(payload))
+			return nil
+		},
+	}
+)
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mdouchement/standardfile/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfigFromEnv(t *testing.T) {
+	cfg = ""
+	t.Setenv("STANDARDFILE_SECRET_KEY", "jwt-test")
+	t.Setenv("STANDARDFILE_SESSION__SECRET", "paseto-test")
+	t.Setenv("STANDARDFILE_CORS__ALLOW_METHODS", "GET,POST")
+	t.Setenv("STANDARDFILE_FILES__ENABLED", "false")
+
+	konf, err := loadConfig()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	key, err := keyFromConfig(konf, "secret_key")
+	assert.NoError(t, err)
+	assert.Equal(t, "jwt-test", string(key))
+
+	key, err = keyFromConfig(konf, "session.secret")
+	assert.NoError(t, err)
+	assert.Equal(t, "paseto-test", string(key))
+
+	assert.Equal(t, 1440*time.Hour, konf.Duration("session.access_token_ttl"))
+	assert.Equal(t, "localhost:5000", konf.String("address"))
+	assert.Equal(t, 30, konf.Int("revisions.retention_count"))
+	assert.Equal(t, 720*time.Hour, konf.Duration("revisions.retention_age"))
+	assert.Equal(t, 2160*time.Hour, konf.Duration("audit.retention"))
+	assert.Equal(t, time.Hour, konf.Duration("janitor.interval"))
+	assert.Equal(t, 7, konf.Int("backup.count"))
+	assert.True(t, konf.Bool("backup.gzip"))
+	assert.Equal(t, "1GB", konf.String("files.quota"))
+	assert.False(t, konf.Bool("files.enabled"))
+
+	var ctrl server.Controller
+	assert.NoError(t, configure(&ctrl, konf))
+	assert.Empty(t, ctrl.AllowOrigins)
+	assert.Equal(t, []string{"GET", "POST"}, ctrl.AllowMethods)
+	assert.False(t, ctrl.NoRegistration)
+}
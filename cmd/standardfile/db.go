@@ -0,0 +1,204 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mdouchement/standardfile/internal/model"
+	"github.com/mdouchement/standardfile/pkg/stormsql"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// tables are the records that can be queried by their table name.
+var tables = map[string]func() model.Model{
+	"users":        func() model.Model { return &model.User{} },
+	"sessions":     func() model.Model { return &model.Session{} },
+	"items":        func() model.Model { return &model.Item{} },
+	"revisions":    func() model.Model { return &model.Revision{} },
+	"settings":     func() model.Model { return &model.Setting{} },
+	"locks":        func() model.Model { return &model.Lock{} },
+	"invites":      func() model.Model { return &model.Invite{} },
+	"pkces":        func() model.Model { return &model.PKCE{} },
+	"audit_events": func() model.Model { return &model.AuditEvent{} },
+}
+
+var (
+	dbCmd = &cobra.Command{
+		Use:   "db",
+		Short: "Database commands",
+	}
+
+	//
+	dbQueryCmd = &cobra.Command{
+		Use:   "query <sql>",
+		Short: "Query the database with a SQL SELECT statement",
+		Long: "Query the database with a SQL SELECT statement, the records are printed as JSON.\n" +
+			"Columns are the fields of the models (e.g. UserID, UpdatedAt) and the tables are: " + strings.Join(tableNames(), ", ") + ".\n\n" +
+			"  standardfile db query \"SELECT count(*) FROM items WHERE UserID = '<uuid>' AND UpdatedAt > '2019-02-16 20:52:55'\"\n" +
+			"  standardfile db query \"SELECT Email, CreatedAt FROM users ORDER BY CreatedAt DESC LIMIT 10\"",
+		Args: cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			sc, err := parseSelect(args[0])
+			if err != nil {
+				return err
+			}
+
+			kind, ok := tables[sc.Tablename]
+			if !ok {
+				return errors.Errorf("unknown table %q, expected one of: %s", sc.Tablename, strings.Join(tableNames(), ", "))
+			}
+
+			konf, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			db, err := openDatabase(konf)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			records := []model.Model{}
+			err = db.ForEach(kind(), func(m model.Model) error {
+				ok, err := sc.Matcher.Match(m)
+				if ok {
+					records = append(records, m)
+				}
+				return errors.Wrap(err, "could not match record")
+			})
+			if err != nil {
+				return errors.Wrap(err, "could not perform query")
+			}
+
+			if sc.Count {
+				return printJSON(queryCount{Count: len(records)})
+			}
+
+			if len(sc.OrderBy) > 0 {
+				sortRecords(records, sc.OrderBy, sc.OrderByReversed)
+			}
+			records = paginate(records, sc.Skip, sc.Limit)
+
+			if len(sc.SelectedFields) == 0 {
+				return printJSON(records)
+			}
+			return printJSON(project(records, sc.SelectedFields))
+		},
+	}
+)
+
+type queryCount struct {
+	Count int `json:"count"`
+}
+
+// parseSelect parses the given statement, the parser panics on unsupported expressions.
+func parseSelect(sql string) (sc *stormsql.SelectClause, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("unsupported query: %v", r)
+		}
+	}()
+
+	return stormsql.ParseSelect(sql)
+}
+
+// sortRecords sorts the records by the given fields, the storm's query semantics are used (all fields in the same direction).
+func sortRecords(records []model.Model, fields []string, reversed bool) {
+	sort.SliceStable(records, func(i, j int) bool {
+		a, b := reflect.ValueOf(records[i]).Elem(), reflect.ValueOf(records[j]).Elem()
+		for _, field := range fields {
+			if c := compare(a.FieldByName(field), b.FieldByName(field)); c != 0 {
+				return (c < 0) != reversed
+			}
+		}
+		return false
+	})
+}
+
+// compare compares the values of a field, nil and unknown fields are sorted first.
+func compare(a, b reflect.Value) int {
+	for a.IsValid() && a.Kind() == reflect.Pointer {
+		a = a.Elem()
+	}
+	for b.IsValid() && b.Kind() == reflect.Pointer {
+		b = b.Elem()
+	}
+	if !a.IsValid() || !b.IsValid() {
+		return cmp.Compare(boolInt(a.IsValid()), boolInt(b.IsValid()))
+	}
+
+	if t, ok := a.Interface().(time.Time); ok {
+		return t.Compare(b.Interface().(time.Time))
+	}
+
+	switch a.Kind() {
+	case reflect.String:
+		return cmp.Compare(a.String(), b.String())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return cmp.Compare(a.Int(), b.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return cmp.Compare(a.Uint(), b.Uint())
+	case reflect.Float32, reflect.Float64:
+		return cmp.Compare(a.Float(), b.Float())
+	case reflect.Bool:
+		return cmp.Compare(boolInt(a.Bool()), boolInt(b.Bool()))
+	}
+	return 0
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func paginate(records []model.Model, skip, limit int) []model.Model {
+	if skip >= len(records) {
+		return []model.Model{}
+	}
+	records = records[skip:]
+
+	if limit > 0 && limit < len(records) {
+		records = records[:limit]
+	}
+	return records
+}
+
+// project keeps only the given fields of the records.
+func project(records []model.Model, fields []string) []map[string]any {
+	rows := make([]map[string]any, len(records))
+	for i, record := range records {
+		v := reflect.ValueOf(record).Elem()
+
+		rows[i] = map[string]any{}
+		for _, field := range fields {
+			if f := v.FieldByName(field); f.IsValid() {
+				rows[i][field] = f.Interface()
+			}
+		}
+	}
+	return rows
+}
+
+func tableNames() []string {
+	names := make([]string, 0, len(tables))
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return errors.Wrap(enc.Encode(v), "could not encode JSON")
+}
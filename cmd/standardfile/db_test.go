@@ -0,0 +1,166 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mdouchement/standardfile/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompare(t *testing.T) {
+	now := time.Now()
+	later := now.Add(time.Hour)
+
+	tests := []struct {
+		name     string
+		a, b     any
+		expected int
+	}{
+		{name: "string", a: "a", b: "b", expected: -1},
+		{name: "int", a: 2, b: 1, expected: 1},
+		{name: "uint", a: uint(1), b: uint(1), expected: 0},
+		{name: "float", a: 1.5, b: 2.5, expected: -1},
+		{name: "bool", a: true, b: false, expected: 1},
+		{name: "time", a: now, b: later, expected: -1},
+		{name: "time pointer", a: &later, b: &now, expected: 1},
+		{name: "nil pointer first", a: (*time.Time)(nil), b: &now, expected: -1},
+		{name: "nil pointer last", a: &now, b: (*time.Time)(nil), expected: 1},
+		{name: "nil pointers", a: (*time.Time)(nil), b: (*time.Time)(nil), expected: 0},
+		{name: "unsupported kind", a: []int{1}, b: []int{2}, expected: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, compare(reflect.ValueOf(tt.a), reflect.ValueOf(tt.b)))
+		})
+	}
+
+	// Unknown fields are invalid values.
+	assert.Equal(t, -1, compare(reflect.Value{}, reflect.ValueOf("a")))
+}
+
+func TestSortRecords(t *testing.T) {
+	now := time.Now()
+	later := now.Add(time.Hour)
+
+	invites := func() []model.Model {
+		return []model.Model{
+			&model.Invite{Code: "b", Uses: 1, ExpireAt: &later},
+			&model.Invite{Code: "a", Uses: 2, ExpireAt: nil},
+			&model.Invite{Code: "c", Uses: 1, ExpireAt: &now},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		fields   []string
+		reversed bool
+		expected []string
+	}{
+		{name: "string", fields: []string{"Code"}, expected: []string{"a", "b", "c"}},
+		{name: "string reversed", fields: []string{"Code"}, reversed: true, expected: []string{"c", "b", "a"}},
+		{name: "nil pointer first", fields: []string{"ExpireAt"}, expected: []string{"a", "c", "b"}},
+		{name: "nil pointer reversed", fields: []string{"ExpireAt"}, reversed: true, expected: []string{"b", "c", "a"}},
+		{name: "several fields", fields: []string{"Uses", "Code"}, expected: []string{"b", "c", "a"}},
+		{name: "unknown field keeps order", fields: []string{"Unknown"}, expected: []string{"b", "a", "c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records := invites()
+			sortRecords(records, tt.fields, tt.reversed)
+
+			codes := make([]string, len(records))
+			for i, record := range records {
+				codes[i] = record.(*model.Invite).Code
+			}
+			assert.Equal(t, tt.expected, codes)
+		})
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	records := []model.Model{
+		&model.Invite{Code: "a"},
+		&model.Invite{Code: "b"},
+		&model.Invite{Code: "c"},
+	}
+
+	tests := []struct {
+		name     string
+		skip     int
+		limit    int
+		expected int
+	}{
+		{name: "all", skip: 0, limit: 0, expected: 3},
+		{name: "limit", skip: 0, limit: 2, expected: 2},
+		{name: "limit beyond length", skip: 0, limit: 10, expected: 3},
+		{name: "skip", skip: 1, limit: 0, expected: 2},
+		{name: "skip and limit", skip: 1, limit: 1, expected: 1},
+		{name: "skip length", skip: 3, limit: 0, expected: 0},
+		{name: "skip beyond length", skip: 10, limit: 1, expected: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := paginate(records, tt.skip, tt.limit)
+			assert.NotNil(t, page)
+			assert.Len(t, page, tt.expected)
+			if tt.expected > 0 {
+				assert.Same(t, records[tt.skip], page[0])
+			}
+		})
+	}
+}
+
+func TestProject(t *testing.T) {
+	later := time.Now().Add(time.Hour)
+	records := []model.Model{
+		&model.Invite{Code: "a", Uses: 1, ExpireAt: &later},
+		&model.Invite{Code: "b"},
+	}
+
+	tests := []struct {
+		name     string
+		fields   []string
+		expected []map[string]any
+	}{
+		{
+			name:     "no field",
+			fields:   nil,
+			expected: []map[string]any{{}, {}},
+		},
+		{
+			name:   "fields",
+			fields: []string{"Code", "Uses"},
+			expected: []map[string]any{
+				{"Code": "a", "Uses": 1},
+				{"Code": "b", "Uses": 0},
+			},
+		},
+		{
+			name:   "pointer field",
+			fields: []string{"ExpireAt"},
+			expected: []map[string]any{
+				{"ExpireAt": &later},
+				{"ExpireAt": (*time.Time)(nil)},
+			},
+		},
+		{
+			name:   "unknown field is omitted",
+			fields: []string{"Code", "Unknown"},
+			expected: []map[string]any{
+				{"Code": "a"},
+				{"Code": "b"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, project(records, tt.fields))
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+
+	"github.com/mdouchement/standardfile/internal/dump"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var dumpOutput string
+
+var (
+	dumpCmd = &cobra.Command{
+		Use:   "dump",
+		Short: "Dump the database as versioned JSON Lines",
+		Args:  cobra.ExactArgs(0),
+		RunE: func(_ *cobra.Command, _ []string) error {
+			konf, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			db, err := openDatabase(konf)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			var w io.Writer = os.Stdout
+			if dumpOutput != "" {
+				f, err := os.OpenFile(dumpOutput, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+				if err != nil {
+					return errors.Wrap(err, "could not create dump file")
+				}
+				defer f.Close()
+				w = f
+			}
+
+			footer, err := dump.Dump(db, w, "standardfile "+version)
+			if err != nil {
+				return err
+			}
+
+			log.Printf("Dumped %v\n", footer.Counts)
+			return nil
+		},
+	}
+
+	//
+	restoreCmd = &cobra.Command{
+		Use:   "restore <file|->",
+		Short: "Restore a dump into an empty database",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			konf, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			var r io.Reader = os.Stdin
+			if args[0] != "-" {
+				f, err := os.Open(args[0])
+				if err != nil {
+					return errors.Wrap(err, "could not open dump file")
+				}
+				defer f.Close()
+				r = f
+			}
+
+			db, err := openDatabase(konf)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			footer, err := dump.Restore(db, r)
+			if err != nil {
+				return err
+			}
+
+			log.Printf("Restored %v\n", footer.Counts)
+			log.Printf("Integrity verified for %d users\n", len(footer.Signatures))
+			return nil
+		},
+	}
+)
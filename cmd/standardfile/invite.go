@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mdouchement/standardfile/internal/server/service"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	inviteUses int
+	inviteTTL  time.Duration
+)
+
+var (
+	inviteCmd = &cobra.Command{
+		Use:   "invite",
+		Short: "Manage the registration invites",
+		Long: "Manage the registration invites used when `registration.invite_only' is enabled.\n" +
+			"The storm database can't be opened while the server is running, unlike the sqlite one.",
+	}
+
+	//
+	inviteCreateCmd = &cobra.Command{
+		Use:   "create",
+		Short: "Create an invite code",
+		Args:  cobra.ExactArgs(0),
+		RunE: func(_ *cobra.Command, _ []string) error {
+			konf, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			db, err := openDatabase(konf)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			invite, err := service.NewInvite(db, service.RegistrationPolicy{}).Create(inviteUses, inviteTTL)
+			if err != nil {
+				return err
+			}
+
+			fmt.Println(invite.Code)
+			return nil
+		},
+	}
+
+	//
+	inviteListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List the invite codes",
+		Args:  cobra.ExactArgs(0),
+		RunE: func(_ *cobra.Command, _ []string) error {
+			konf, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			db, err := openDatabase(konf)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			invites, err := service.NewInvite(db, service.RegistrationPolicy{}).List()
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "CODE\tUSES\tEXPIRE AT\tUSABLE")
+			for _, invite := range invites {
+				expireAt := "never"
+				if invite.ExpireAt != nil {
+					expireAt = invite.ExpireAt.Local().Format(time.RFC3339)
+				}
+				fmt.Fprintf(w, "%s\t%d/%d\t%s\t%t\n", invite.Code, invite.Uses, invite.MaxUses, expireAt, invite.IsUsable(time.Now()))
+			}
+			return w.Flush()
+		},
+	}
+
+	//
+	inviteRevokeCmd = &cobra.Command{
+		Use:   "revoke <code>",
+		Short: "Revoke an invite code",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			konf, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			db, err := openDatabase(konf)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			err = service.NewInvite(db, service.RegistrationPolicy{}).Revoke(args[0])
+			if db.IsNotFound(err) {
+				return errors.Errorf("unknown invite code: %s", args[0])
+			}
+			return err
+		},
+	}
+)
@@ -1,36 +1,53 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"hash"
 	"io"
-	"io/fs"
 	"log"
-	"net"
+	"maps"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
-	"github.com/knadh/koanf/parsers/yaml"
-	"github.com/knadh/koanf/providers/file"
+	"github.com/asdine/storm/v3/codec"
+	"github.com/dustin/go-humanize"
 	"github.com/knadh/koanf/v2"
 	"github.com/mdouchement/standardfile/internal/database"
 	"github.com/mdouchement/standardfile/internal/server"
+	"github.com/mdouchement/standardfile/internal/server/metrics"
+	"github.com/mdouchement/standardfile/internal/server/service"
+	"github.com/mdouchement/standardfile/internal/storage"
+	"github.com/mdouchement/standardfile/internal/tlsconfig"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"golang.org/x/crypto/blake2b"
 	"golang.org/x/crypto/hkdf"
 )
 
-const dbname = "standardfile.db"
+const (
+	dbname       = "standardfile.db"
+	sqlitedbname = "standardfile.sqlite"
+)
 
 var (
 	version  = "dev"
 	revision = "none"
 	date     = "unknown"
 
-	cfg string
+	cfg            string
+	repairDatabase bool
+	recodecTo      string
+	recodecOutput  string
 )
 
 func main() {
@@ -46,22 +63,152 @@ func main() {
 	reindexCmd.Flags().StringVarP(&cfg, "config", "c", "", "Configuration file")
 	c.AddCommand(reindexCmd)
 
+	compactCmd.Flags().StringVarP(&cfg, "config", "c", "", "Configuration file")
+	c.AddCommand(compactCmd)
+
+	checkCmd.Flags().StringVarP(&cfg, "config", "c", "", "Configuration file")
+	checkCmd.Flags().BoolVar(&repairDatabase, "repair", false, "Rebuild the indexes and delete the orphaned records")
+	c.AddCommand(checkCmd)
+
+	recodecCmd.Flags().StringVarP(&cfg, "config", "c", "", "Configuration file")
+	recodecCmd.Flags().StringVar(&recodecTo, "to", "", "Codec of the rewritten records: "+strings.Join(slices.Sorted(maps.Keys(database.StormCodecs)), ", "))
+	recodecCmd.Flags().StringVarP(&recodecOutput, "out", "o", "", "Write the rewritten database to this file instead of replacing the database")
+	recodecCmd.MarkFlagRequired("to")
+	c.AddCommand(recodecCmd)
+
 	serverCmd.Flags().StringVarP(&cfg, "config", "c", "", "Configuration file")
 	c.AddCommand(serverCmd)
 
+	dumpCmd.Flags().StringVarP(&cfg, "config", "c", "", "Configuration file")
+	dumpCmd.Flags().StringVarP(&dumpOutput, "out", "o", "", "Output file (default stdout)")
+	c.AddCommand(dumpCmd)
+
+	restoreCmd.Flags().StringVarP(&cfg, "config", "c", "", "Configuration file")
+	c.AddCommand(restoreCmd)
+
+	backupCmd.Flags().StringVarP(&cfg, "config", "c", "", "Configuration file")
+	backupCmd.Flags().StringVarP(&backupOutput, "out", "o", "", "Output file")
+	backupCmd.Flags().BoolVarP(&backupGzip, "gzip", "z", false, "Compress the snapshot with gzip")
+	backupCmd.Flags().StringVar(&backupServer, "server", "", "URL of the running server (e.g. http://localhost:5000)")
+	backupCmd.MarkFlagRequired("out")
+	c.AddCommand(backupCmd)
+
+	inviteCreateCmd.Flags().StringVarP(&cfg, "config", "c", "", "Configuration file")
+	inviteCreateCmd.Flags().IntVarP(&inviteUses, "uses", "n", 1, "Number of registrations allowed with the code")
+	inviteCreateCmd.Flags().DurationVar(&inviteTTL, "ttl", 7*24*time.Hour, "Validity of the code, 0 means forever")
+	inviteCmd.AddCommand(inviteCreateCmd)
+	inviteListCmd.Flags().StringVarP(&cfg, "config", "c", "", "Configuration file")
+	inviteCmd.AddCommand(inviteListCmd)
+	inviteRevokeCmd.Flags().StringVarP(&cfg, "config", "c", "", "Configuration file")
+	inviteCmd.AddCommand(inviteRevokeCmd)
+	c.AddCommand(inviteCmd)
+
+	for _, cmd := range []*cobra.Command{userListCmd, userShowCmd, userDeleteCmd, userDisableCmd, userEnableCmd, userSessionsCmd} {
+		cmd.Flags().StringVarP(&cfg, "config", "c", "", "Configuration file")
+		userCmd.AddCommand(cmd)
+	}
+	userListCmd.Flags().BoolVar(&jsonOutput, "json", false, "Print as JSON")
+	userShowCmd.Flags().BoolVar(&jsonOutput, "json", false, "Print as JSON")
+	userSessionsCmd.Flags().BoolVar(&jsonOutput, "json", false, "Print as JSON")
+	userSessionsCmd.Flags().BoolVar(&revokeSessions, "revoke", false, "Terminate all the sessions")
+	c.AddCommand(userCmd)
+
+	dbQueryCmd.Flags().StringVarP(&cfg, "config", "c", "", "Configuration file")
+	dbCmd.AddCommand(dbQueryCmd)
+	c.AddCommand(dbCmd)
+
+	configPrintCmd.Flags().StringVarP(&cfg, "config", "c", "", "Configuration file")
+	configCmd.AddCommand(configPrintCmd)
+	c.AddCommand(configCmd)
+
 	if err := c.Execute(); err != nil {
 		log.Fatalf("%+v", err)
 	}
 }
 
-func dbnameWithPath(path string) string {
+func dbnameWithPath(driver, path string) string {
+	name := dbname
+	if driver == database.DriverSQLite {
+		name = sqlitedbname
+	}
+
 	if len(path) == 0 {
-		return dbname
+		return name
 	}
-	return filepath.Join(path, dbname)
+	return filepath.Join(path, name)
 }
 
-func kdf(l int, k []byte) []byte {
+// openDatabase opens the database defined in the configuration.
+func openDatabase(konf *koanf.Koanf) (database.Client, error) {
+	if err := configureCodec(konf); err != nil {
+		return nil, err
+	}
+
+	driver := konf.String("database.driver")
+	db, err := database.Open(driver, dbnameWithPath(driver, konf.String("database_path")))
+	return db, errors.Wrap(err, "could not open database")
+}
+
+// configureCodec selects the storm codec defined in the configuration.
+func configureCodec(konf *koanf.Koanf) error {
+	c, err := stormCodec(konf.String("database.codec"))
+	if err != nil {
+		return err
+	}
+
+	database.StormCodec = c
+	return nil
+}
+
+// stormCodec returns the storm codec of the given name.
+func stormCodec(name string) (codec.MarshalUnmarshaler, error) {
+	c, ok := database.StormCodecs[name]
+	if !ok {
+		return nil, errors.Errorf("unknown database codec %q, use one of: %s", name, strings.Join(slices.Sorted(maps.Keys(database.StormCodecs)), ", "))
+	}
+	return c, nil
+}
+
+// openFiles opens the files storage defined in the configuration, nil is returned when the files are disabled.
+func openFiles(konf *koanf.Koanf) (*storage.Local, error) {
+	if !konf.Bool("files.enabled") {
+		return nil, nil
+	}
+	return storage.NewLocal(filepath.Join(konf.String("database_path"), "files"))
+}
+
+// every runs fn in background at each interval until ctx is done.
+// The job is tracked by wg until it returns.
+func every(ctx context.Context, wg *sync.WaitGroup, interval time.Duration, fn func()) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				fn()
+			}
+		}
+	}()
+}
+
+// durationOr returns d or the fallback value when d is not defined.
+func durationOr(d, fallback time.Duration) time.Duration {
+	if d <= 0 {
+		return fallback
+	}
+	return d
+}
+
+// kdf derives a key of l bytes from k.
+// The info parameter binds the derived key to its usage, nil is used for the session secret.
+func kdf(l int, k, info []byte) []byte {
 	nhash := func() hash.Hash {
 		h, err := blake2b.New256(nil)
 		if err != nil {
@@ -72,7 +219,7 @@ func kdf(l int, k []byte) []byte {
 
 	payload := make([]byte, l)
 
-	kdf := hkdf.New(nhash, k, nil, nil)
+	kdf := hkdf.New(nhash, k, nil, info)
 	_, err := io.ReadFull(kdf, payload)
 	if err != nil {
 		panic(err)
@@ -114,12 +261,17 @@ var (
 		Short: "Init the database",
 		Args:  cobra.ExactArgs(0),
 		RunE: func(_ *cobra.Command, _ []string) error {
-			konf := koanf.New(".")
-			if err := konf.Load(file.Provider(cfg), yaml.Parser()); err != nil {
+			konf, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			if err = configureCodec(konf); err != nil {
 				return err
 			}
 
-			return database.StormInit(dbnameWithPath(konf.String("database_path")))
+			driver := konf.String("database.driver")
+			return database.Init(driver, dbnameWithPath(driver, konf.String("database_path")))
 		},
 	}
 
@@ -129,12 +281,147 @@ var (
 		Short: "Reindex the database",
 		Args:  cobra.ExactArgs(0),
 		RunE: func(_ *cobra.Command, _ []string) error {
-			konf := koanf.New(".")
-			if err := konf.Load(file.Provider(cfg), yaml.Parser()); err != nil {
+			konf, err := loadConfig()
+			if err != nil {
 				return err
 			}
 
-			return database.StormReIndex(dbnameWithPath(konf.String("database_path")))
+			if err = configureCodec(konf); err != nil {
+				return err
+			}
+
+			driver := konf.String("database.driver")
+			return database.ReIndex(driver, dbnameWithPath(driver, konf.String("database_path")))
+		},
+	}
+
+	//
+	compactCmd = &cobra.Command{
+		Use:   "compact",
+		Short: "Reclaim the unused space of the database",
+		Long: "Rewrite the database to a fresh file and swap them.\n" +
+			"The storm database can't be compacted while the server is running.",
+		Args: cobra.ExactArgs(0),
+		RunE: func(_ *cobra.Command, _ []string) error {
+			konf, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			driver := konf.String("database.driver")
+			filename := dbnameWithPath(driver, konf.String("database_path"))
+
+			before, err := os.Stat(filename)
+			if err != nil {
+				return errors.Wrap(err, "could not stat database")
+			}
+
+			if err = database.Compact(driver, filename); err != nil {
+				return err
+			}
+
+			after, err := os.Stat(filename)
+			if err != nil {
+				return errors.Wrap(err, "could not stat database")
+			}
+
+			log.Printf("Compacted from %s to %s\n", humanize.IBytes(uint64(before.Size())), humanize.IBytes(uint64(after.Size())))
+			return nil
+		},
+	}
+
+	//
+	checkCmd = &cobra.Command{
+		Use:   "check",
+		Short: "Check the integrity of the database",
+		Long: "Walk the database, verify its indexes and report the records whose user does not exist.\n" +
+			"With --repair, the indexes are rebuilt and the orphaned records are deleted.\n" +
+			"The storm database can't be checked while the server is running.",
+		Args: cobra.ExactArgs(0),
+		RunE: func(_ *cobra.Command, _ []string) error {
+			konf, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			driver := konf.String("database.driver")
+			report, err := database.Check(driver, dbnameWithPath(driver, konf.String("database_path")), repairDatabase)
+			if err != nil {
+				return err
+			}
+
+			for _, problem := range report.Problems {
+				fmt.Println(problem)
+			}
+			for _, table := range slices.Sorted(maps.Keys(report.Orphans)) {
+				ids := report.Orphans[table]
+				fmt.Printf("%d orphaned %s: %s\n", len(ids), table, strings.Join(ids, ", "))
+			}
+
+			switch {
+			case report.Repaired:
+				log.Println("Database repaired")
+			case len(report.Problems) > 0 || len(report.Orphans) > 0:
+				return errors.New("the database is inconsistent, use --repair to fix it")
+			default:
+				log.Println("Database is consistent")
+			}
+			return nil
+		},
+	}
+
+	//
+	recodecCmd = &cobra.Command{
+		Use:   "recodec",
+		Short: "Rewrite the storm database with another codec",
+		Long: "Rewrite all the records of the storm database with the codec given by --to and swap the databases.\n" +
+			"With --out, the rewritten database is written aside (e.g. to compare the sizes) and the database is left untouched.\n" +
+			"Once swapped, database.codec must be set to the new codec. The server must be stopped.",
+		Args: cobra.ExactArgs(0),
+		RunE: func(_ *cobra.Command, _ []string) error {
+			konf, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			driver := konf.String("database.driver")
+			if driver != "" && driver != database.DriverStorm {
+				return errors.Errorf("recodec is not supported by the %s driver", driver)
+			}
+
+			to, err := stormCodec(recodecTo)
+			if err != nil {
+				return err
+			}
+
+			filename := dbnameWithPath(driver, konf.String("database_path"))
+			before, err := os.Stat(filename)
+			if err != nil {
+				return errors.Wrap(err, "could not stat database")
+			}
+
+			output := filename
+			if recodecOutput != "" {
+				output = recodecOutput
+				if _, err = os.Stat(output); !os.IsNotExist(err) {
+					return errors.Errorf("%s already exists", output)
+				}
+			}
+
+			if err = database.StormRecodec(filename, to, recodecOutput); err != nil {
+				return err
+			}
+
+			after, err := os.Stat(output)
+			if err != nil {
+				return errors.Wrap(err, "could not stat database")
+			}
+
+			log.Printf("Recoded to %s from %s to %s\n", to.Name(), humanize.IBytes(uint64(before.Size())), humanize.IBytes(uint64(after.Size())))
+			if recodecOutput == "" && konf.String("database.codec") != to.Name() {
+				log.Printf("Set database.codec to %s before starting the server\n", to.Name())
+			}
+			return nil
 		},
 	}
 
@@ -145,8 +432,12 @@ var (
 		Short: "Start server",
 		Args:  cobra.ExactArgs(0),
 		RunE: func(_ *cobra.Command, _ []string) error {
-			konf := koanf.New(".")
-			if err := konf.Load(file.Provider(cfg), yaml.Parser()); err != nil {
+			konf, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			if err = configureLogger(konf); err != nil {
 				return err
 			}
 
@@ -160,69 +451,224 @@ var (
 				return errors.Wrap(err, "session secret")
 			}
 
-			db, err := database.StormOpen(dbnameWithPath(konf.String("database_path")))
+			db, err := openDatabase(konf)
 			if err != nil {
-				return errors.Wrap(err, "could not open database")
+				return err
 			}
 			defer db.Close()
 
-			var subscription, features []byte
-			if konf.String("subscription_file") != "" {
-				subscription, err = os.ReadFile(konf.String("subscription_file"))
-				if err != nil {
-					return errors.Wrap(err, "could not read subscription_file")
-				}
+			retention := service.RevisionRetention{
+				Count: konf.Int("revisions.retention_count"),
+				Age:   konf.Duration("revisions.retention_age"),
+			}
+
+			files, err := openFiles(konf)
+			if err != nil {
+				return err
+			}
 
-				features, err = os.ReadFile(konf.String("features_file"))
+			var quota uint64
+			if files != nil && konf.String("files.quota") != "" {
+				quota, err = humanize.ParseBytes(konf.String("files.quota"))
 				if err != nil {
-					return errors.Wrap(err, "could not read features_file")
+					return errors.Wrap(err, "could not parse files.quota")
 				}
 			}
 
-			engine := server.EchoEngine(server.Controller{
+			ctx, stop := context.WithCancel(context.Background())
+			var jobs sync.WaitGroup
+			defer func() {
+				// A running job (e.g. a snapshot) ends before the database is closed.
+				stop()
+				jobs.Wait()
+			}()
+
+			// Errors of the HTTP servers (e.g. TLS handshakes) are written to the logger.
+			errorLog := log.New(logrus.StandardLogger().WriterLevel(logrus.ErrorLevel), "", 0)
+
+			var metric *metrics.Metrics
+			if address := konf.String("metrics.address"); address != "" {
+				metric = metrics.New(db)
+
+				mux := http.NewServeMux()
+				mux.Handle("/metrics", metric.Handler())
+				metricsServer := &http.Server{Addr: address, Handler: mux, ErrorLog: errorLog}
+				defer metricsServer.Close()
+
+				go func() {
+					logrus.WithField("address", address).Info("metrics listening")
+					if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+						logrus.WithError(err).Error("could not run metrics server")
+					}
+				}()
+			}
+
+			lockout := service.LockoutPolicy{
+				MaxAttempts:   konf.Int("lockout.max_attempts"),
+				MaxIPAttempts: konf.Int("lockout.max_ip_attempts"),
+				Duration:      konf.Duration("lockout.duration"),
+				MaxDuration:   konf.Duration("lockout.max_duration"),
+			}
+
+			proxies, err := trustedProxies(konf)
+			if err != nil {
+				return err
+			}
+
+			ctrl := server.Controller{
 				Version:                    version,
 				Database:                   db,
-				NoRegistration:             konf.Bool("no_registration"),
 				ShowRealVersion:            konf.Bool("show_real_version"),
-				SubscriptionPayload:        subscription,
-				FeaturesPayload:            features,
-				AllowOrigins:               konf.MustStrings("cors.allow_origins"),
-				AllowMethods:               konf.MustStrings("cors.allow_methods"),
+				RevisionRetention:          retention,
+				Lockout:                    lockout,
+				AuditRetention:             konf.Duration("audit.retention"),
+				TrustedProxies:             proxies,
+				Metrics:                    metric,
+				Notifier:                   service.NewNotifier(),
+				Files:                      files,
+				FilesQuota:                 int64(quota),
+				FilesServerURL:             konf.String("files.server_url"),
 				SigningKey:                 configSecretKey,
-				SessionSecret:              kdf(32, configSessionSecret),
+				SessionSecret:              kdf(32, configSessionSecret, nil),
+				MFASecretKey:               kdf(32, configSessionSecret, []byte("mfa")),
 				AccessTokenExpirationTime:  konf.MustDuration("session.access_token_ttl"),
 				RefreshTokenExpirationTime: konf.MustDuration("session.refresh_token_ttl"),
-			})
+			}
+			if err = configure(&ctrl, konf); err != nil {
+				return err
+			}
+
+			engine := server.EchoEngine(ctrl)
 			server.PrintRoutes(engine)
+			handler := newHandler(engine)
 
-			address := konf.String("address")
-			message := "could not run server"
-			log.Printf("Server listening on %s\n", address)
-			parts := strings.Split(address, ":")
-			if len(parts) == 2 && parts[0] == "unix" {
-				socketFile := parts[1]
-				if _, err := os.Stat(socketFile); err == nil {
-					log.Printf("Removing existing %s\n", socketFile)
-					os.Remove(socketFile)
+			revisions := service.NewRevision(db, retention)
+			every(ctx, &jobs, durationOr(konf.Duration("revisions.prune_interval"), time.Hour), func() {
+				n, err := revisions.Prune()
+				if err != nil {
+					logrus.WithError(err).Error("could not prune revisions")
+					return
+				}
+				if n > 0 {
+					logrus.WithField("count", n).Info("pruned revisions")
 				}
-				defer os.Remove(socketFile)
+			})
 
-				listener, err := net.Listen(parts[0], socketFile)
+			janitor := service.NewJanitor(db, lockout)
+			every(ctx, &jobs, durationOr(konf.Duration("janitor.interval"), time.Hour), func() {
+				report, err := janitor.Cleanup()
+				metric.Cleaned("sessions", report.Sessions)
+				metric.Cleaned("pkce_challenges", report.Challenges)
+				metric.Cleaned("locks", report.Locks)
 				if err != nil {
-					return err
+					logrus.WithError(err).Error("could not cleanup expired records")
+				}
+				if report.Sessions > 0 || report.Challenges > 0 || report.Locks > 0 {
+					logrus.WithFields(logrus.Fields{
+						"sessions":        report.Sessions,
+						"pkce_challenges": report.Challenges,
+						"locks":           report.Locks,
+					}).Info("removed expired records")
+				}
+			})
+
+			if dir := konf.String("backup.dir"); dir != "" {
+				backups := service.NewBackup(db, service.BackupPolicy{
+					Dir:      dir,
+					Count:    konf.Int("backup.count"),
+					Compress: konf.Bool("backup.gzip"),
+				})
+				every(ctx, &jobs, durationOr(konf.Duration("backup.interval"), 24*time.Hour), func() {
+					filename, err := backups.Snapshot()
+					if err != nil {
+						logrus.WithError(err).Error("could not backup database")
+						return
+					}
+					logrus.WithField("filename", filename).Info("database backed up")
+				})
+			}
+
+			audits := service.NewAudit(db, ctrl.AuditRetention)
+			every(ctx, &jobs, time.Hour, func() {
+				n, err := audits.Prune()
+				if err != nil {
+					logrus.WithError(err).Error("could not prune audit events")
+					return
+				}
+				if n > 0 {
+					logrus.WithField("count", n).Info("pruned audit events")
 				}
+			})
 
-				if socketMode := konf.Int("socket_mode"); socketMode != 0 {
-					mode := fs.FileMode(socketMode)
-					if err := os.Chmod(socketFile, mode); err != nil {
-						return errors.Wrap(err, fmt.Sprintf("chmod %s %#o", socketFile, mode))
+			if files != nil {
+				ttl := durationOr(konf.Duration("files.upload_ttl"), 24*time.Hour)
+				every(ctx, &jobs, time.Hour, func() {
+					n, err := files.CleanupUploads(ttl)
+					if err != nil {
+						logrus.WithError(err).Error("could not cleanup orphaned uploads")
+						return
+					}
+					if n > 0 {
+						logrus.WithField("count", n).Info("removed orphaned uploads")
 					}
+				})
+			}
+
+			srv := &http.Server{Handler: handler, ErrorLog: errorLog}
+			if certFile := konf.String("tls.cert_file"); certFile != "" {
+				srv.TLSConfig, err = tlsconfig.New(certFile, konf.String("tls.key_file"), konf.String("tls.client_ca_file"))
+				if err != nil {
+					return err
 				}
+			}
 
-				return errors.Wrap(engine.Server.Serve(listener), message)
+			address := konf.String("address")
+			logrus.WithField("address", address).Info("server listening")
+			listener, err := listen(konf, address)
+			if err != nil {
+				return err
 			}
 
-			return errors.Wrap(engine.Start(address), message)
+			errc := make(chan error, 1)
+			go func() {
+				if srv.TLSConfig != nil {
+					// Certificates are provided by the TLS config.
+					errc <- srv.ServeTLS(listener, "", "")
+					return
+				}
+				errc <- srv.Serve(listener)
+			}()
+
+			signals := make(chan os.Signal, 1)
+			signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+			defer signal.Stop(signals)
+
+			for {
+				select {
+				case err := <-errc:
+					return errors.Wrap(err, "could not run server")
+				case sig := <-signals:
+					if sig == syscall.SIGHUP {
+						if err := reload(&ctrl, handler); err != nil {
+							logrus.WithError(err).Error("could not reload configuration")
+							continue
+						}
+						logrus.Info("configuration reloaded")
+						continue
+					}
+
+					logrus.WithField("signal", sig.String()).Info("shutting down")
+					stop()
+
+					timeout := durationOr(konf.Duration("shutdown_timeout"), 30*time.Second)
+					ctx, cancel := context.WithTimeout(context.Background(), timeout)
+					defer cancel()
+
+					// Shutdown closes the listener which removes the unix socket,
+					// the background jobs are awaited and the database is closed by the deferred calls.
+					return errors.Wrap(srv.Shutdown(ctx), "could not drain in-flight requests")
+				}
+			}
 		},
 	}
 )
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/knadh/koanf/v2"
+	"github.com/labstack/echo/v4"
+	"github.com/mdouchement/standardfile/internal/server"
+	"github.com/mdouchement/standardfile/internal/server/service"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// minAdminTokenLength is the minimum length of the admin API token.
+const minAdminTokenLength = 32
+
+// A handler serves the requests with the current engine.
+// The engine can be replaced while the server is running, in-flight requests end on the previous one.
+type handler struct {
+	engine atomic.Pointer[echo.Echo]
+}
+
+func newHandler(engine *echo.Echo) *handler {
+	h := &handler{}
+	h.engine.Store(engine)
+	return h
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.engine.Load().ServeHTTP(w, r)
+}
+
+// configure sets the controller's parameters that can be reloaded while the server is running.
+func configure(ctrl *server.Controller, konf *koanf.Koanf) error {
+	var subscription, features []byte
+	if konf.String("subscription_file") != "" {
+		var err error
+		subscription, err = os.ReadFile(konf.String("subscription_file"))
+		if err != nil {
+			return errors.Wrap(err, "could not read subscription_file")
+		}
+
+		features, err = os.ReadFile(konf.String("features_file"))
+		if err != nil {
+			return errors.Wrap(err, "could not read features_file")
+		}
+	}
+
+	adminToken := konf.String("admin.token")
+	if adminToken != "" && len(adminToken) < minAdminTokenLength {
+		return errors.Errorf("admin.token must contain at least %d characters", minAdminTokenLength)
+	}
+
+	ctrl.AdminToken = adminToken
+	ctrl.NoRegistration = konf.Bool("no_registration")
+	ctrl.Registration = service.RegistrationPolicy{
+		InviteOnly:     konf.Bool("registration.invite_only"),
+		AllowedDomains: konf.Strings("registration.allowed_domains"),
+	}
+	ctrl.SubscriptionPayload = subscription
+	ctrl.FeaturesPayload = features
+	ctrl.AllowOrigins = konf.Strings("cors.allow_origins")
+	ctrl.AllowMethods = konf.Strings("cors.allow_methods")
+	return nil
+}
+
+// reload reads the configuration file again and serves the next requests with an engine using the new parameters.
+// Only the parameters set by configure are reloaded, the other ones require a restart.
+func reload(ctrl *server.Controller, h *handler) (err error) {
+	defer func() {
+		// koanf's Must functions panic on missing values.
+		if r := recover(); r != nil {
+			err = errors.Errorf("%v", r)
+		}
+	}()
+
+	konf, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	next := *ctrl
+	if err = configure(&next, konf); err != nil {
+		return err
+	}
+
+	if err = configureLogger(konf); err != nil {
+		return err
+	}
+
+	h.engine.Store(server.EchoEngine(next))
+	*ctrl = next
+	return nil
+}
+
+// listen listens on the given address, a unix socket is used for `unix:/path/to/socket' addresses.
+// The unix socket file is removed when the listener is closed.
+func listen(konf *koanf.Koanf, address string) (net.Listener, error) {
+	parts := strings.Split(address, ":")
+	if len(parts) != 2 || parts[0] != "unix" {
+		return net.Listen("tcp", address)
+	}
+
+	socketFile := parts[1]
+	if _, err := os.Stat(socketFile); err == nil {
+		logrus.WithField("path", socketFile).Info("removing existing unix socket")
+		os.Remove(socketFile)
+	}
+
+	listener, err := net.Listen(parts[0], socketFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if socketMode := konf.Int("socket_mode"); socketMode != 0 {
+		mode := fs.FileMode(socketMode)
+		if err := os.Chmod(socketFile, mode); err != nil {
+			listener.Close()
+			return nil, errors.Wrap(err, fmt.Sprintf("chmod %s %#o", socketFile, mode))
+		}
+	}
+
+	return listener, nil
+}
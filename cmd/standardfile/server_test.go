@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mdouchement/standardfile/internal/database"
+	"github.com/mdouchement/standardfile/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	cfg = filepath.Join(dir, "standardfile.yml")
+	defer func() { cfg = "" }()
+
+	db, err := database.StormOpen(filepath.Join(dir, "standardfile.db"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close()
+
+	write := func(origin string, noRegistration bool) {
+		config := "cors:\n  allow_origins: [\"" + origin + "\"]\n"
+		if noRegistration {
+			config += "no_registration: true\n"
+		}
+		assert.NoError(t, os.WriteFile(cfg, []byte(config), 0o600))
+	}
+	write("https://a.example", false)
+
+	konf, err := loadConfig()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	ctrl := server.Controller{
+		Version:                    "test",
+		Database:                   db,
+		SigningKey:                 []byte("secret"),
+		SessionSecret:              []byte("00000000000000000000000000000000"),
+		MFASecretKey:               []byte("11111111111111111111111111111111"),
+		AccessTokenExpirationTime:  time.Hour,
+		RefreshTokenExpirationTime: 24 * time.Hour,
+	}
+	if !assert.NoError(t, configure(&ctrl, konf)) {
+		return
+	}
+	h := newHandler(server.EchoEngine(ctrl))
+
+	// allowed returns the allowed origin of a CORS preflight request from the given origin.
+	allowed := func(origin string) string {
+		req := httptest.NewRequest(http.MethodOptions, "/v1/login", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Header().Get("Access-Control-Allow-Origin")
+	}
+
+	// register returns the status code of a registration with the given email.
+	register := func(email string) int {
+		req := httptest.NewRequest(http.MethodPost, "/v1/users", strings.NewReader(`{"version":"003","email":"`+email+`","password":"password42","pw_nonce":"nonce42","pw_cost":110000}`))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, "https://a.example", allowed("https://a.example"))
+	assert.Empty(t, allowed("https://b.example"))
+	assert.Equal(t, http.StatusOK, register("george.abitbol@nowhere.lan"))
+
+	write("https://b.example", true)
+	if !assert.NoError(t, reload(&ctrl, h)) {
+		return
+	}
+
+	assert.Empty(t, allowed("https://a.example"))
+	assert.Equal(t, "https://b.example", allowed("https://b.example"))
+	assert.True(t, ctrl.NoRegistration)
+	assert.Equal(t, http.StatusUnauthorized, register("dave@nowhere.lan")) // Handled as an authenticated route
+
+	// An invalid configuration keeps the current engine.
+	assert.NoError(t, os.WriteFile(cfg, []byte("admin:\n  token: short\n"), 0o600))
+	assert.Error(t, reload(&ctrl, h))
+	assert.Equal(t, "https://b.example", allowed("https://b.example"))
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/mdouchement/standardfile/internal/database"
+	"github.com/mdouchement/standardfile/internal/model"
+	"github.com/mdouchement/standardfile/internal/server/service"
+	"github.com/mdouchement/standardfile/internal/storage"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	jsonOutput     bool
+	revokeSessions bool
+)
+
+// withAdmin opens the configured database and files storage and calls fn with the admin service.
+func withAdmin(fn func(db database.Client, admin service.AdminService) error) error {
+	konf, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	db, err := openDatabase(konf)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var files *storage.Local
+	if files, err = openFiles(konf); err != nil {
+		return err
+	}
+
+	return fn(db, service.NewAdmin(db, files))
+}
+
+// findUser returns the user of the given email or UUID.
+func findUser(db database.Client, ref string) (*model.User, error) {
+	find := db.FindUser
+	if strings.Contains(ref, "@") {
+		find = db.FindUserByMail
+	}
+
+	user, err := find(ref)
+	if db.IsNotFound(err) {
+		return nil, errors.Errorf("no account for %s", ref)
+	}
+	return user, err
+}
+
+var (
+	userCmd = &cobra.Command{
+		Use:   "user",
+		Short: "Manage the users",
+		Long: "Manage the users, a user is identified by their email or UUID.\n" +
+			"The storm database can't be opened while the server is running, unlike the sqlite one.",
+	}
+
+	//
+	userListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List the users with their usage",
+		Args:  cobra.ExactArgs(0),
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return withAdmin(func(_ database.Client, admin service.AdminService) error {
+				users, err := admin.Users()
+				if err != nil {
+					return err
+				}
+
+				if jsonOutput {
+					return printJSON(users)
+				}
+
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "UUID\tEMAIL\tITEMS\tSESSIONS\tFILES\tLAST ACTIVITY\tDISABLED")
+				for _, user := range users {
+					fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%s\t%t\n",
+						user.ID, user.Email, user.Items, user.ActiveSessions,
+						humanize.IBytes(uint64(user.FilesUsage)), formatTime(user.LastActivity), user.Disabled,
+					)
+				}
+				return w.Flush()
+			})
+		},
+	}
+
+	//
+	userShowCmd = &cobra.Command{
+		Use:   "show <email|uuid>",
+		Short: "Show a user with their usage",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return withAdmin(func(db database.Client, admin service.AdminService) error {
+				user, err := findUser(db, args[0])
+				if err != nil {
+					return err
+				}
+
+				report, err := admin.User(user.ID)
+				if err != nil {
+					return err
+				}
+
+				if jsonOutput {
+					return printJSON(report)
+				}
+
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintf(w, "UUID\t%s\n", report.ID)
+				fmt.Fprintf(w, "Email\t%s\n", report.Email)
+				fmt.Fprintf(w, "Version\t%s\n", report.Version)
+				fmt.Fprintf(w, "Created at\t%s\n", formatTime(report.CreatedAt))
+				fmt.Fprintf(w, "Last activity\t%s\n", formatTime(report.LastActivity))
+				fmt.Fprintf(w, "Items\t%d\n", report.Items)
+				fmt.Fprintf(w, "Active sessions\t%d\n", report.ActiveSessions)
+				fmt.Fprintf(w, "Files\t%s\n", humanize.IBytes(uint64(report.FilesUsage)))
+				fmt.Fprintf(w, "Two-factor\t%t\n", report.MFAEnabled)
+				fmt.Fprintf(w, "Disabled\t%t\n", report.Disabled)
+				return w.Flush()
+			})
+		},
+	}
+
+	//
+	userDeleteCmd = &cobra.Command{
+		Use:   "delete <email|uuid>",
+		Short: "Delete a user with all their records and files",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return withAdmin(func(db database.Client, admin service.AdminService) error {
+				user, err := findUser(db, args[0])
+				if err != nil {
+					return err
+				}
+
+				if err = admin.Delete(user.ID); err != nil {
+					return err
+				}
+
+				fmt.Println("Deleted user", user.ID)
+				return nil
+			})
+		},
+	}
+
+	//
+	userDisableCmd = &cobra.Command{
+		Use:   "disable <email|uuid>",
+		Short: "Prevent a user from signing in and terminate all their sessions",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return withAdmin(func(db database.Client, admin service.AdminService) error {
+				user, err := findUser(db, args[0])
+				if err != nil {
+					return err
+				}
+
+				if err = admin.Disable(user.ID); err != nil {
+					return err
+				}
+
+				fmt.Println("Disabled user", user.ID)
+				return nil
+			})
+		},
+	}
+
+	//
+	userEnableCmd = &cobra.Command{
+		Use:   "enable <email|uuid>",
+		Short: "Allow a disabled user to sign in again",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return withAdmin(func(db database.Client, admin service.AdminService) error {
+				user, err := findUser(db, args[0])
+				if err != nil {
+					return err
+				}
+
+				if err = admin.Enable(user.ID); err != nil {
+					return err
+				}
+
+				fmt.Println("Enabled user", user.ID)
+				return nil
+			})
+		},
+	}
+
+	//
+	userSessionsCmd = &cobra.Command{
+		Use:   "sessions <email|uuid>",
+		Short: "List the active sessions of a user",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return withAdmin(func(db database.Client, admin service.AdminService) error {
+				user, err := findUser(db, args[0])
+				if err != nil {
+					return err
+				}
+
+				if revokeSessions {
+					n, err := admin.Logout(user.ID)
+					if err != nil {
+						return err
+					}
+
+					if jsonOutput {
+						return printJSON(queryCount{Count: n})
+					}
+					fmt.Printf("Terminated %d sessions\n", n)
+					return nil
+				}
+
+				sessions, err := db.FindActiveSessionsByUserID(user.ID)
+				if err != nil {
+					return err
+				}
+
+				if jsonOutput {
+					// Tokens are not printed.
+					type session struct {
+						ID         string     `json:"uuid"`
+						CreatedAt  *time.Time `json:"created_at"`
+						UpdatedAt  *time.Time `json:"updated_at"`
+						ExpireAt   time.Time  `json:"expire_at"`
+						APIVersion string     `json:"api_version"`
+						UserAgent  string     `json:"user_agent"`
+					}
+
+					rows := make([]session, len(sessions))
+					for i, s := range sessions {
+						rows[i] = session{s.ID, s.CreatedAt, s.UpdatedAt, s.ExpireAt, s.APIVersion, s.UserAgent}
+					}
+					return printJSON(rows)
+				}
+
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "UUID\tCREATED AT\tUPDATED AT\tEXPIRE AT\tAPI\tUSER AGENT")
+				for _, s := range sessions {
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+						s.ID, formatTime(s.CreatedAt), formatTime(s.UpdatedAt), formatTime(&s.ExpireAt), s.APIVersion, s.UserAgent,
+					)
+				}
+				return w.Flush()
+			})
+		},
+	}
+)
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Local().Format(time.RFC3339)
+}
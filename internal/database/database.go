@@ -1,29 +1,89 @@
 package database
 
 import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/mdouchement/standardfile/internal/model"
+	"github.com/pkg/errors"
+)
+
+// Supported database drivers.
+const (
+	DriverStorm  = "storm"
+	DriverSQLite = "sqlite"
 )
 
 type (
+	// Stats are the storage statistics of a database.
+	Stats struct {
+		Size      int64 `json:"size"`       // Size in bytes
+		FreePages int   `json:"free_pages"` // Pages allocated in the file but not used
+	}
+
+	// ItemStats are the statistics of the items of a user.
+	ItemStats struct {
+		Count     int        `json:"count"`
+		UpdatedAt *time.Time `json:"updated_at"` // Last update of an item, nil when the user has no item
+	}
+
+	// A CheckReport is the result of an integrity check of the database.
+	CheckReport struct {
+		Problems []string            // Storage and index inconsistencies
+		Orphans  map[string][]string // IDs of the records whose user does not exist, by table
+		Repaired bool                // Orphans deleted and indexes rebuilt
+	}
+
+	// A Snapshot is a consistent read-only view of the database.
+	Snapshot interface {
+		// ForEach calls fn for each record of the given kind (e.g. &model.Item{}).
+		ForEach(kind model.Model, fn func(m model.Model) error) error
+		// FindItemsForIntegrityCheck returns valid items for computing data signature forthe given user.
+		FindItemsForIntegrityCheck(userID string) ([]*model.Item, error)
+	}
+
 	// A Client can interacts with the database.
 	Client interface {
 		// Save inserts or updates the entry in database with the given model.
 		Save(m model.Model) error
 		// Delete deletes the entry in database with the given model.
 		Delete(m model.Model) error
+		// Import inserts or updates the entry in database with the given model as is.
+		// Unlike Save, the ID and timestamps are never generated.
+		Import(m model.Model) error
+		// ImportAll imports the models returned by next until it returns io.EOF, like Import.
+		// The models are imported in a single transaction, none of them is imported if an error occurs.
+		ImportAll(next func() (model.Model, error)) error
+		// ForEach calls fn for each record of the given kind (e.g. &model.Item{}).
+		// The database must not be modified from fn.
+		ForEach(kind model.Model, fn func(m model.Model) error) error
+		// View calls fn with a snapshot of the database, the writes done meanwhile are not seen from fn.
+		View(fn func(s Snapshot) error) error
 		// Close the database.
 		Close() error
 		// IsNotFound returns true if err is a not found error.
 		IsNotFound(err error) bool
 		// IsAlreadyExists returns true if err is a not found error.
 		IsAlreadyExists(err error) bool
+		// Stats performs a cheap read on the database and returns its storage statistics.
+		Stats() (Stats, error)
+		// Backup writes a consistent snapshot of the database to w while it is in use.
+		// It returns the number of written bytes.
+		Backup(w io.Writer) (int64, error)
 
 		UserInteraction
 		SessionInteraction
 		ItemInteraction
+		RevisionInteraction
+		SettingInteraction
+		LockInteraction
+		InviteInteraction
 		PKCEInteraction
+		AuditInteraction
 	}
 
 	// An UserInteraction defines all the methods used to interact with a user record.
@@ -32,6 +92,9 @@ type (
 		FindUser(id string) (*model.User, error)
 		// FindUserByMail returns the user for the given email.
 		FindUserByMail(email string) (*model.User, error)
+		// DeleteUser deletes the user and all their records in a single transaction.
+		// PKCE challenges are not bound to a user so only the expired ones are removed.
+		DeleteUser(id string) error
 	}
 
 	// An SessionInteraction defines all the methods used to interact with a session record.
@@ -42,12 +105,20 @@ type (
 		FindSessionByUserID(id, userID string) (*model.Session, error)
 		// FindActiveSessionsByUserID returns all active sessions for the given user id.
 		FindActiveSessionsByUserID(userID string) ([]*model.Session, error)
+		// CountActiveSessions returns the number of active sessions of all users.
+		CountActiveSessions() (int, error)
 		// FindSessionsByUserID returns all sessions for the given user id.
 		FindSessionsByUserID(userID string) ([]*model.Session, error)
 		// FindSessionByAccessToken returns the session for the given id and access token.
 		FindSessionByAccessToken(id, token string) (*model.Session, error)
 		// FindSessionByTokens returns the session for the given id, access and refresh token.
 		FindSessionByTokens(id, access, refresh string) (*model.Session, error)
+		// DeleteSessionsByUserID deletes all the sessions of the given user.
+		// It returns the number of deleted sessions.
+		DeleteSessionsByUserID(userID string) (int, error)
+		// DeleteSessionsExpiredBefore deletes all the sessions expired at the given time.
+		// It returns the number of deleted sessions.
+		DeleteSessionsExpiredBefore(t time.Time) (int, error)
 	}
 
 	// An ItemInteraction defines all the methods used to interact with a item record(s).
@@ -60,10 +131,61 @@ type (
 		// It also returns a boolean to true if there is more items than the given limit.
 		// limit equals to 0 means all items.
 		FindItemsByParams(userID, contentType string, updated time.Time, strictTime, filterDeleted bool, limit int) ([]*model.Item, bool, error)
+		// ForEachItemByParams calls fn for each matching record for the given parameters, most recently updated first.
+		// Unlike FindItemsByParams, the records are not all loaded in memory.
+		ForEachItemByParams(userID, contentType string, updated time.Time, strictTime, filterDeleted bool, fn func(item *model.Item) error) error
 		// FindItemsForIntegrityCheck returns valid items for computing data signature forthe given user.
 		FindItemsForIntegrityCheck(userID string) ([]*model.Item, error)
 		// DeleteItem deletes the item matching the given parameters.
 		DeleteItem(id, userID string) error
+		// ItemStatsByUserID returns the statistics of the items of the given user, deleted ones included.
+		ItemStatsByUserID(userID string) (ItemStats, error)
+	}
+
+	// A RevisionInteraction defines all the methods used to interact with a revision record(s).
+	RevisionInteraction interface {
+		// FindRevisionsByItemID returns all the revisions of the given item, the most recent first.
+		FindRevisionsByItemID(itemID, userID string) ([]*model.Revision, error)
+		// FindRevisionByItemID returns the revision for the given id, item id and user id.
+		FindRevisionByItemID(id, itemID, userID string) (*model.Revision, error)
+		// DeleteRevisionsByItemID deletes all the revisions of the given item.
+		DeleteRevisionsByItemID(itemID, userID string) error
+		// DeleteRevisionsBefore deletes all the revisions created before the given time.
+		// It returns the number of deleted revisions.
+		DeleteRevisionsBefore(t time.Time) (int, error)
+	}
+
+	// A SettingInteraction defines all the methods used to interact with a setting record(s).
+	SettingInteraction interface {
+		// FindSettingsByUserID returns all the settings of the given user.
+		FindSettingsByUserID(userID string) ([]*model.Setting, error)
+		// FindSettingByName returns the setting for the given name and user id.
+		FindSettingByName(name, userID string) (*model.Setting, error)
+	}
+
+	// A LockInteraction defines all the methods used to interact with a lock record(s).
+	LockInteraction interface {
+		// FindLock returns the lock for the given key.
+		FindLock(key string) (*model.Lock, error)
+		// DeleteLocksBefore deletes all the locks updated before the given time.
+		// It returns the number of deleted locks.
+		DeleteLocksBefore(t time.Time) (int, error)
+	}
+
+	// An InviteInteraction defines all the methods used to interact with an invite record(s).
+	InviteInteraction interface {
+		// FindInvite returns the invite for the given code.
+		FindInvite(code string) (*model.Invite, error)
+	}
+
+	// An AuditInteraction defines all the methods used to interact with an audit event record(s).
+	AuditInteraction interface {
+		// FindAuditEventsByUserID returns the last audit events of the given user, the most recent first.
+		// limit equals to 0 means all events.
+		FindAuditEventsByUserID(userID string, limit int) ([]*model.AuditEvent, error)
+		// DeleteAuditEventsBefore deletes all the audit events created before the given time.
+		// It returns the number of deleted events.
+		DeleteAuditEventsBefore(t time.Time) (int, error)
 	}
 
 	// A PKCEInteraction defines all the methods used to interact with PKCE mechanism.
@@ -73,6 +195,85 @@ type (
 		// RemovePKCE removes from database the given challenge code.
 		RemovePKCE(codeChallenge string) error
 		// RevokeExpiredChallenges removes from database all old challenge codes.
-		RevokeExpiredChallenges() error
+		// It returns the number of removed challenges.
+		RevokeExpiredChallenges() (int, error)
 	}
 )
+
+// Init initializes the database for the given driver.
+func Init(driver, database string) error {
+	switch driver {
+	case "", DriverStorm:
+		return StormInit(database)
+	case DriverSQLite:
+		return SQLiteInit(database)
+	}
+	return errors.Errorf("unsupported database driver: %s", driver)
+}
+
+// ReIndex reindexes the database for the given driver.
+func ReIndex(driver, database string) error {
+	switch driver {
+	case "", DriverStorm:
+		return StormReIndex(database)
+	case DriverSQLite:
+		return SQLiteReIndex(database)
+	}
+	return errors.Errorf("unsupported database driver: %s", driver)
+}
+
+// Compact reclaims the unused space of the database for the given driver.
+func Compact(driver, database string) error {
+	switch driver {
+	case "", DriverStorm:
+		return StormCompact(database)
+	case DriverSQLite:
+		return SQLiteCompact(database)
+	}
+	return errors.Errorf("unsupported database driver: %s", driver)
+}
+
+// Check checks the integrity of the database for the given driver and optionally repairs it.
+func Check(driver, database string, repair bool) (*CheckReport, error) {
+	switch driver {
+	case "", DriverStorm:
+		return StormCheck(database, repair)
+	case DriverSQLite:
+		return SQLiteCheck(database, repair)
+	}
+	return nil, errors.Errorf("unsupported database driver: %s", driver)
+}
+
+// Open returns a new database connection for the given driver.
+func Open(driver, database string) (Client, error) {
+	switch driver {
+	case "", DriverStorm:
+		return StormOpen(database)
+	case DriverSQLite:
+		return SQLiteOpen(database)
+	}
+	return nil, errors.Errorf("unsupported database driver: %s", driver)
+}
+
+// DataSignature computes the integrity hash of the given user's items.
+//
+// https://github.com/standardfile/sfjs/blob/499fd0bc7ebddfc72f8b1dc3c9cbf134e92016d3/lib/app/lib/modelManager.js#L664-L677
+func DataSignature(db Snapshot, userID string) (string, error) {
+	items, err := db.FindItemsForIntegrityCheck(userID)
+	if err != nil {
+		return "", err
+	}
+
+	timestamps := []string{}
+	for _, item := range items {
+		// Unix timestamp in milliseconds (like MRI's `Time.now.to_datetime.strftime('%Q')`)
+		timestamps = append(timestamps, fmt.Sprintf("%d", item.UpdatedAt.UnixMilli()))
+	}
+
+	sort.SliceStable(timestamps, func(i, j int) bool {
+		return timestamps[j] < timestamps[i]
+	})
+
+	b := []byte(strings.Join(timestamps, ","))
+	return fmt.Sprintf("%x", sha256.Sum256(b)), nil
+}
@@ -0,0 +1,858 @@
+package database_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asdine/storm/v3/codec"
+	"github.com/gofrs/uuid"
+	"github.com/mdouchement/standardfile/internal/database"
+	"github.com/mdouchement/standardfile/internal/model"
+	"github.com/mdouchement/standardfile/pkg/libsf"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+var drivers = []string{database.DriverStorm, database.DriverSQLite}
+
+func TestUserInteraction(t *testing.T) {
+	for _, driver := range drivers {
+		t.Run(driver, func(t *testing.T) {
+			db, cleanup := setup(t, driver)
+			defer cleanup()
+
+			user := model.NewUser()
+			user.Email = "george.abitbol@nowhere.lan"
+			user.PasswordNonce = "nonce42"
+			user.MFASecret = "secret42"
+			user.MFARecoveryCodes = []string{"code1", "code2"}
+			user.Disabled = true
+			assert.NoError(t, db.Save(user))
+			assert.NotEmpty(t, user.ID)
+			assert.NotNil(t, user.CreatedAt)
+
+			v, err := db.FindUser(user.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, user.Email, v.Email)
+			assert.Equal(t, user.PasswordNonce, v.PasswordNonce)
+			assert.Equal(t, user.MFASecret, v.MFASecret)
+			assert.Equal(t, user.MFARecoveryCodes, v.MFARecoveryCodes)
+			assert.True(t, v.Disabled)
+			assert.True(t, user.UpdatedAt.Equal(*v.UpdatedAt))
+
+			v, err = db.FindUserByMail(user.Email)
+			assert.NoError(t, err)
+			assert.Equal(t, user.ID, v.ID)
+
+			_, err = db.FindUserByMail("nobody@nowhere.lan")
+			assert.True(t, db.IsNotFound(err))
+
+			duplicate := model.NewUser()
+			duplicate.Email = user.Email
+			err = db.Save(duplicate)
+			assert.True(t, db.IsAlreadyExists(err))
+
+			assert.NoError(t, db.Delete(user))
+			_, err = db.FindUser(user.ID)
+			assert.True(t, db.IsNotFound(err))
+			assert.True(t, db.IsNotFound(db.Delete(user)))
+		})
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	for _, driver := range drivers {
+		t.Run(driver, func(t *testing.T) {
+			db, cleanup := setup(t, driver)
+			defer cleanup()
+
+			user := model.NewUser()
+			user.Email = "george.abitbol@nowhere.lan"
+			assert.NoError(t, db.Save(user))
+
+			other := model.NewUser()
+			other.Email = "other@nowhere.lan"
+			assert.NoError(t, db.Save(other))
+
+			for _, userID := range []string{user.ID, other.ID} {
+				assert.NoError(t, db.Save(&model.Session{UserID: userID, ExpireAt: time.Now().Add(time.Hour)}))
+				assert.NoError(t, db.Save(&model.Item{UserID: userID, ContentType: libsf.ContentTypeNote}))
+				assert.NoError(t, db.Save(&model.Revision{UserID: userID, ItemID: "item"}))
+				assert.NoError(t, db.Save(&model.Setting{UserID: userID, Name: "LOG_SESSION_USER_AGENT"}))
+				assert.NoError(t, db.Save(&model.AuditEvent{UserID: userID, Type: model.AuditLogin}))
+			}
+			assert.NoError(t, db.Save(&model.PKCE{CodeChallenge: "expired", ExpireAt: time.Now().Add(-time.Hour)}))
+
+			assert.NoError(t, db.DeleteUser(user.ID))
+			assert.True(t, db.IsNotFound(db.DeleteUser(user.ID)))
+
+			_, err := db.FindUser(user.ID)
+			assert.True(t, db.IsNotFound(err))
+			_, err = db.FindPKCE("expired")
+			assert.True(t, db.IsNotFound(err))
+
+			sessions, err := db.FindSessionsByUserID(user.ID)
+			assert.NoError(t, err)
+			assert.Empty(t, sessions)
+			items, _, err := db.FindItemsByParams(user.ID, "", time.Time{}, false, false, 0)
+			assert.NoError(t, err)
+			assert.Empty(t, items)
+			revisions, err := db.FindRevisionsByItemID("item", user.ID)
+			assert.NoError(t, err)
+			assert.Empty(t, revisions)
+			settings, err := db.FindSettingsByUserID(user.ID)
+			assert.NoError(t, err)
+			assert.Empty(t, settings)
+			events, err := db.FindAuditEventsByUserID(user.ID, 0)
+			assert.NoError(t, err)
+			assert.Empty(t, events)
+
+			// Other users are untouched.
+			_, err = db.FindUser(other.ID)
+			assert.NoError(t, err)
+			sessions, err = db.FindSessionsByUserID(other.ID)
+			assert.NoError(t, err)
+			assert.Len(t, sessions, 1)
+			items, _, err = db.FindItemsByParams(other.ID, "", time.Time{}, false, false, 0)
+			assert.NoError(t, err)
+			assert.Len(t, items, 1)
+		})
+	}
+}
+
+func TestSessionInteraction(t *testing.T) {
+	for _, driver := range drivers {
+		t.Run(driver, func(t *testing.T) {
+			db, cleanup := setup(t, driver)
+			defer cleanup()
+
+			active := &model.Session{
+				UserID:       "user-1",
+				ExpireAt:     time.Now().Add(time.Hour),
+				AccessToken:  "access",
+				RefreshToken: "refresh",
+			}
+			assert.NoError(t, db.Save(active))
+
+			expired := &model.Session{
+				UserID:   "user-1",
+				ExpireAt: time.Now().Add(-time.Hour),
+			}
+			assert.NoError(t, db.Save(expired))
+
+			v, err := db.FindSessionByTokens(active.ID, "access", "refresh")
+			assert.NoError(t, err)
+			assert.Equal(t, active.ID, v.ID)
+			assert.WithinDuration(t, active.ExpireAt, v.ExpireAt, time.Millisecond)
+
+			_, err = db.FindSessionByAccessToken(active.ID, "refresh")
+			assert.True(t, db.IsNotFound(err))
+
+			_, err = db.FindSessionByUserID(active.ID, "user-2")
+			assert.True(t, db.IsNotFound(err))
+
+			sessions, err := db.FindSessionsByUserID("user-1")
+			assert.NoError(t, err)
+			assert.Len(t, sessions, 2)
+
+			sessions, err = db.FindActiveSessionsByUserID("user-1")
+			assert.NoError(t, err)
+			assert.Len(t, sessions, 1)
+
+			n, err := db.CountActiveSessions()
+			assert.NoError(t, err)
+			assert.Equal(t, 1, n)
+
+			assert.NoError(t, db.Save(&model.Session{UserID: "user-2", ExpireAt: time.Now().Add(time.Hour)}))
+
+			n, err = db.DeleteSessionsByUserID("user-1")
+			assert.NoError(t, err)
+			assert.Equal(t, 2, n)
+
+			n, err = db.DeleteSessionsByUserID("user-1")
+			assert.NoError(t, err)
+			assert.Equal(t, 0, n)
+
+			sessions, err = db.FindSessionsByUserID("user-2")
+			assert.NoError(t, err)
+			assert.Len(t, sessions, 1)
+
+			assert.NoError(t, db.Save(&model.Session{UserID: "user-2", ExpireAt: time.Now().Add(-time.Hour)}))
+			assert.NoError(t, db.Save(&model.Session{UserID: "user-3", ExpireAt: time.Now().Add(-time.Minute)}))
+
+			n, err = db.DeleteSessionsExpiredBefore(time.Now())
+			assert.NoError(t, err)
+			assert.Equal(t, 2, n)
+
+			n, err = db.DeleteSessionsExpiredBefore(time.Now())
+			assert.NoError(t, err)
+			assert.Equal(t, 0, n)
+
+			sessions, err = db.FindSessionsByUserID("user-2")
+			assert.NoError(t, err)
+			assert.Len(t, sessions, 1)
+		})
+	}
+}
+
+func TestStats(t *testing.T) {
+	for _, driver := range drivers {
+		t.Run(driver, func(t *testing.T) {
+			db, cleanup := setup(t, driver)
+			defer cleanup()
+
+			stats, err := db.Stats()
+			assert.NoError(t, err)
+			assert.Greater(t, stats.Size, int64(0))
+			assert.GreaterOrEqual(t, stats.FreePages, 0)
+		})
+	}
+}
+
+func TestBackup(t *testing.T) {
+	for _, driver := range drivers {
+		t.Run(driver, func(t *testing.T) {
+			db, cleanup := setup(t, driver)
+			defer cleanup()
+
+			user := model.NewUser()
+			user.Email = "george.abitbol@nowhere.lan"
+			assert.NoError(t, db.Save(user))
+
+			filename := filepath.Join(t.TempDir(), "backup.db")
+			f, err := os.Create(filename)
+			assert.NoError(t, err)
+
+			n, err := db.Backup(f)
+			assert.NoError(t, err)
+			assert.Greater(t, n, int64(0))
+			assert.NoError(t, f.Close())
+
+			// The database is still usable.
+			assert.NoError(t, db.Save(&model.Setting{UserID: user.ID, Name: "theme"}))
+
+			backup, err := database.Open(driver, filename)
+			assert.NoError(t, err)
+			defer backup.Close()
+
+			v, err := backup.FindUserByMail(user.Email)
+			assert.NoError(t, err)
+			assert.Equal(t, user.ID, v.ID)
+
+			settings, err := backup.FindSettingsByUserID(user.ID)
+			assert.NoError(t, err)
+			assert.Len(t, settings, 0)
+		})
+	}
+}
+
+func TestView(t *testing.T) {
+	for _, driver := range drivers {
+		t.Run(driver, func(t *testing.T) {
+			db, cleanup := setup(t, driver)
+			defer cleanup()
+
+			item := &model.Item{UserID: "user-1", ContentType: libsf.ContentTypeNote}
+			assert.NoError(t, db.Save(item))
+
+			signature, err := database.DataSignature(db, "user-1")
+			assert.NoError(t, err)
+
+			err = db.View(func(s database.Snapshot) error {
+				if driver == database.DriverSQLite {
+					// Written alongside the snapshot like a running server does.
+					assert.NoError(t, db.Save(&model.Item{UserID: "user-1", ContentType: libsf.ContentTypeNote}))
+				}
+
+				var n int
+				err := s.ForEach(&model.Item{}, func(m model.Model) error {
+					n++
+					assert.Equal(t, item.ID, m.GetID())
+					return nil
+				})
+				assert.NoError(t, err)
+				assert.Equal(t, 1, n)
+
+				v, err := database.DataSignature(s, "user-1")
+				assert.NoError(t, err)
+				assert.Equal(t, signature, v)
+				return nil
+			})
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestCompact(t *testing.T) {
+	for _, driver := range drivers {
+		t.Run(driver, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "standardfile.db")
+			db, err := database.Open(driver, filename)
+			assert.NoError(t, err)
+
+			user := model.NewUser()
+			user.Email = "george.abitbol@nowhere.lan"
+			assert.NoError(t, db.Save(user))
+			items := make([]*model.Item, 200)
+			for i := range items {
+				items[i] = &model.Item{UserID: user.ID, Content: strings.Repeat("x", 4096)}
+				assert.NoError(t, db.Save(items[i]))
+			}
+			for _, item := range items {
+				assert.NoError(t, db.Delete(item))
+			}
+			assert.NoError(t, db.Close())
+
+			before, err := os.Stat(filename)
+			assert.NoError(t, err)
+
+			assert.NoError(t, database.Compact(driver, filename))
+
+			after, err := os.Stat(filename)
+			assert.NoError(t, err)
+			assert.Less(t, after.Size(), before.Size())
+
+			db, err = database.Open(driver, filename)
+			assert.NoError(t, err)
+			defer db.Close()
+
+			v, err := db.FindUserByMail(user.Email)
+			assert.NoError(t, err)
+			assert.Equal(t, user.ID, v.ID)
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	for _, driver := range drivers {
+		t.Run(driver, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "standardfile.db")
+			db, err := database.Open(driver, filename)
+			assert.NoError(t, err)
+
+			user := model.NewUser()
+			user.Email = "george.abitbol@nowhere.lan"
+			assert.NoError(t, db.Save(user))
+			assert.NoError(t, db.Save(&model.Item{UserID: user.ID, ContentType: libsf.ContentTypeNote}))
+			orphan := &model.Item{UserID: "nobody", ContentType: libsf.ContentTypeNote}
+			assert.NoError(t, db.Save(orphan))
+			assert.NoError(t, db.Close())
+
+			report, err := database.Check(driver, filename, false)
+			assert.NoError(t, err)
+			assert.Empty(t, report.Problems)
+			assert.Equal(t, map[string][]string{"items": {orphan.ID}}, report.Orphans)
+			assert.False(t, report.Repaired)
+
+			report, err = database.Check(driver, filename, true)
+			assert.NoError(t, err)
+			assert.True(t, report.Repaired)
+
+			report, err = database.Check(driver, filename, false)
+			assert.NoError(t, err)
+			assert.Empty(t, report.Problems)
+			assert.Empty(t, report.Orphans)
+		})
+	}
+}
+
+func TestStormCheckIndexes(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "standardfile.db")
+	db, err := database.StormOpen(filename)
+	assert.NoError(t, err)
+
+	user := model.NewUser()
+	user.Email = "george.abitbol@nowhere.lan"
+	assert.NoError(t, db.Save(user))
+	assert.NoError(t, db.Save(&model.Item{UserID: user.ID, ContentType: libsf.ContentTypeNote}))
+	assert.NoError(t, db.Close())
+
+	report, err := database.StormCheck(filename, false)
+	assert.NoError(t, err)
+	assert.Empty(t, report.Problems)
+
+	// Drops the references of the user and its items.
+	bdb, err := bolt.Open(filename, 0o600, nil)
+	assert.NoError(t, err)
+	err = bdb.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket([]byte("User")).Bucket([]byte("__storm_index_Email")).Delete([]byte(user.Email)); err != nil {
+			return err
+		}
+		return tx.Bucket([]byte("Item")).DeleteBucket([]byte("__storm_index_ContentType"))
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, bdb.Close())
+
+	report, err = database.StormCheck(filename, true)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		"User.Email: " + user.ID + " is not indexed",
+		"User.Email: 0 entries for 1 records",
+		"Item.ContentType: missing index",
+	}, report.Problems)
+	assert.True(t, report.Repaired)
+
+	report, err = database.StormCheck(filename, false)
+	assert.NoError(t, err)
+	assert.Empty(t, report.Problems)
+
+	db, err = database.StormOpen(filename)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.FindUserByMail(user.Email)
+	assert.NoError(t, err)
+}
+
+func TestStormRecodec(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "standardfile.db")
+	db, err := database.StormOpen(filename)
+	assert.NoError(t, err)
+
+	now := time.Now()
+	user := model.NewUser()
+	user.Email = "george.abitbol@nowhere.lan"
+	user.PasswordCost = 110000
+	user.MFARecoveryCodes = []string{"a", "b"}
+	item := &model.Item{UserID: "user", Content: "004:note", ContentType: libsf.ContentTypeNote, Deleted: true}
+	records := []model.Model{
+		user,
+		item,
+		model.NewRevision(item),
+		&model.Session{UserID: user.ID, ExpireAt: now, AccessToken: "access"},
+		&model.Setting{UserID: user.ID, Name: "theme", Sensitive: true},
+		&model.Lock{Key: "ip:127.0.0.1", Attempts: 3, LockedUntil: now},
+		&model.Invite{Code: "code", MaxUses: 2, ExpireAt: &now},
+		&model.PKCE{CodeChallenge: "challenge", ExpireAt: now},
+		&model.AuditEvent{UserID: user.ID, Type: model.AuditLogin, IP: "127.0.0.1"},
+	}
+	for _, m := range records {
+		assert.NoError(t, db.Save(m))
+	}
+	assert.NoError(t, db.Close())
+
+	for name, c := range database.StormCodecs {
+		t.Run(name, func(t *testing.T) {
+			defer func(previous codec.MarshalUnmarshaler) { database.StormCodec = previous }(database.StormCodec)
+
+			output := filepath.Join(t.TempDir(), "standardfile.db")
+			assert.NoError(t, database.StormRecodec(filename, c, output))
+
+			if name != "msgpack" {
+				_, err := database.StormOpen(output)
+				assert.EqualError(t, err, "the database is encoded with "+name+" instead of msgpack, it can be converted with the recodec command")
+			}
+
+			database.StormCodec = c
+			db, err := database.StormOpen(output)
+			assert.NoError(t, err)
+			defer db.Close()
+
+			for _, expected := range records {
+				var actual []model.Model
+				err := db.ForEach(expected, func(m model.Model) error {
+					actual = append(actual, m)
+					return nil
+				})
+				assert.NoError(t, err)
+				if assert.Len(t, actual, 1) {
+					assert.Equal(t, normalize(t, expected), normalize(t, actual[0]))
+				}
+			}
+
+			v, err := db.FindUserByMail(user.Email)
+			assert.NoError(t, err)
+			assert.Equal(t, user.ID, v.ID)
+			assert.NoError(t, db.Close())
+
+			report, err := database.StormCheck(output, false)
+			assert.NoError(t, err)
+			assert.Empty(t, report.Problems)
+
+			// An existing output is left untouched.
+			err = database.StormRecodec(filename, c, output)
+			assert.ErrorIs(t, err, os.ErrExist)
+			_, err = os.Stat(output)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+// normalize returns the JSON of the given record with the times in UTC,
+// rounded to the microsecond like the cbor codec does.
+func normalize(t *testing.T, m model.Model) string {
+	v := reflect.ValueOf(m).Elem()
+	c := reflect.New(v.Type())
+	c.Elem().Set(v)
+
+	var walk func(v reflect.Value)
+	walk = func(v reflect.Value) {
+		for i := range v.NumField() {
+			f := v.Field(i)
+			switch tt := f.Interface().(type) {
+			case time.Time:
+				f.Set(reflect.ValueOf(tt.UTC().Round(time.Microsecond)))
+			case *time.Time:
+				if tt != nil {
+					u := tt.UTC().Round(time.Microsecond)
+					f.Set(reflect.ValueOf(&u))
+				}
+			default:
+				if f.Kind() == reflect.Struct {
+					walk(f)
+				}
+			}
+		}
+	}
+	walk(c.Elem())
+
+	payload, err := json.Marshal(c.Interface())
+	assert.NoError(t, err)
+	return string(payload)
+}
+
+func TestItemInteraction(t *testing.T) {
+	for _, driver := range drivers {
+		t.Run(driver, func(t *testing.T) {
+			db, cleanup := setup(t, driver)
+			defer cleanup()
+
+			var items []*model.Item
+			for i := 0; i < 5; i++ {
+				item := &model.Item{
+					UserID:      "user-1",
+					ContentType: libsf.ContentTypeNote,
+					Deleted:     i == 0,
+				}
+				if i == 4 {
+					item.ContentType = libsf.ContentTypeItemsKey
+				}
+				assert.NoError(t, db.Save(item))
+				items = append(items, item)
+			}
+
+			v, err := db.FindItemByUserID(items[1].ID, "user-1")
+			assert.NoError(t, err)
+			assert.Equal(t, items[1].ContentType, v.ContentType)
+
+			_, err = db.FindItemByUserID(items[1].ID, "user-2")
+			assert.True(t, db.IsNotFound(err))
+
+			all, overLimit, err := db.FindItemsByParams("user-1", "", time.Time{}, false, false, 0)
+			assert.NoError(t, err)
+			assert.False(t, overLimit)
+			assert.Len(t, all, 5)
+			assert.Equal(t, items[4].ID, all[0].ID, "ordered by most recent update")
+
+			all, overLimit, err = db.FindItemsByParams("user-1", "", time.Time{}, false, false, 2)
+			assert.NoError(t, err)
+			assert.True(t, overLimit)
+			assert.Len(t, all, 2)
+
+			all, _, err = db.FindItemsByParams("user-1", libsf.ContentTypeNote, time.Time{}, false, true, 0)
+			assert.NoError(t, err)
+			assert.Len(t, all, 3)
+
+			all, _, err = db.FindItemsByParams("user-1", "", *items[2].UpdatedAt, true, false, 0)
+			assert.NoError(t, err)
+			assert.Len(t, all, 2)
+
+			all, _, err = db.FindItemsByParams("user-1", "", *items[2].UpdatedAt, false, false, 0)
+			assert.NoError(t, err)
+			assert.Len(t, all, 3)
+
+			var ids []string
+			err = db.ForEachItemByParams("user-1", libsf.ContentTypeNote, time.Time{}, false, true, func(item *model.Item) error {
+				ids = append(ids, item.ID)
+				return nil
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, []string{items[3].ID, items[2].ID, items[1].ID}, ids, "ordered by most recent update")
+
+			ids = nil
+			err = db.ForEachItemByParams("user-1", "", *items[2].UpdatedAt, true, false, func(item *model.Item) error {
+				ids = append(ids, item.ID)
+				return nil
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, []string{items[4].ID, items[3].ID}, ids)
+
+			all, err = db.FindItemsForIntegrityCheck("user-1")
+			assert.NoError(t, err)
+			assert.Len(t, all, 4)
+
+			stats, err := db.ItemStatsByUserID("user-1")
+			assert.NoError(t, err)
+			assert.Equal(t, 5, stats.Count)
+			assert.WithinDuration(t, *items[4].UpdatedAt, *stats.UpdatedAt, time.Millisecond)
+
+			stats, err = db.ItemStatsByUserID("user-2")
+			assert.NoError(t, err)
+			assert.Equal(t, 0, stats.Count)
+			assert.Nil(t, stats.UpdatedAt)
+
+			assert.NoError(t, db.DeleteItem(items[1].ID, "user-1"))
+			assert.True(t, db.IsNotFound(db.DeleteItem(items[1].ID, "user-1")))
+		})
+	}
+}
+
+func TestForEachItemByParams(t *testing.T) {
+	for _, driver := range drivers {
+		t.Run(driver, func(t *testing.T) {
+			db, cleanup := setup(t, driver)
+			defer cleanup()
+
+			// More items than a storm batch, one per minute with nanoseconds decreasing over time.
+			base := time.Now().UTC().Truncate(time.Second)
+			var expected []string
+			for i := range 1200 {
+				updatedAt := base.Add(time.Duration(i)*time.Minute - time.Duration(i)*time.Microsecond)
+				item := &model.Item{UserID: "user-1", ContentType: libsf.ContentTypeNote}
+				item.ID = uuid.Must(uuid.NewV4()).String()
+				item.CreatedAt = &updatedAt
+				item.UpdatedAt = &updatedAt
+				if i%2 == 0 {
+					item.UserID = "user-2"
+				}
+				assert.NoError(t, db.Import(item))
+
+				if item.UserID == "user-1" {
+					expected = append([]string{item.ID}, expected...)
+				}
+			}
+
+			var actual []string
+			err := db.ForEachItemByParams("user-1", "", time.Time{}, false, true, func(item *model.Item) error {
+				actual = append(actual, item.ID)
+				return nil
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, expected, actual, "ordered by most recent update")
+
+			var n int
+			err = db.ForEachItemByParams("user-1", "", time.Time{}, false, true, func(item *model.Item) error {
+				n++
+				return errors.New("stop")
+			})
+			assert.EqualError(t, err, "stop")
+			assert.Equal(t, 1, n)
+
+			// The items can be updated while they are iterated, each one is visited once.
+			n = 0
+			err = db.ForEachItemByParams("user-1", "", time.Time{}, false, true, func(item *model.Item) error {
+				n++
+				item.Deleted = true
+				return db.Save(item)
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, len(expected), n)
+		})
+	}
+}
+
+func TestSettingInteraction(t *testing.T) {
+	for _, driver := range drivers {
+		t.Run(driver, func(t *testing.T) {
+			db, cleanup := setup(t, driver)
+			defer cleanup()
+
+			setting := &model.Setting{UserID: "user-1", Name: "LOG_SESSION_USER_AGENT", Value: "disabled"}
+			assert.NoError(t, db.Save(setting))
+			assert.NoError(t, db.Save(&model.Setting{UserID: "user-1", Name: "EMAIL_BACKUP_FREQUENCY", Value: "daily", Sensitive: true}))
+			assert.NoError(t, db.Save(&model.Setting{UserID: "user-2", Name: "EMAIL_BACKUP_FREQUENCY", Value: "weekly"}))
+
+			v, err := db.FindSettingByName("LOG_SESSION_USER_AGENT", "user-1")
+			assert.NoError(t, err)
+			assert.Equal(t, setting.ID, v.ID)
+			assert.Equal(t, "disabled", v.Value)
+
+			_, err = db.FindSettingByName("LOG_SESSION_USER_AGENT", "user-2")
+			assert.True(t, db.IsNotFound(err))
+
+			settings, err := db.FindSettingsByUserID("user-1")
+			assert.NoError(t, err)
+			assert.Len(t, settings, 2)
+			assert.Equal(t, "EMAIL_BACKUP_FREQUENCY", settings[0].Name)
+			assert.True(t, settings[0].Sensitive)
+
+			assert.NoError(t, db.Delete(setting))
+			_, err = db.FindSettingByName("LOG_SESSION_USER_AGENT", "user-1")
+			assert.True(t, db.IsNotFound(err))
+		})
+	}
+}
+
+func TestLockInteraction(t *testing.T) {
+	for _, driver := range drivers {
+		t.Run(driver, func(t *testing.T) {
+			db, cleanup := setup(t, driver)
+			defer cleanup()
+
+			lock := &model.Lock{Key: "ip:127.0.0.1", Attempts: 3, LockedUntil: time.Now().Add(time.Minute)}
+			assert.NoError(t, db.Save(lock))
+
+			v, err := db.FindLock("ip:127.0.0.1")
+			assert.NoError(t, err)
+			assert.Equal(t, lock.ID, v.ID)
+			assert.Equal(t, 3, v.Attempts)
+			assert.WithinDuration(t, lock.LockedUntil, v.LockedUntil, time.Millisecond)
+
+			err = db.Save(&model.Lock{Key: "ip:127.0.0.1"})
+			assert.True(t, db.IsAlreadyExists(err))
+
+			assert.NoError(t, db.Delete(lock))
+			_, err = db.FindLock("ip:127.0.0.1")
+			assert.True(t, db.IsNotFound(err))
+
+			// Old locks
+			for i, key := range []string{"ip:10.0.0.1", "ip:10.0.0.2", "ip:10.0.0.3"} {
+				updatedAt := time.Now().Add(-time.Duration(i) * time.Hour)
+				lock := &model.Lock{Key: key}
+				lock.ID = uuid.Must(uuid.NewV4()).String()
+				lock.CreatedAt = &updatedAt
+				lock.UpdatedAt = &updatedAt
+				assert.NoError(t, db.Import(lock))
+			}
+
+			n, err := db.DeleteLocksBefore(time.Now().Add(-30 * time.Minute))
+			assert.NoError(t, err)
+			assert.Equal(t, 2, n)
+
+			_, err = db.FindLock("ip:10.0.0.1")
+			assert.NoError(t, err)
+			_, err = db.FindLock("ip:10.0.0.2")
+			assert.True(t, db.IsNotFound(err))
+		})
+	}
+}
+
+func TestInviteInteraction(t *testing.T) {
+	for _, driver := range drivers {
+		t.Run(driver, func(t *testing.T) {
+			db, cleanup := setup(t, driver)
+			defer cleanup()
+
+			expireAt := time.Now().Add(time.Hour)
+			invite := &model.Invite{Code: "abcdef", MaxUses: 2, ExpireAt: &expireAt}
+			assert.NoError(t, db.Save(invite))
+
+			v, err := db.FindInvite("abcdef")
+			assert.NoError(t, err)
+			assert.Equal(t, invite.ID, v.ID)
+			assert.Equal(t, 2, v.MaxUses)
+			assert.Equal(t, 0, v.Uses)
+			assert.WithinDuration(t, expireAt, *v.ExpireAt, time.Millisecond)
+
+			err = db.Save(&model.Invite{Code: "abcdef", MaxUses: 1})
+			assert.True(t, db.IsAlreadyExists(err))
+
+			assert.NoError(t, db.Save(&model.Invite{Code: "ghijkl", MaxUses: 1}))
+			v, err = db.FindInvite("ghijkl")
+			assert.NoError(t, err)
+			assert.Nil(t, v.ExpireAt)
+
+			assert.NoError(t, db.Delete(invite))
+			_, err = db.FindInvite("abcdef")
+			assert.True(t, db.IsNotFound(err))
+		})
+	}
+}
+
+func TestAuditInteraction(t *testing.T) {
+	for _, driver := range drivers {
+		t.Run(driver, func(t *testing.T) {
+			db, cleanup := setup(t, driver)
+			defer cleanup()
+
+			events, err := db.FindAuditEventsByUserID("user", 0)
+			assert.NoError(t, err)
+			assert.Empty(t, events)
+
+			now := time.Now().UTC()
+			for i, kind := range []string{model.AuditLogin, model.AuditLoginFailed, model.AuditLogout} {
+				createdAt := now.Add(time.Duration(i-2) * time.Hour)
+				event := &model.AuditEvent{UserID: "user", Type: kind, IP: "127.0.0.1", UserAgent: "test", SessionID: "session"}
+				event.ID = kind
+				event.CreatedAt, event.UpdatedAt = &createdAt, &createdAt
+				assert.NoError(t, db.Import(event))
+			}
+			assert.NoError(t, db.Save(&model.AuditEvent{UserID: "other", Type: model.AuditLogin}))
+
+			events, err = db.FindAuditEventsByUserID("user", 0)
+			assert.NoError(t, err)
+			if assert.Len(t, events, 3) {
+				assert.Equal(t, model.AuditLogout, events[0].Type) // Most recent first
+				assert.Equal(t, model.AuditLogin, events[2].Type)
+				assert.Equal(t, "127.0.0.1", events[0].IP)
+				assert.Equal(t, "test", events[0].UserAgent)
+				assert.Equal(t, "session", events[0].SessionID)
+			}
+
+			events, err = db.FindAuditEventsByUserID("user", 2)
+			assert.NoError(t, err)
+			assert.Len(t, events, 2)
+
+			n, err := db.DeleteAuditEventsBefore(now.Add(-30 * time.Minute))
+			assert.NoError(t, err)
+			assert.Equal(t, 2, n)
+
+			events, err = db.FindAuditEventsByUserID("user", 0)
+			assert.NoError(t, err)
+			if assert.Len(t, events, 1) {
+				assert.Equal(t, model.AuditLogout, events[0].Type)
+			}
+
+			events, err = db.FindAuditEventsByUserID("other", 0)
+			assert.NoError(t, err)
+			assert.Len(t, events, 1)
+		})
+	}
+}
+
+func TestPKCEInteraction(t *testing.T) {
+	for _, driver := range drivers {
+		t.Run(driver, func(t *testing.T) {
+			db, cleanup := setup(t, driver)
+			defer cleanup()
+
+			assert.NoError(t, db.Save(&model.PKCE{CodeChallenge: "valid", ExpireAt: time.Now().Add(time.Hour)}))
+			assert.NoError(t, db.Save(&model.PKCE{CodeChallenge: "expired", ExpireAt: time.Now().Add(-time.Hour)}))
+
+			n, err := db.RevokeExpiredChallenges()
+			assert.NoError(t, err)
+			assert.Equal(t, 1, n)
+			_, err = db.FindPKCE("expired")
+			assert.True(t, db.IsNotFound(err))
+
+			_, err = db.FindPKCE("valid")
+			assert.NoError(t, err)
+			assert.NoError(t, db.RemovePKCE("valid"))
+			_, err = db.FindPKCE("valid")
+			assert.True(t, db.IsNotFound(err))
+		})
+	}
+}
+
+func setup(t *testing.T, driver string) (database.Client, func()) {
+	dir, err := os.MkdirTemp("", "standardfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := database.Open(driver, filepath.Join(dir, "standardfile.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
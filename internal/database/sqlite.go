@@ -0,0 +1,1250 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/mdouchement/standardfile/internal/model"
+	"github.com/pkg/errors"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+type (
+	sqlt struct {
+		db *sql.DB
+	}
+
+	// sqltSnapshot reads the records from a read transaction.
+	sqltSnapshot struct {
+		tx *sql.Tx
+	}
+
+	// sqliteQuerier is implemented by *sql.DB and *sql.Tx.
+	sqliteQuerier interface {
+		Query(query string, args ...any) (*sql.Rows, error)
+	}
+
+	// A sqliteTable describes how a model is mapped to its table.
+	sqliteTable struct {
+		name    string
+		columns []string
+		values  func(m model.Model) []any
+		scan    func(s scanner) (model.Model, error)
+	}
+
+	// scanner is implemented by both *sql.Row and *sql.Rows.
+	scanner interface {
+		Scan(dest ...any) error
+	}
+)
+
+// sqliteSchema is applied each time the database is opened, so all statements must be idempotent.
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS users (
+		id                  TEXT PRIMARY KEY,
+		created_at          INTEGER,
+		updated_at          INTEGER,
+		email               TEXT NOT NULL UNIQUE,
+		password            TEXT NOT NULL DEFAULT '',
+		pw_cost             INTEGER NOT NULL DEFAULT 0,
+		pw_nonce            TEXT NOT NULL DEFAULT '',
+		pw_auth             TEXT NOT NULL DEFAULT '',
+		version             TEXT NOT NULL DEFAULT '',
+		pw_salt             TEXT NOT NULL DEFAULT '',
+		password_updated_at INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE TABLE IF NOT EXISTS sessions (
+		id            TEXT PRIMARY KEY,
+		created_at    INTEGER,
+		updated_at    INTEGER,
+		expire_at     INTEGER NOT NULL,
+		user_id       TEXT NOT NULL,
+		user_agent    TEXT NOT NULL DEFAULT '',
+		api_version   TEXT NOT NULL DEFAULT '',
+		access_token  TEXT NOT NULL DEFAULT '',
+		refresh_token TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX IF NOT EXISTS sessions_user_id ON sessions (user_id, created_at)`,
+	`CREATE INDEX IF NOT EXISTS sessions_access_token ON sessions (access_token)`,
+	`CREATE INDEX IF NOT EXISTS sessions_expire_at ON sessions (expire_at)`,
+	`CREATE TABLE IF NOT EXISTS items (
+		id           TEXT PRIMARY KEY,
+		created_at   INTEGER,
+		updated_at   INTEGER,
+		user_id      TEXT NOT NULL,
+		items_key_id TEXT NOT NULL DEFAULT '',
+		content      TEXT NOT NULL DEFAULT '',
+		content_type TEXT NOT NULL DEFAULT '',
+		enc_item_key TEXT NOT NULL DEFAULT '',
+		deleted      INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE INDEX IF NOT EXISTS items_user_id_updated_at ON items (user_id, updated_at)`,
+	`CREATE INDEX IF NOT EXISTS items_user_id_content_type ON items (user_id, content_type, updated_at)`,
+	`CREATE TABLE IF NOT EXISTS revisions (
+		id              TEXT PRIMARY KEY,
+		created_at      INTEGER,
+		updated_at      INTEGER,
+		item_id         TEXT NOT NULL,
+		user_id         TEXT NOT NULL,
+		items_key_id    TEXT NOT NULL DEFAULT '',
+		content         TEXT NOT NULL DEFAULT '',
+		content_type    TEXT NOT NULL DEFAULT '',
+		enc_item_key    TEXT NOT NULL DEFAULT '',
+		item_updated_at INTEGER
+	)`,
+	`CREATE INDEX IF NOT EXISTS revisions_item_id ON revisions (item_id, user_id, created_at)`,
+	`CREATE INDEX IF NOT EXISTS revisions_created_at ON revisions (created_at)`,
+	`CREATE TABLE IF NOT EXISTS settings (
+		id                        TEXT PRIMARY KEY,
+		created_at                INTEGER,
+		updated_at                INTEGER,
+		user_id                   TEXT NOT NULL,
+		name                      TEXT NOT NULL,
+		value                     TEXT NOT NULL DEFAULT '',
+		sensitive                 INTEGER NOT NULL DEFAULT 0,
+		server_encryption_version INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS settings_user_id_name ON settings (user_id, name)`,
+	`CREATE TABLE IF NOT EXISTS locks (
+		id           TEXT PRIMARY KEY,
+		created_at   INTEGER,
+		updated_at   INTEGER,
+		key          TEXT NOT NULL,
+		attempts     INTEGER NOT NULL DEFAULT 0,
+		locked_until INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS locks_key ON locks (key)`,
+	`CREATE INDEX IF NOT EXISTS locks_updated_at ON locks (updated_at)`,
+	`CREATE TABLE IF NOT EXISTS invites (
+		id         TEXT PRIMARY KEY,
+		created_at INTEGER,
+		updated_at INTEGER,
+		code       TEXT NOT NULL,
+		max_uses   INTEGER NOT NULL DEFAULT 0,
+		uses       INTEGER NOT NULL DEFAULT 0,
+		expire_at  INTEGER
+	)`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS invites_code ON invites (code)`,
+	`CREATE TABLE IF NOT EXISTS pkces (
+		id             TEXT PRIMARY KEY,
+		created_at     INTEGER,
+		updated_at     INTEGER,
+		code_challenge TEXT NOT NULL,
+		expire_at      INTEGER NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS pkces_code_challenge ON pkces (code_challenge)`,
+	`CREATE INDEX IF NOT EXISTS pkces_expire_at ON pkces (expire_at)`,
+	`CREATE TABLE IF NOT EXISTS audit_events (
+		id         TEXT PRIMARY KEY,
+		created_at INTEGER,
+		updated_at INTEGER,
+		user_id    TEXT NOT NULL,
+		type       TEXT NOT NULL,
+		ip         TEXT NOT NULL DEFAULT '',
+		user_agent TEXT NOT NULL DEFAULT '',
+		session_id TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX IF NOT EXISTS audit_events_user_id ON audit_events (user_id, created_at)`,
+	`CREATE INDEX IF NOT EXISTS audit_events_created_at ON audit_events (created_at)`,
+}
+
+// sqliteColumns are the columns added after the creation of their table.
+// They are added to the existing databases when missing.
+var sqliteColumns = []struct {
+	table      string
+	column     string
+	definition string
+}{
+	{"users", "mfa_secret", "TEXT NOT NULL DEFAULT ''"},
+	{"users", "mfa_recovery_codes", "TEXT NOT NULL DEFAULT ''"},
+	{"users", "disabled", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+var (
+	userColumns     = []string{"id", "created_at", "updated_at", "email", "password", "pw_cost", "pw_nonce", "pw_auth", "version", "pw_salt", "password_updated_at", "mfa_secret", "mfa_recovery_codes", "disabled"}
+	sessionColumns  = []string{"id", "created_at", "updated_at", "expire_at", "user_id", "user_agent", "api_version", "access_token", "refresh_token"}
+	itemColumns     = []string{"id", "created_at", "updated_at", "user_id", "items_key_id", "content", "content_type", "enc_item_key", "deleted"}
+	revisionColumns = []string{"id", "created_at", "updated_at", "item_id", "user_id", "items_key_id", "content", "content_type", "enc_item_key", "item_updated_at"}
+	settingColumns  = []string{"id", "created_at", "updated_at", "user_id", "name", "value", "sensitive", "server_encryption_version"}
+	lockColumns     = []string{"id", "created_at", "updated_at", "key", "attempts", "locked_until"}
+	inviteColumns   = []string{"id", "created_at", "updated_at", "code", "max_uses", "uses", "expire_at"}
+	pkceColumns     = []string{"id", "created_at", "updated_at", "code_challenge", "expire_at"}
+	auditColumns    = []string{"id", "created_at", "updated_at", "user_id", "type", "ip", "user_agent", "session_id"}
+
+	// sqliteUserTables are the tables of the records that belong to a user.
+	sqliteUserTables = []string{"sessions", "items", "revisions", "settings", "audit_events"}
+
+	sqliteTables = map[reflect.Type]*sqliteTable{
+		reflect.TypeOf(&model.User{}): {
+			name:    "users",
+			columns: userColumns,
+			values:  func(m model.Model) []any { return userValues(m.(*model.User)) },
+			scan:    func(s scanner) (model.Model, error) { return nilable(scanUser(s)) },
+		},
+		reflect.TypeOf(&model.Session{}): {
+			name:    "sessions",
+			columns: sessionColumns,
+			values:  func(m model.Model) []any { return sessionValues(m.(*model.Session)) },
+			scan:    func(s scanner) (model.Model, error) { return nilable(scanSession(s)) },
+		},
+		reflect.TypeOf(&model.Item{}): {
+			name:    "items",
+			columns: itemColumns,
+			values:  func(m model.Model) []any { return itemValues(m.(*model.Item)) },
+			scan:    func(s scanner) (model.Model, error) { return nilable(scanItem(s)) },
+		},
+		reflect.TypeOf(&model.Revision{}): {
+			name:    "revisions",
+			columns: revisionColumns,
+			values:  func(m model.Model) []any { return revisionValues(m.(*model.Revision)) },
+			scan:    func(s scanner) (model.Model, error) { return nilable(scanRevision(s)) },
+		},
+		reflect.TypeOf(&model.Setting{}): {
+			name:    "settings",
+			columns: settingColumns,
+			values:  func(m model.Model) []any { return settingValues(m.(*model.Setting)) },
+			scan:    func(s scanner) (model.Model, error) { return nilable(scanSetting(s)) },
+		},
+		reflect.TypeOf(&model.Lock{}): {
+			name:    "locks",
+			columns: lockColumns,
+			values:  func(m model.Model) []any { return lockValues(m.(*model.Lock)) },
+			scan:    func(s scanner) (model.Model, error) { return nilable(scanLock(s)) },
+		},
+		reflect.TypeOf(&model.Invite{}): {
+			name:    "invites",
+			columns: inviteColumns,
+			values:  func(m model.Model) []any { return inviteValues(m.(*model.Invite)) },
+			scan:    func(s scanner) (model.Model, error) { return nilable(scanInvite(s)) },
+		},
+		reflect.TypeOf(&model.PKCE{}): {
+			name:    "pkces",
+			columns: pkceColumns,
+			values:  func(m model.Model) []any { return pkceValues(m.(*model.PKCE)) },
+			scan:    func(s scanner) (model.Model, error) { return nilable(scanPKCE(s)) },
+		},
+		reflect.TypeOf(&model.AuditEvent{}): {
+			name:    "audit_events",
+			columns: auditColumns,
+			values:  func(m model.Model) []any { return auditEventValues(m.(*model.AuditEvent)) },
+			scan:    func(s scanner) (model.Model, error) { return nilable(scanAuditEvent(s)) },
+		},
+	}
+)
+
+// sqliteItemsBatch is the number of items read per query when the items are iterated.
+const sqliteItemsBatch = 500
+
+// SQLiteInit initializes SQLite database.
+func SQLiteInit(database string) error {
+	c, err := sqliteOpen(database)
+	if err != nil {
+		return err
+	}
+	return c.Close()
+}
+
+// SQLiteReIndex reindex SQLite database.
+func SQLiteReIndex(database string) error {
+	c, err := sqliteOpen(database)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if _, err = c.db.Exec("REINDEX"); err != nil {
+		return errors.Wrap(err, "could not reindex")
+	}
+
+	_, err = c.db.Exec("ANALYZE")
+	return errors.Wrap(err, "could not analyze")
+}
+
+// SQLiteCompact rebuilds the SQLite database file, the free pages are not copied.
+func SQLiteCompact(database string) error {
+	c, err := sqliteOpen(database)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	_, err = c.db.Exec("VACUUM")
+	return errors.Wrap(err, "could not compact database")
+}
+
+// SQLiteCheck verifies the pages and indexes of the SQLite database and looks for orphaned records.
+// With repair, the orphaned records are deleted and the indexes are rebuilt.
+func SQLiteCheck(database string, repair bool) (*CheckReport, error) {
+	c, err := sqliteOpen(database)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	report := &CheckReport{Orphans: map[string][]string{}}
+	rows, err := c.db.Query("PRAGMA integrity_check")
+	if err != nil {
+		return nil, errors.Wrap(err, "could not check database")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var problem string
+		if err = rows.Scan(&problem); err != nil {
+			return nil, errors.Wrap(err, "could not check database")
+		}
+		if problem != "ok" {
+			report.Problems = append(report.Problems, problem)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "could not check database")
+	}
+
+	for _, table := range sqliteUserTables {
+		ids, err := c.ids("SELECT id FROM " + table + " WHERE user_id NOT IN (SELECT id FROM users)")
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not find orphaned %s", table)
+		}
+		if len(ids) > 0 {
+			report.Orphans[table] = ids
+		}
+	}
+
+	if !repair || (len(report.Problems) == 0 && len(report.Orphans) == 0) {
+		return report, nil
+	}
+
+	for table := range report.Orphans {
+		if _, err = c.db.Exec("DELETE FROM " + table + " WHERE user_id NOT IN (SELECT id FROM users)"); err != nil {
+			return report, errors.Wrapf(err, "could not delete orphaned %s", table)
+		}
+	}
+	if _, err = c.db.Exec("REINDEX"); err != nil {
+		return report, errors.Wrap(err, "could not reindex")
+	}
+
+	report.Repaired = true
+	return report, nil
+}
+
+// SQLiteOpen returns a new SQLite database connection.
+func SQLiteOpen(database string) (Client, error) {
+	return sqliteOpen(database)
+}
+
+func sqliteOpen(database string) (*sqlt, error) {
+	// WAL journal lets external tools read the database while the server is running.
+	dsn := "file:" + database + "?_txlock=immediate&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)"
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get database connection")
+	}
+
+	for _, stmt := range sqliteSchema {
+		if _, err = db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, errors.Wrap(err, "could not apply database schema")
+		}
+	}
+
+	for _, c := range sqliteColumns {
+		var n int
+		err = db.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", c.table, c.column).Scan(&n)
+		if err == nil && n == 0 {
+			_, err = db.Exec("ALTER TABLE " + c.table + " ADD COLUMN " + c.column + " " + c.definition)
+		}
+		if err != nil {
+			db.Close()
+			return nil, errors.Wrap(err, "could not apply database schema")
+		}
+	}
+
+	return &sqlt{
+		db: db,
+	}, nil
+}
+
+func (c *sqlt) Save(m model.Model) error {
+	t := time.Now().UTC()
+	m.SetUpdatedAt(t)
+
+	if m.GetID() == "" {
+		m.SetID(uuid.Must(uuid.NewV4()).String())
+		m.SetCreatedAt(t)
+	}
+
+	table, err := sqliteTableOf(m)
+	if err == nil {
+		err = c.upsert(table.name, table.columns, table.values(m))
+	}
+
+	return errors.Wrap(err, "could not save the model")
+}
+
+func (c *sqlt) Delete(m model.Model) error {
+	t, err := sqliteTableOf(m)
+	if err != nil {
+		return errors.Wrap(err, "could not delete the model")
+	}
+
+	err = c.exec(true, "DELETE FROM "+t.name+" WHERE id = ?", m.GetID())
+	return errors.Wrap(err, "could not delete the model")
+}
+
+func (c *sqlt) Import(m model.Model) error {
+	t, err := sqliteTableOf(m)
+	if err == nil {
+		err = c.upsert(t.name, t.columns, t.values(m))
+	}
+
+	return errors.Wrap(err, "could not import the model")
+}
+
+func (c *sqlt) ImportAll(next func() (model.Model, error)) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "could not begin transaction")
+	}
+	defer tx.Rollback()
+
+	for {
+		m, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		t, err := sqliteTableOf(m)
+		if err == nil {
+			_, err = tx.Exec(upsertQuery(t.name, t.columns), t.values(m)...)
+		}
+		if err != nil {
+			return errors.Wrap(err, "could not import the model")
+		}
+	}
+
+	return errors.Wrap(tx.Commit(), "could not commit transaction")
+}
+
+func (c *sqlt) ForEach(kind model.Model, fn func(m model.Model) error) error {
+	return sqliteForEach(c.db, kind, fn)
+}
+
+func (c *sqlt) View(fn func(s Snapshot) error) error {
+	// A read-only transaction is deferred, its snapshot does not block the writes in WAL mode.
+	tx, err := c.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return errors.Wrap(err, "could not begin transaction")
+	}
+	defer tx.Rollback()
+
+	// The snapshot is only taken by the first read of the transaction.
+	var n int
+	if err = tx.QueryRow("SELECT count(*) FROM sqlite_master").Scan(&n); err != nil {
+		return errors.Wrap(err, "could not start snapshot")
+	}
+
+	return fn(&sqltSnapshot{tx: tx})
+}
+
+func (s *sqltSnapshot) ForEach(kind model.Model, fn func(m model.Model) error) error {
+	return sqliteForEach(s.tx, kind, fn)
+}
+
+func (s *sqltSnapshot) FindItemsForIntegrityCheck(userID string) ([]*model.Item, error) {
+	return sqliteItemsForIntegrityCheck(s.tx, userID)
+}
+
+func sqliteForEach(db sqliteQuerier, kind model.Model, fn func(m model.Model) error) error {
+	t, err := sqliteTableOf(kind)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Query(selectFrom(t.name, t.columns) + " ORDER BY rowid")
+	if err != nil {
+		return errors.Wrap(err, "could not iterate over records")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		m, err := t.scan(rows)
+		if err != nil {
+			return errors.Wrap(err, "could not read record")
+		}
+
+		if err = fn(m); err != nil {
+			return err
+		}
+	}
+
+	return errors.Wrap(rows.Err(), "could not iterate over records")
+}
+
+func (c *sqlt) Close() error {
+	return c.db.Close()
+}
+
+func (c *sqlt) IsNotFound(err error) bool {
+	return errors.Cause(err) == sql.ErrNoRows
+}
+
+func (c *sqlt) IsAlreadyExists(err error) bool {
+	serr, ok := errors.Cause(err).(*sqlite.Error)
+	if !ok {
+		return false
+	}
+
+	return serr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || serr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+}
+
+func (c *sqlt) Stats() (Stats, error) {
+	var count, size int64
+	var stats Stats
+	err := c.db.QueryRow("SELECT page_count, page_size, freelist_count FROM pragma_page_count(), pragma_page_size(), pragma_freelist_count()").Scan(&count, &size, &stats.FreePages)
+	if err != nil {
+		return stats, errors.Wrap(err, "could not read database")
+	}
+
+	stats.Size = count * size
+	return stats, nil
+}
+
+func (c *sqlt) Backup(w io.Writer) (int64, error) {
+	// VACUUM INTO writes a consistent copy of the database in an empty file.
+	tmp, err := os.CreateTemp("", "standardfile-backup.*.sqlite")
+	if err != nil {
+		return 0, errors.Wrap(err, "could not create backup file")
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err = c.db.Exec("VACUUM INTO ?", tmp.Name()); err != nil {
+		return 0, errors.Wrap(err, "could not backup database")
+	}
+
+	n, err := io.Copy(w, tmp)
+	return n, errors.Wrap(err, "could not write backup")
+}
+
+func (c *sqlt) FindUser(id string) (*model.User, error) {
+	user, err := scanUser(c.db.QueryRow(selectFrom("users", userColumns)+" WHERE id = ?", id))
+	return user, errors.Wrap(err, "find user by id")
+}
+
+func (c *sqlt) FindUserByMail(email string) (*model.User, error) {
+	user, err := scanUser(c.db.QueryRow(selectFrom("users", userColumns)+" WHERE email = ?", email))
+	return user, errors.Wrap(err, "find user by mail")
+}
+
+func (c *sqlt) DeleteUser(id string) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "could not begin transaction")
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM users WHERE id = ?", id)
+	if err != nil {
+		return errors.Wrap(err, "could not delete user")
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "could not delete user")
+	}
+	if n == 0 {
+		return errors.Wrap(sql.ErrNoRows, "find user by id")
+	}
+
+	for _, table := range sqliteUserTables {
+		if _, err = tx.Exec("DELETE FROM "+table+" WHERE user_id = ?", id); err != nil {
+			return errors.Wrapf(err, "could not delete user's %s", table)
+		}
+	}
+
+	if _, err = tx.Exec("DELETE FROM pkces WHERE expire_at <= ?", time.Now().UnixNano()); err != nil {
+		return errors.Wrap(err, "could not delete expired challenges")
+	}
+
+	return errors.Wrap(tx.Commit(), "could not commit transaction")
+}
+
+func (c *sqlt) FindSession(id string) (*model.Session, error) {
+	session, err := scanSession(c.db.QueryRow(selectFrom("sessions", sessionColumns)+" WHERE id = ?", id))
+	return session, errors.Wrap(err, "find session by id")
+}
+
+func (c *sqlt) FindSessionByUserID(id, userID string) (*model.Session, error) {
+	session, err := scanSession(c.db.QueryRow(selectFrom("sessions", sessionColumns)+" WHERE id = ? AND user_id = ?", id, userID))
+	return session, errors.Wrap(err, "find session by id and user id")
+}
+
+func (c *sqlt) FindSessionByAccessToken(id, token string) (*model.Session, error) {
+	session, err := scanSession(c.db.QueryRow(selectFrom("sessions", sessionColumns)+" WHERE id = ? AND access_token = ?", id, token))
+	return session, errors.Wrap(err, "find session by access token")
+}
+
+func (c *sqlt) FindSessionByTokens(id, access, refresh string) (*model.Session, error) {
+	session, err := scanSession(c.db.QueryRow(selectFrom("sessions", sessionColumns)+" WHERE id = ? AND access_token = ? AND refresh_token = ?", id, access, refresh))
+	return session, errors.Wrap(err, "could not find session by tokens")
+}
+
+func (c *sqlt) FindSessionsByUserID(userID string) ([]*model.Session, error) {
+	sessions, err := c.sessions(selectFrom("sessions", sessionColumns)+" WHERE user_id = ? ORDER BY created_at", userID)
+	return sessions, errors.Wrap(err, "could not find sessions by user id")
+}
+
+func (c *sqlt) FindActiveSessionsByUserID(userID string) ([]*model.Session, error) {
+	sessions, err := c.sessions(selectFrom("sessions", sessionColumns)+" WHERE user_id = ? AND expire_at > ? ORDER BY created_at", userID, time.Now().UnixNano())
+	return sessions, errors.Wrap(err, "could not find sessions by user id")
+}
+
+func (c *sqlt) CountActiveSessions() (int, error) {
+	var n int
+	err := c.db.QueryRow("SELECT COUNT(*) FROM sessions WHERE expire_at > ?", time.Now().UnixNano()).Scan(&n)
+	return n, errors.Wrap(err, "could not count active sessions")
+}
+
+func (c *sqlt) DeleteSessionsByUserID(userID string) (int, error) {
+	result, err := c.db.Exec("DELETE FROM sessions WHERE user_id = ?", userID)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not delete sessions by user id")
+	}
+
+	n, err := result.RowsAffected()
+	return int(n), errors.Wrap(err, "could not delete sessions by user id")
+}
+
+func (c *sqlt) DeleteSessionsExpiredBefore(t time.Time) (int, error) {
+	result, err := c.db.Exec("DELETE FROM sessions WHERE expire_at <= ?", t.UnixNano())
+	if err != nil {
+		return 0, errors.Wrap(err, "could not delete expired sessions")
+	}
+
+	n, err := result.RowsAffected()
+	return int(n), errors.Wrap(err, "could not delete expired sessions")
+}
+
+func (c *sqlt) FindItem(id string) (*model.Item, error) {
+	item, err := scanItem(c.db.QueryRow(selectFrom("items", itemColumns)+" WHERE id = ?", id))
+	return item, errors.Wrap(err, "could not find item")
+}
+
+func (c *sqlt) FindItemByUserID(id, userID string) (*model.Item, error) {
+	item, err := scanItem(c.db.QueryRow(selectFrom("items", itemColumns)+" WHERE id = ? AND user_id = ?", id, userID))
+	return item, errors.Wrap(err, "could not find item by user id")
+}
+
+func (c *sqlt) FindItemsByParams(userID, contentType string, updated time.Time, strictTime, noDeleted bool, limit int) ([]*model.Item, bool, error) {
+	query, args := sqliteItemsQuery(userID, contentType, updated, strictTime, noDeleted)
+
+	stmt := selectFrom("items", itemColumns) + " WHERE " + query + " ORDER BY updated_at DESC"
+	if limit > 0 {
+		stmt += " LIMIT ?"
+		args = append(args, limit+1)
+	}
+
+	items, err := c.items(stmt, args...)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "could not find items")
+	}
+
+	var overLimit bool
+	if limit != 0 && len(items) > limit {
+		items = items[:limit]
+		overLimit = true
+	}
+
+	return items, overLimit, nil
+}
+
+func (c *sqlt) ForEachItemByParams(userID, contentType string, updated time.Time, strictTime, noDeleted bool, fn func(item *model.Item) error) error {
+	query, args := sqliteItemsQuery(userID, contentType, updated, strictTime, noDeleted)
+	query = selectFrom("items", itemColumns) + " WHERE " + query
+
+	// The items are paginated by keyset so no read snapshot is held while fn is called (e.g. writing to a slow client),
+	// it would prevent the WAL checkpoints.
+	page, pageArgs := query, args
+	for {
+		items, err := c.items(page+" ORDER BY updated_at DESC, id LIMIT ?", append(pageArgs, sqliteItemsBatch)...)
+		if err != nil {
+			return errors.Wrap(err, "could not iterate over items")
+		}
+
+		// The keyset of the next page is read before fn updates the items.
+		if n := len(items); n > 0 {
+			last := items[n-1]
+			page = query + " AND (updated_at < ? OR (updated_at = ? AND id > ?))"
+			pageArgs = append(args[:len(args):len(args)], last.UpdatedAt.UnixNano(), last.UpdatedAt.UnixNano(), last.ID)
+		}
+
+		for _, item := range items {
+			if err = fn(item); err != nil {
+				return err
+			}
+		}
+
+		if len(items) < sqliteItemsBatch {
+			return nil
+		}
+	}
+}
+
+func (c *sqlt) FindItemsForIntegrityCheck(userID string) ([]*model.Item, error) {
+	return sqliteItemsForIntegrityCheck(c.db, userID)
+}
+
+func (c *sqlt) DeleteItem(id, userID string) error {
+	err := c.exec(true, "DELETE FROM items WHERE id = ? AND user_id = ?", id, userID)
+	return errors.Wrap(err, "could not delete item")
+}
+
+func (c *sqlt) ItemStatsByUserID(userID string) (ItemStats, error) {
+	var stats ItemStats
+	var updatedAt sql.NullInt64
+	err := c.db.QueryRow("SELECT COUNT(*), MAX(updated_at) FROM items WHERE user_id = ?", userID).Scan(&stats.Count, &updatedAt)
+	stats.UpdatedAt = timeFromSQL(updatedAt)
+	return stats, errors.Wrap(err, "could not compute item stats")
+}
+
+func (c *sqlt) FindRevisionsByItemID(itemID, userID string) ([]*model.Revision, error) {
+	rows, err := c.db.Query(selectFrom("revisions", revisionColumns)+" WHERE item_id = ? AND user_id = ? ORDER BY created_at DESC", itemID, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not find revisions by item id")
+	}
+	defer rows.Close()
+
+	revisions := make([]*model.Revision, 0)
+	for rows.Next() {
+		revision, err := scanRevision(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not find revisions by item id")
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, errors.Wrap(rows.Err(), "could not find revisions by item id")
+}
+
+func (c *sqlt) FindRevisionByItemID(id, itemID, userID string) (*model.Revision, error) {
+	revision, err := scanRevision(c.db.QueryRow(selectFrom("revisions", revisionColumns)+" WHERE id = ? AND item_id = ? AND user_id = ?", id, itemID, userID))
+	return revision, errors.Wrap(err, "could not find revision by item id")
+}
+
+func (c *sqlt) DeleteRevisionsByItemID(itemID, userID string) error {
+	err := c.exec(false, "DELETE FROM revisions WHERE item_id = ? AND user_id = ?", itemID, userID)
+	return errors.Wrap(err, "could not delete revisions")
+}
+
+func (c *sqlt) DeleteRevisionsBefore(t time.Time) (int, error) {
+	result, err := c.db.Exec("DELETE FROM revisions WHERE created_at < ?", t.UnixNano())
+	if err != nil {
+		return 0, errors.Wrap(err, "could not delete old revisions")
+	}
+
+	n, err := result.RowsAffected()
+	return int(n), errors.Wrap(err, "could not delete old revisions")
+}
+
+func (c *sqlt) FindSettingsByUserID(userID string) ([]*model.Setting, error) {
+	rows, err := c.db.Query(selectFrom("settings", settingColumns)+" WHERE user_id = ? ORDER BY name", userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not find settings by user id")
+	}
+	defer rows.Close()
+
+	settings := make([]*model.Setting, 0)
+	for rows.Next() {
+		setting, err := scanSetting(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not find settings by user id")
+		}
+		settings = append(settings, setting)
+	}
+	return settings, errors.Wrap(rows.Err(), "could not find settings by user id")
+}
+
+func (c *sqlt) FindSettingByName(name, userID string) (*model.Setting, error) {
+	setting, err := scanSetting(c.db.QueryRow(selectFrom("settings", settingColumns)+" WHERE name = ? AND user_id = ?", name, userID))
+	return setting, errors.Wrap(err, "could not find setting by name")
+}
+
+func (c *sqlt) FindLock(key string) (*model.Lock, error) {
+	lock, err := scanLock(c.db.QueryRow(selectFrom("locks", lockColumns)+" WHERE key = ?", key))
+	return lock, errors.Wrap(err, "could not find lock")
+}
+
+func (c *sqlt) DeleteLocksBefore(t time.Time) (int, error) {
+	result, err := c.db.Exec("DELETE FROM locks WHERE updated_at < ?", t.UnixNano())
+	if err != nil {
+		return 0, errors.Wrap(err, "could not delete old locks")
+	}
+
+	n, err := result.RowsAffected()
+	return int(n), errors.Wrap(err, "could not delete old locks")
+}
+
+func (c *sqlt) FindInvite(code string) (*model.Invite, error) {
+	invite, err := scanInvite(c.db.QueryRow(selectFrom("invites", inviteColumns)+" WHERE code = ?", code))
+	return invite, errors.Wrap(err, "could not find invite")
+}
+
+func (c *sqlt) FindAuditEventsByUserID(userID string, limit int) ([]*model.AuditEvent, error) {
+	query := selectFrom("audit_events", auditColumns) + " WHERE user_id = ? ORDER BY created_at DESC"
+	args := []any{userID}
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not find audit events by user id")
+	}
+	defer rows.Close()
+
+	events := make([]*model.AuditEvent, 0)
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not find audit events by user id")
+		}
+		events = append(events, event)
+	}
+	return events, errors.Wrap(rows.Err(), "could not find audit events by user id")
+}
+
+func (c *sqlt) DeleteAuditEventsBefore(t time.Time) (int, error) {
+	result, err := c.db.Exec("DELETE FROM audit_events WHERE created_at < ?", t.UnixNano())
+	if err != nil {
+		return 0, errors.Wrap(err, "could not delete old audit events")
+	}
+
+	n, err := result.RowsAffected()
+	return int(n), errors.Wrap(err, "could not delete old audit events")
+}
+
+func (c *sqlt) FindPKCE(codeChallenge string) (*model.PKCE, error) {
+	pkce, err := scanPKCE(c.db.QueryRow(selectFrom("pkces", pkceColumns)+" WHERE code_challenge = ?", codeChallenge))
+	return pkce, errors.Wrap(err, "could not find pkce")
+}
+
+func (c *sqlt) RevokeExpiredChallenges() (int, error) {
+	result, err := c.db.Exec("DELETE FROM pkces WHERE expire_at <= ?", time.Now().UnixNano())
+	if err != nil {
+		return 0, errors.Wrap(err, "could not delete expired challenges")
+	}
+
+	n, err := result.RowsAffected()
+	return int(n), errors.Wrap(err, "could not delete expired challenges")
+}
+
+func (c *sqlt) RemovePKCE(codeChallenge string) error {
+	err := c.exec(true, "DELETE FROM pkces WHERE code_challenge = ?", codeChallenge)
+	return errors.Wrap(err, "Could not delete challenge")
+}
+
+//
+// Helpers
+//
+
+// exec executes the given statement.
+// When mustAffect is true, sql.ErrNoRows is returned if no rows are affected like Storm does.
+func (c *sqlt) exec(mustAffect bool, query string, args ...any) error {
+	result, err := c.db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+
+	if !mustAffect {
+		return nil
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (c *sqlt) upsert(table string, columns []string, values []any) error {
+	_, err := c.db.Exec(upsertQuery(table, columns), values...)
+	return err
+}
+
+// upsertQuery returns the query inserting or updating a record of the given table.
+func upsertQuery(table string, columns []string) string {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+
+	updates := make([]string, 0, len(columns)-1)
+	for _, column := range columns[1:] { // Skip primary key
+		updates = append(updates, column+" = excluded."+column)
+	}
+
+	return "INSERT INTO " + table + " (" + strings.Join(columns, ", ") + ") VALUES (" + placeholders + ")" +
+		" ON CONFLICT (id) DO UPDATE SET " + strings.Join(updates, ", ")
+}
+
+func (c *sqlt) ids(query string, args ...any) ([]string, error) {
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]string, 0)
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (c *sqlt) sessions(query string, args ...any) ([]*model.Session, error) {
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make([]*model.Session, 0)
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func (c *sqlt) items(query string, args ...any) ([]*model.Item, error) {
+	return sqliteItems(c.db, query, args...)
+}
+
+func sqliteItems(db sqliteQuerier, query string, args ...any) ([]*model.Item, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]*model.Item, 0)
+	for rows.Next() {
+		item, err := scanItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// sqliteItemsQuery returns the conditions of the items for the given parameters and their arguments.
+func sqliteItemsForIntegrityCheck(db sqliteQuerier, userID string) ([]*model.Item, error) {
+	items, err := sqliteItems(db, selectFrom("items", itemColumns)+" WHERE user_id = ? AND deleted = 0 AND content_type IS NOT NULL", userID)
+	return items, errors.Wrap(err, "could not find items")
+}
+
+func sqliteItemsQuery(userID, contentType string, updated time.Time, strictTime, noDeleted bool) (string, []any) {
+	query := []string{"user_id = ?"}
+	args := []any{userID}
+
+	if !updated.IsZero() {
+		if strictTime {
+			query = append(query, "updated_at > ?")
+		} else {
+			query = append(query, "updated_at >= ?")
+		}
+		args = append(args, updated.UnixNano())
+	}
+
+	if contentType != "" {
+		query = append(query, "content_type = ?")
+		args = append(args, contentType)
+	}
+
+	if noDeleted {
+		query = append(query, "deleted = 0")
+	}
+
+	return strings.Join(query, " AND "), args
+}
+
+func sqliteTableOf(m model.Model) (*sqliteTable, error) {
+	t, ok := sqliteTables[reflect.TypeOf(m)]
+	if !ok {
+		return nil, errors.Errorf("unsupported model %T", m)
+	}
+	return t, nil
+}
+
+func selectFrom(table string, columns []string) string {
+	return "SELECT " + strings.Join(columns, ", ") + " FROM " + table
+}
+
+//
+// Mapping
+//
+
+func userValues(m *model.User) []any {
+	return []any{
+		m.ID, timeToSQL(m.CreatedAt), timeToSQL(m.UpdatedAt),
+		m.Email, m.Password, m.PasswordCost, m.PasswordNonce, m.PasswordAuth, m.Version, m.PasswordSalt, m.PasswordUpdatedAt,
+		m.MFASecret, stringsToSQL(m.MFARecoveryCodes), m.Disabled,
+	}
+}
+
+func scanUser(s scanner) (*model.User, error) {
+	var m model.User
+	var createdAt, updatedAt sql.NullInt64
+	var recoveryCodes string
+	err := s.Scan(
+		&m.ID, &createdAt, &updatedAt,
+		&m.Email, &m.Password, &m.PasswordCost, &m.PasswordNonce, &m.PasswordAuth, &m.Version, &m.PasswordSalt, &m.PasswordUpdatedAt,
+		&m.MFASecret, &recoveryCodes, &m.Disabled,
+	)
+	if err != nil {
+		return nil, err
+	}
+	m.CreatedAt, m.UpdatedAt = timeFromSQL(createdAt), timeFromSQL(updatedAt)
+	m.MFARecoveryCodes, err = stringsFromSQL(recoveryCodes)
+	return &m, err
+}
+
+func sessionValues(m *model.Session) []any {
+	return []any{
+		m.ID, timeToSQL(m.CreatedAt), timeToSQL(m.UpdatedAt),
+		m.ExpireAt.UnixNano(), m.UserID, m.UserAgent, m.APIVersion, m.AccessToken, m.RefreshToken,
+	}
+}
+
+func scanSession(s scanner) (*model.Session, error) {
+	var m model.Session
+	var createdAt, updatedAt sql.NullInt64
+	var expireAt int64
+	err := s.Scan(
+		&m.ID, &createdAt, &updatedAt,
+		&expireAt, &m.UserID, &m.UserAgent, &m.APIVersion, &m.AccessToken, &m.RefreshToken,
+	)
+	if err != nil {
+		return nil, err
+	}
+	m.CreatedAt, m.UpdatedAt = timeFromSQL(createdAt), timeFromSQL(updatedAt)
+	m.ExpireAt = time.Unix(0, expireAt).UTC()
+	return &m, nil
+}
+
+func itemValues(m *model.Item) []any {
+	return []any{
+		m.ID, timeToSQL(m.CreatedAt), timeToSQL(m.UpdatedAt),
+		m.UserID, m.ItemsKeyID, m.Content, m.ContentType, m.EncryptedItemKey, m.Deleted,
+	}
+}
+
+func scanItem(s scanner) (*model.Item, error) {
+	var m model.Item
+	var createdAt, updatedAt sql.NullInt64
+	err := s.Scan(
+		&m.ID, &createdAt, &updatedAt,
+		&m.UserID, &m.ItemsKeyID, &m.Content, &m.ContentType, &m.EncryptedItemKey, &m.Deleted,
+	)
+	if err != nil {
+		return nil, err
+	}
+	m.CreatedAt, m.UpdatedAt = timeFromSQL(createdAt), timeFromSQL(updatedAt)
+	return &m, nil
+}
+
+func revisionValues(m *model.Revision) []any {
+	return []any{
+		m.ID, timeToSQL(m.CreatedAt), timeToSQL(m.UpdatedAt),
+		m.ItemID, m.UserID, m.ItemsKeyID, m.Content, m.ContentType, m.EncryptedItemKey, timeToSQL(m.ItemUpdatedAt),
+	}
+}
+
+func scanRevision(s scanner) (*model.Revision, error) {
+	var m model.Revision
+	var createdAt, updatedAt, itemUpdatedAt sql.NullInt64
+	err := s.Scan(
+		&m.ID, &createdAt, &updatedAt,
+		&m.ItemID, &m.UserID, &m.ItemsKeyID, &m.Content, &m.ContentType, &m.EncryptedItemKey, &itemUpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	m.CreatedAt, m.UpdatedAt = timeFromSQL(createdAt), timeFromSQL(updatedAt)
+	m.ItemUpdatedAt = timeFromSQL(itemUpdatedAt)
+	return &m, nil
+}
+
+func settingValues(m *model.Setting) []any {
+	return []any{
+		m.ID, timeToSQL(m.CreatedAt), timeToSQL(m.UpdatedAt),
+		m.UserID, m.Name, m.Value, m.Sensitive, m.ServerEncryptionVersion,
+	}
+}
+
+func scanSetting(s scanner) (*model.Setting, error) {
+	var m model.Setting
+	var createdAt, updatedAt sql.NullInt64
+	err := s.Scan(
+		&m.ID, &createdAt, &updatedAt,
+		&m.UserID, &m.Name, &m.Value, &m.Sensitive, &m.ServerEncryptionVersion,
+	)
+	if err != nil {
+		return nil, err
+	}
+	m.CreatedAt, m.UpdatedAt = timeFromSQL(createdAt), timeFromSQL(updatedAt)
+	return &m, nil
+}
+
+func lockValues(m *model.Lock) []any {
+	return []any{
+		m.ID, timeToSQL(m.CreatedAt), timeToSQL(m.UpdatedAt),
+		m.Key, m.Attempts, m.LockedUntil.UnixNano(),
+	}
+}
+
+func scanLock(s scanner) (*model.Lock, error) {
+	var m model.Lock
+	var createdAt, updatedAt sql.NullInt64
+	var lockedUntil int64
+	err := s.Scan(
+		&m.ID, &createdAt, &updatedAt,
+		&m.Key, &m.Attempts, &lockedUntil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	m.CreatedAt, m.UpdatedAt = timeFromSQL(createdAt), timeFromSQL(updatedAt)
+	m.LockedUntil = time.Unix(0, lockedUntil).UTC()
+	return &m, nil
+}
+
+func inviteValues(m *model.Invite) []any {
+	return []any{
+		m.ID, timeToSQL(m.CreatedAt), timeToSQL(m.UpdatedAt),
+		m.Code, m.MaxUses, m.Uses, timeToSQL(m.ExpireAt),
+	}
+}
+
+func scanInvite(s scanner) (*model.Invite, error) {
+	var m model.Invite
+	var createdAt, updatedAt, expireAt sql.NullInt64
+	err := s.Scan(
+		&m.ID, &createdAt, &updatedAt,
+		&m.Code, &m.MaxUses, &m.Uses, &expireAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	m.CreatedAt, m.UpdatedAt = timeFromSQL(createdAt), timeFromSQL(updatedAt)
+	m.ExpireAt = timeFromSQL(expireAt)
+	return &m, nil
+}
+
+func pkceValues(m *model.PKCE) []any {
+	return []any{
+		m.ID, timeToSQL(m.CreatedAt), timeToSQL(m.UpdatedAt),
+		m.CodeChallenge, m.ExpireAt.UnixNano(),
+	}
+}
+
+func scanPKCE(s scanner) (*model.PKCE, error) {
+	var m model.PKCE
+	var createdAt, updatedAt sql.NullInt64
+	var expireAt int64
+	err := s.Scan(
+		&m.ID, &createdAt, &updatedAt,
+		&m.CodeChallenge, &expireAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	m.CreatedAt, m.UpdatedAt = timeFromSQL(createdAt), timeFromSQL(updatedAt)
+	m.ExpireAt = time.Unix(0, expireAt).UTC()
+	return &m, nil
+}
+
+func auditEventValues(m *model.AuditEvent) []any {
+	return []any{
+		m.ID, timeToSQL(m.CreatedAt), timeToSQL(m.UpdatedAt),
+		m.UserID, m.Type, m.IP, m.UserAgent, m.SessionID,
+	}
+}
+
+func scanAuditEvent(s scanner) (*model.AuditEvent, error) {
+	var m model.AuditEvent
+	var createdAt, updatedAt sql.NullInt64
+	err := s.Scan(
+		&m.ID, &createdAt, &updatedAt,
+		&m.UserID, &m.Type, &m.IP, &m.UserAgent, &m.SessionID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	m.CreatedAt, m.UpdatedAt = timeFromSQL(createdAt), timeFromSQL(updatedAt)
+	return &m, nil
+}
+
+// nilable avoids returning a typed nil pointer wrapped in a non-nil model.Model.
+func nilable[T model.Model](m T, err error) (model.Model, error) {
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// timeToSQL stores times as Unix nanoseconds to keep the precision used by sync tokens.
+func timeToSQL(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UnixNano()
+}
+
+// stringsToSQL stores string slices as JSON arrays.
+func stringsToSQL(v []string) string {
+	if len(v) == 0 {
+		return ""
+	}
+
+	payload, _ := json.Marshal(v) // Marshaling strings never fails
+	return string(payload)
+}
+
+func stringsFromSQL(v string) ([]string, error) {
+	if v == "" {
+		return nil, nil
+	}
+
+	var s []string
+	err := json.Unmarshal([]byte(v), &s)
+	return s, err
+}
+
+func timeFromSQL(v sql.NullInt64) *time.Time {
+	if !v.Valid {
+		return nil
+	}
+	t := time.Unix(0, v.Int64).UTC()
+	return &t
+}
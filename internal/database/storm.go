@@ -1,58 +1,288 @@
 package database
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
 	"time"
 
 	"github.com/asdine/storm/v3"
+	"github.com/asdine/storm/v3/codec"
 	"github.com/asdine/storm/v3/codec/msgpack"
+	"github.com/asdine/storm/v3/index"
 	"github.com/asdine/storm/v3/q"
 	"github.com/gofrs/uuid"
 	"github.com/mdouchement/standardfile/internal/model"
+	"github.com/mdouchement/standardfile/pkg/stormbinc"
+	"github.com/mdouchement/standardfile/pkg/stormcbor"
 	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+	bolterrors "go.etcd.io/bbolt/errors"
 )
 
-type strm struct {
-	db *storm.DB
-}
+type (
+	strm struct {
+		db *storm.DB
+	}
 
-// StormCodec is the format used to store data in the database.
-var StormCodec = storm.Codec(msgpack.Codec)
+	// strmSnapshot reads the records from a read transaction.
+	strmSnapshot struct {
+		node storm.Node
+	}
+)
+
+var (
+	// StormCodecs are the formats that can be used to store the records, by name.
+	StormCodecs = map[string]codec.MarshalUnmarshaler{
+		msgpack.Codec.Name():   msgpack.Codec,
+		stormcbor.Codec.Name(): stormcbor.Codec,
+		stormbinc.Codec.Name(): stormbinc.Codec,
+	}
+
+	// StormCodec is the format used to store the records.
+	// It is recorded when the database is created and must match on each opening.
+	StormCodec codec.MarshalUnmarshaler = msgpack.Codec
+)
 
 // StormInit initializes Storm database.
 func StormInit(database string) error {
-	db, err := storm.Open(database, StormCodec)
+	db, err := stormOpen(database, StormCodec)
 	if err != nil {
-		return errors.Wrap(err, "could not get database connection")
+		return err
 	}
 
 	if err := db.Init(&model.User{}); err != nil {
 		return errors.Wrap(err, "could not init user index")
 	}
 
-	err = db.Init(&model.Item{})
-	return errors.Wrap(err, "could not init item index")
+	if err := db.Init(&model.Item{}); err != nil {
+		return errors.Wrap(err, "could not init item index")
+	}
+
+	if err := db.Init(&model.Revision{}); err != nil {
+		return errors.Wrap(err, "could not init revision index")
+	}
+
+	if err := db.Init(&model.Setting{}); err != nil {
+		return errors.Wrap(err, "could not init setting index")
+	}
+
+	if err := db.Init(&model.Lock{}); err != nil {
+		return errors.Wrap(err, "could not init lock index")
+	}
+
+	if err := db.Init(&model.Invite{}); err != nil {
+		return errors.Wrap(err, "could not init invite index")
+	}
+
+	err = db.Init(&model.AuditEvent{})
+	return errors.Wrap(err, "could not init audit event index")
 }
 
 // StormReIndex reindex Storm database.
 func StormReIndex(database string) error {
-	db, err := storm.Open(database, StormCodec)
+	db, err := stormOpen(database, StormCodec)
 	if err != nil {
-		return errors.Wrap(err, "could not get database connection")
+		return err
 	}
 
 	if err := db.ReIndex(&model.User{}); err != nil {
 		return errors.Wrap(err, "could not ReIndex users")
 	}
 
-	err = db.ReIndex(&model.Item{})
-	return errors.Wrap(err, "could not ReIndex items")
+	if err := db.ReIndex(&model.Item{}); err != nil {
+		return errors.Wrap(err, "could not ReIndex items")
+	}
+
+	if err := db.ReIndex(&model.Revision{}); err != nil {
+		return errors.Wrap(err, "could not ReIndex revisions")
+	}
+
+	if err := db.ReIndex(&model.Setting{}); err != nil {
+		return errors.Wrap(err, "could not ReIndex settings")
+	}
+
+	if err := db.ReIndex(&model.Lock{}); err != nil {
+		return errors.Wrap(err, "could not ReIndex locks")
+	}
+
+	if err := db.ReIndex(&model.Invite{}); err != nil {
+		return errors.Wrap(err, "could not ReIndex invites")
+	}
+
+	err = db.ReIndex(&model.AuditEvent{})
+	return errors.Wrap(err, "could not ReIndex audit events")
+}
+
+// StormCompact rewrites the Storm database to a fresh file and swaps them, the free pages are not copied.
+func StormCompact(database string) error {
+	// Bolt locks the file so the database can't be compacted while it is used by the server.
+	src, err := bolt.Open(database, 0o600, &bolt.Options{ReadOnly: true, Timeout: stormLockTimeout})
+	if err != nil {
+		return stormLockError(err)
+	}
+	defer src.Close()
+
+	tmp := database + ".compact"
+	if err = os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "could not remove previous compaction")
+	}
+
+	dst, err := bolt.Open(tmp, 0o600, &bolt.Options{Timeout: stormLockTimeout})
+	if err != nil {
+		return errors.Wrap(err, "could not create compacted database")
+	}
+
+	if err = bolt.Compact(dst, src, 64<<20); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return errors.Wrap(err, "could not compact database")
+	}
+	if err = dst.Close(); err != nil {
+		os.Remove(tmp)
+		return errors.Wrap(err, "could not close compacted database")
+	}
+
+	err = os.Rename(tmp, database)
+	return errors.Wrap(err, "could not swap compacted database")
+}
+
+// StormCheck walks every bucket of the Storm database, verifies the indexes and looks for orphaned records.
+// With repair, the orphaned records are deleted and the inconsistent indexes are rebuilt.
+func StormCheck(database string, repair bool) (*CheckReport, error) {
+	db, err := stormOpen(database, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	report := &CheckReport{Orphans: map[string][]string{}}
+	var inconsistent []model.Model
+	var orphans []model.Model
+
+	err = db.Bolt.View(func(tx *bolt.Tx) error {
+		for err := range tx.Check() {
+			report.Problems = append(report.Problems, err.Error())
+		}
+
+		users := map[string]bool{}
+		err := stormEach(tx, db.Codec(), &model.User{}, func(id []byte, _ model.Model) error {
+			users[string(id)] = true
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, kind := range stormKinds {
+			problems, err := stormCheckIndexes(tx, db.Codec(), kind)
+			if err != nil {
+				return err
+			}
+			if len(problems) > 0 {
+				report.Problems = append(report.Problems, problems...)
+				inconsistent = append(inconsistent, kind)
+			}
+		}
+
+		for table, kind := range stormUserKinds {
+			err := stormEach(tx, db.Codec(), kind, func(id []byte, m model.Model) error {
+				if userID := reflect.ValueOf(m).Elem().FieldByName("UserID").String(); !users[userID] {
+					report.Orphans[table] = append(report.Orphans[table], string(id))
+					orphans = append(orphans, m)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "could not check database")
+	}
+
+	if !repair || (len(inconsistent) == 0 && len(orphans) == 0) {
+		return report, nil
+	}
+
+	for _, m := range orphans {
+		if err = db.DeleteStruct(m); err != nil {
+			return report, errors.Wrapf(err, "could not delete orphaned %s", stormBucket(m))
+		}
+	}
+	for _, kind := range inconsistent {
+		if err = db.ReIndex(kind); err != nil {
+			return report, errors.Wrapf(err, "could not ReIndex %s", stormBucket(kind))
+		}
+	}
+
+	report.Repaired = true
+	return report, nil
+}
+
+// StormRecodec rewrites all the records of the Storm database with the given codec.
+// The database is swapped with the rewritten one unless an output file is given.
+func StormRecodec(database string, to codec.MarshalUnmarshaler, output string) error {
+	src, err := stormOpen(database, nil)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	filename := output
+	if filename == "" {
+		filename = database + ".recodec"
+		if err = os.Remove(filename); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "could not remove previous recodec")
+		}
+	}
+
+	// The file is created here so an existing one is neither overwritten nor removed on error.
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return errors.Wrap(err, "could not create recoded database")
+	}
+	f.Close()
+
+	if err = stormRecodecTo(src, filename, to); err != nil {
+		os.Remove(filename)
+		return err
+	}
+	if output != "" {
+		return nil
+	}
+
+	err = os.Rename(filename, database)
+	return errors.Wrap(err, "could not swap recoded database")
+}
+
+// stormRecodecTo copies all the records of src to the given empty database with the given codec.
+func stormRecodecTo(src *storm.DB, filename string, to codec.MarshalUnmarshaler) error {
+	dst, err := stormOpen(filename, to)
+	if err != nil {
+		return err
+	}
+
+	for _, kind := range stormKinds {
+		if err = stormCopy(src, dst, kind); err != nil {
+			dst.Close()
+			return errors.Wrapf(err, "could not recodec %s", stormBucket(kind))
+		}
+	}
+
+	return errors.Wrap(dst.Close(), "could not close recoded database")
 }
 
 // StormOpen returns a new Storm database connection.
 func StormOpen(database string) (Client, error) {
-	db, err := storm.Open(database, StormCodec)
+	db, err := stormOpen(database, StormCodec)
 	if err != nil {
-		return nil, errors.Wrap(err, "could not get database connection")
+		return nil, err
 	}
 
 	return &strm{
@@ -76,6 +306,48 @@ func (c *strm) Delete(m model.Model) error {
 	return errors.Wrap(c.db.DeleteStruct(m), "could not delete the model")
 }
 
+func (c *strm) Import(m model.Model) error {
+	return errors.Wrap(c.db.Save(m), "could not import the model")
+}
+
+func (c *strm) ImportAll(next func() (model.Model, error)) error {
+	tx, err := c.db.Begin(true)
+	if err != nil {
+		return errors.Wrap(err, "could not begin transaction")
+	}
+	defer tx.Rollback()
+
+	for {
+		m, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if err = tx.Save(m); err != nil {
+			return errors.Wrap(err, "could not import the model")
+		}
+	}
+
+	return errors.Wrap(tx.Commit(), "could not commit transaction")
+}
+
+func (c *strm) ForEach(kind model.Model, fn func(m model.Model) error) error {
+	return stormForEach(c.db, kind, fn)
+}
+
+func (c *strm) View(fn func(s Snapshot) error) error {
+	tx, err := c.db.Begin(false)
+	if err != nil {
+		return errors.Wrap(err, "could not begin transaction")
+	}
+	defer tx.Rollback()
+
+	return fn(&strmSnapshot{node: tx})
+}
+
 func (c *strm) Close() error {
 	return c.db.Close()
 }
@@ -88,6 +360,46 @@ func (c *strm) IsAlreadyExists(err error) bool {
 	return errors.Cause(err) == storm.ErrAlreadyExists
 }
 
+func (c *strm) Stats() (Stats, error) {
+	var stats Stats
+	err := c.db.Bolt.View(func(tx *bolt.Tx) error {
+		stats.Size = tx.Size()
+		return nil
+	})
+	if err != nil {
+		return stats, errors.Wrap(err, "could not read database")
+	}
+
+	stats.FreePages = c.db.Bolt.Stats().FreePageN
+	return stats, nil
+}
+
+func (c *strm) Backup(w io.Writer) (int64, error) {
+	// The read transaction sees the database as it was when it began but it blocks the remapping of a growing database,
+	// so the snapshot is written in a temporary file before being copied to w (e.g. a slow client).
+	tmp, err := os.CreateTemp("", "standardfile-backup.*.db")
+	if err != nil {
+		return 0, errors.Wrap(err, "could not create backup file")
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	err = c.db.Bolt.View(func(tx *bolt.Tx) error {
+		_, err := tx.WriteTo(tmp)
+		return err
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "could not backup database")
+	}
+
+	if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		return 0, errors.Wrap(err, "could not read backup")
+	}
+
+	n, err := io.Copy(w, tmp)
+	return n, errors.Wrap(err, "could not write backup")
+}
+
 func (c *strm) FindUser(id string) (*model.User, error) {
 	var user model.User
 	if err := c.db.One("ID", id, &user); err != nil {
@@ -104,6 +416,37 @@ func (c *strm) FindUserByMail(email string) (*model.User, error) {
 	return &user, nil
 }
 
+func (c *strm) DeleteUser(id string) error {
+	tx, err := c.db.Begin(true)
+	if err != nil {
+		return errors.Wrap(err, "could not begin transaction")
+	}
+	defer tx.Rollback()
+
+	var user model.User
+	if err = tx.One("ID", id, &user); err != nil {
+		return errors.Wrap(err, "find user by id")
+	}
+
+	for _, kind := range stormUserKinds {
+		err = tx.Select(q.Eq("UserID", id)).Delete(kind)
+		if err != nil && !c.IsNotFound(err) {
+			return errors.Wrapf(err, "could not delete user's %T", kind)
+		}
+	}
+
+	err = tx.Select(q.Lte("ExpireAt", time.Now().UTC())).Delete(&model.PKCE{})
+	if err != nil && !c.IsNotFound(err) {
+		return errors.Wrap(err, "could not delete expired challenges")
+	}
+
+	if err = tx.DeleteStruct(&user); err != nil {
+		return errors.Wrap(err, "could not delete user")
+	}
+
+	return errors.Wrap(tx.Commit(), "could not commit transaction")
+}
+
 func (c *strm) FindSession(id string) (*model.Session, error) {
 	var session model.Session
 	if err := c.db.One("ID", id, &session); err != nil {
@@ -157,6 +500,44 @@ func (c *strm) FindActiveSessionsByUserID(userID string) ([]*model.Session, erro
 	return sessions, nil
 }
 
+func (c *strm) CountActiveSessions() (int, error) {
+	n, err := c.db.Select(q.Gt("ExpireAt", time.Now())).Count(&model.Session{})
+	if err != nil && !c.IsNotFound(err) {
+		return 0, errors.Wrap(err, "could not count active sessions")
+	}
+	return n, nil
+}
+
+func (c *strm) DeleteSessionsByUserID(userID string) (int, error) {
+	query := c.db.Select(q.Eq("UserID", userID))
+
+	n, err := query.Count(&model.Session{})
+	if err != nil || n == 0 {
+		return 0, errors.Wrap(err, "could not count sessions by user id")
+	}
+
+	err = query.Delete(&model.Session{})
+	if c.IsNotFound(err) {
+		return 0, nil
+	}
+	return n, errors.Wrap(err, "could not delete sessions by user id")
+}
+
+func (c *strm) DeleteSessionsExpiredBefore(t time.Time) (int, error) {
+	query := c.db.Select(q.Lte("ExpireAt", t.UTC()))
+
+	n, err := query.Count(&model.Session{})
+	if err != nil || n == 0 {
+		return 0, errors.Wrap(err, "could not count expired sessions")
+	}
+
+	err = query.Delete(&model.Session{})
+	if c.IsNotFound(err) {
+		return 0, nil
+	}
+	return n, errors.Wrap(err, "could not delete expired sessions")
+}
+
 func (c *strm) FindItem(id string) (*model.Item, error) {
 	var item model.Item
 	if err := c.db.One("ID", id, &item); err != nil {
@@ -172,23 +553,7 @@ func (c *strm) FindItemByUserID(id, userID string) (*model.Item, error) {
 }
 
 func (c *strm) FindItemsByParams(userID, contentType string, updated time.Time, strictTime, noDeleted bool, limit int) ([]*model.Item, bool, error) {
-	query := []q.Matcher{q.Eq("UserID", userID)}
-
-	if !updated.IsZero() {
-		if strictTime {
-			query = append(query, q.Gt("UpdatedAt", updated))
-		} else {
-			query = append(query, q.Gte("UpdatedAt", updated))
-		}
-	}
-
-	if contentType != "" {
-		query = append(query, q.Eq("ContentType", contentType))
-	}
-
-	if noDeleted {
-		query = append(query, q.Eq("Deleted", false))
-	}
+	query := stormItemsQuery(userID, contentType, updated, strictTime, noDeleted)
 
 	items := make([]*model.Item, 0)
 	stmt := c.db.Select(query...).OrderBy("UpdatedAt").Reverse()
@@ -209,13 +574,95 @@ func (c *strm) FindItemsByParams(userID, contentType string, updated time.Time,
 	return items, overLimit, nil
 }
 
-func (c *strm) FindItemsForIntegrityCheck(userID string) ([]*model.Item, error) {
-	items := make([]*model.Item, 0)
-	err := c.db.Select(q.Eq("UserID", userID), q.Eq("Deleted", false), q.Not(q.Eq("ContentType", nil))).Find(&items)
-	if err != nil && !c.IsNotFound(err) {
-		return nil, errors.Wrap(err, "could not find items")
+func (c *strm) ForEachItemByParams(userID, contentType string, updated time.Time, strictTime, noDeleted bool, fn func(item *model.Item) error) error {
+	matcher := q.And(stormItemsQuery(userID, contentType, updated, strictTime, noDeleted)...)
+
+	// Only the keys of the user's items and their update date are kept to sort them.
+	// The items are then read by batches so no read transaction is held while fn runs,
+	// a long-running one prevents the database file from growing and blocks the writes.
+	type ref struct {
+		id        []byte
+		updatedAt time.Time
 	}
-	return items, nil
+	var refs []ref
+
+	err := c.db.Bolt.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(stormBucket(&model.Item{})))
+		if bucket == nil {
+			return nil
+		}
+
+		idx, err := index.NewListIndex(bucket, []byte(stormIndexPrefix+"UserID"))
+		if err == index.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		ids, err := idx.All([]byte(userID), nil)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			item, err := stormMatchItem(c.db.Codec(), bucket.Get(id), matcher)
+			if err != nil {
+				return errors.Wrapf(err, "could not read item %s", id)
+			}
+			if item != nil && item.UpdatedAt != nil {
+				refs = append(refs, ref{id: bytes.Clone(id), updatedAt: *item.UpdatedAt})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "could not iterate over items")
+	}
+
+	// Storm sorts the *time.Time by their encoded value which does not follow the chronological order.
+	sort.SliceStable(refs, func(i, j int) bool {
+		return refs[i].updatedAt.After(refs[j].updatedAt)
+	})
+
+	for len(refs) > 0 {
+		batch := refs[:min(stormItemsBatch, len(refs))]
+		refs = refs[len(batch):]
+
+		items := make([]*model.Item, 0, len(batch))
+		err = c.db.Bolt.View(func(tx *bolt.Tx) error {
+			bucket := tx.Bucket([]byte(stormBucket(&model.Item{})))
+			if bucket == nil {
+				return nil
+			}
+
+			for _, r := range batch {
+				// The item may have been deleted or updated since its key was read.
+				item, err := stormMatchItem(c.db.Codec(), bucket.Get(r.id), matcher)
+				if err != nil {
+					return errors.Wrapf(err, "could not read item %s", r.id)
+				}
+				if item != nil {
+					items = append(items, item)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return errors.Wrap(err, "could not iterate over items")
+		}
+
+		for _, item := range items {
+			if err = fn(item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *strm) FindItemsForIntegrityCheck(userID string) ([]*model.Item, error) {
+	return stormItemsForIntegrityCheck(c.db, userID)
 }
 
 func (c *strm) DeleteItem(id, userID string) error {
@@ -223,6 +670,150 @@ func (c *strm) DeleteItem(id, userID string) error {
 	return errors.Wrap(err, "could not delete item")
 }
 
+func (c *strm) ItemStatsByUserID(userID string) (ItemStats, error) {
+	var stats ItemStats
+	err := c.db.Select(q.Eq("UserID", userID)).Each(&model.Item{}, func(record any) error {
+		item := record.(*model.Item)
+		stats.Count++
+		if item.UpdatedAt != nil && (stats.UpdatedAt == nil || item.UpdatedAt.After(*stats.UpdatedAt)) {
+			stats.UpdatedAt = item.UpdatedAt
+		}
+		return nil
+	})
+	if err != nil && !c.IsNotFound(err) {
+		return ItemStats{}, errors.Wrap(err, "could not compute item stats")
+	}
+	return stats, nil
+}
+
+func (c *strm) FindRevisionsByItemID(itemID, userID string) ([]*model.Revision, error) {
+	revisions := make([]*model.Revision, 0)
+	err := c.db.Select(q.Eq("ItemID", itemID), q.Eq("UserID", userID)).Find(&revisions)
+	if err != nil && !c.IsNotFound(err) {
+		return nil, errors.Wrap(err, "could not find revisions by item id")
+	}
+
+	// Storm sorts the *time.Time by their encoded value which does not follow the chronological order.
+	sort.SliceStable(revisions, func(i, j int) bool {
+		return revisions[i].CreatedAt.After(*revisions[j].CreatedAt)
+	})
+	return revisions, nil
+}
+
+func (c *strm) FindRevisionByItemID(id, itemID, userID string) (*model.Revision, error) {
+	var revision model.Revision
+	err := c.db.Select(q.Eq("ID", id), q.Eq("ItemID", itemID), q.Eq("UserID", userID)).First(&revision)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not find revision by item id")
+	}
+	return &revision, nil
+}
+
+func (c *strm) DeleteRevisionsByItemID(itemID, userID string) error {
+	err := c.db.Select(q.Eq("ItemID", itemID), q.Eq("UserID", userID)).Delete(&model.Revision{})
+	if c.IsNotFound(err) {
+		return nil
+	}
+	return errors.Wrap(err, "could not delete revisions")
+}
+
+func (c *strm) DeleteRevisionsBefore(t time.Time) (int, error) {
+	query := c.db.Select(q.Lt("CreatedAt", t))
+
+	n, err := query.Count(&model.Revision{})
+	if err != nil || n == 0 {
+		return 0, errors.Wrap(err, "could not count old revisions")
+	}
+
+	err = query.Delete(&model.Revision{})
+	if c.IsNotFound(err) {
+		return 0, nil
+	}
+	return n, errors.Wrap(err, "could not delete old revisions")
+}
+
+func (c *strm) FindAuditEventsByUserID(userID string, limit int) ([]*model.AuditEvent, error) {
+	events := make([]*model.AuditEvent, 0)
+	err := c.db.Select(q.Eq("UserID", userID)).Find(&events)
+	if err != nil && !c.IsNotFound(err) {
+		return nil, errors.Wrap(err, "could not find audit events by user id")
+	}
+
+	// Storm sorts the *time.Time by their encoded value which does not follow the chronological order.
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].CreatedAt.After(*events[j].CreatedAt)
+	})
+
+	if limit > 0 && len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
+
+func (c *strm) DeleteAuditEventsBefore(t time.Time) (int, error) {
+	query := c.db.Select(q.Lt("CreatedAt", t))
+
+	n, err := query.Count(&model.AuditEvent{})
+	if err != nil || n == 0 {
+		return 0, errors.Wrap(err, "could not count old audit events")
+	}
+
+	err = query.Delete(&model.AuditEvent{})
+	if c.IsNotFound(err) {
+		return 0, nil
+	}
+	return n, errors.Wrap(err, "could not delete old audit events")
+}
+
+func (c *strm) FindSettingsByUserID(userID string) ([]*model.Setting, error) {
+	settings := make([]*model.Setting, 0)
+	err := c.db.Select(q.Eq("UserID", userID)).OrderBy("Name").Find(&settings)
+	if err != nil && !c.IsNotFound(err) {
+		return nil, errors.Wrap(err, "could not find settings by user id")
+	}
+	return settings, nil
+}
+
+func (c *strm) FindSettingByName(name, userID string) (*model.Setting, error) {
+	var setting model.Setting
+	err := c.db.Select(q.Eq("Name", name), q.Eq("UserID", userID)).First(&setting)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not find setting by name")
+	}
+	return &setting, nil
+}
+
+func (c *strm) FindLock(key string) (*model.Lock, error) {
+	var lock model.Lock
+	if err := c.db.One("Key", key, &lock); err != nil {
+		return nil, errors.Wrap(err, "could not find lock")
+	}
+	return &lock, nil
+}
+
+func (c *strm) DeleteLocksBefore(t time.Time) (int, error) {
+	query := c.db.Select(q.Lt("UpdatedAt", t))
+
+	n, err := query.Count(&model.Lock{})
+	if err != nil || n == 0 {
+		return 0, errors.Wrap(err, "could not count old locks")
+	}
+
+	err = query.Delete(&model.Lock{})
+	if c.IsNotFound(err) {
+		return 0, nil
+	}
+	return n, errors.Wrap(err, "could not delete old locks")
+}
+
+func (c *strm) FindInvite(code string) (*model.Invite, error) {
+	var invite model.Invite
+	if err := c.db.One("Code", code, &invite); err != nil {
+		return nil, errors.Wrap(err, "could not find invite")
+	}
+	return &invite, nil
+}
+
 func (c *strm) FindPKCE(codeChallenge string) (*model.PKCE, error) {
 	var pkce model.PKCE
 	err := c.db.Select(q.Eq("CodeChallenge", codeChallenge)).First(&pkce)
@@ -232,15 +823,381 @@ func (c *strm) FindPKCE(codeChallenge string) (*model.PKCE, error) {
 	return &pkce, nil
 }
 
-func (c *strm) RevokeExpiredChallenges() error {
-	err := c.db.Select(q.Lte("ExpireAt", time.Now().UTC())).Delete(&model.PKCE{})
+func (c *strm) RevokeExpiredChallenges() (int, error) {
+	query := c.db.Select(q.Lte("ExpireAt", time.Now().UTC()))
+
+	n, err := query.Count(&model.PKCE{})
+	if err != nil || n == 0 {
+		return 0, errors.Wrap(err, "could not count expired challenges")
+	}
+
+	err = query.Delete(&model.PKCE{})
 	if c.IsNotFound(err) {
-		return nil
+		return 0, nil
 	}
-	return errors.Wrap(err, "could not delete expired challenges")
+	return n, errors.Wrap(err, "could not delete expired challenges")
 }
 
 func (c *strm) RemovePKCE(codeChallenge string) error {
 	err := c.db.Select(q.Eq("CodeChallenge", codeChallenge)).Delete(&model.PKCE{})
 	return errors.Wrap(err, "Could not delete challenge")
 }
+
+//
+// Helpers
+//
+
+const (
+	// stormLockTimeout is the time waited for the lock of a database used by another process.
+	stormLockTimeout = time.Second
+	// stormIndexPrefix is the prefix of the index buckets of a record bucket.
+	stormIndexPrefix = "__storm_index_"
+	// stormIndexIDs is the bucket of a list index that references the key of each record.
+	stormIndexIDs = "storm__ids"
+	// stormInfoBucket is the bucket created by Storm in each database.
+	stormInfoBucket = "__storm_db"
+	// stormMetaBucket is the bucket where the codec of the database is recorded.
+	stormMetaBucket = "__standardfile"
+	stormCodecKey   = "codec"
+	// stormCopyBatch is the number of records saved per transaction when the records are copied.
+	stormCopyBatch = 1000
+	// stormItemsBatch is the number of items read per transaction when the items are iterated.
+	stormItemsBatch = 500
+)
+
+var (
+	// stormKinds are all the records stored in the database.
+	stormKinds = []model.Model{
+		&model.User{}, &model.Session{}, &model.Item{}, &model.Revision{}, &model.Setting{},
+		&model.Lock{}, &model.Invite{}, &model.PKCE{}, &model.AuditEvent{},
+	}
+	// stormUserKinds are the records that belong to a user, by table name.
+	stormUserKinds = map[string]model.Model{
+		"sessions":     &model.Session{},
+		"items":        &model.Item{},
+		"revisions":    &model.Revision{},
+		"settings":     &model.Setting{},
+		"audit_events": &model.AuditEvent{},
+	}
+)
+
+// stormLockError explains the lock timeout of a database used by another process.
+func stormLockError(err error) error {
+	if errors.Is(err, bolterrors.ErrTimeout) {
+		return errors.New("the database is used by another process, stop the server first")
+	}
+	return errors.Wrap(err, "could not get database connection")
+}
+
+// stormBucket returns the name of the bucket of the given kind.
+func stormBucket(kind model.Model) string {
+	return reflect.TypeOf(kind).Elem().Name()
+}
+
+// stormItemsQuery returns the matchers of the items for the given parameters.
+func stormItemsQuery(userID, contentType string, updated time.Time, strictTime, noDeleted bool) []q.Matcher {
+	query := []q.Matcher{q.Eq("UserID", userID)}
+
+	if !updated.IsZero() {
+		if strictTime {
+			query = append(query, q.Gt("UpdatedAt", updated))
+		} else {
+			query = append(query, q.Gte("UpdatedAt", updated))
+		}
+	}
+
+	if contentType != "" {
+		query = append(query, q.Eq("ContentType", contentType))
+	}
+
+	if noDeleted {
+		query = append(query, q.Eq("Deleted", false))
+	}
+
+	return query
+}
+
+func (s *strmSnapshot) ForEach(kind model.Model, fn func(m model.Model) error) error {
+	return stormForEach(s.node, kind, fn)
+}
+
+func (s *strmSnapshot) FindItemsForIntegrityCheck(userID string) ([]*model.Item, error) {
+	return stormItemsForIntegrityCheck(s.node, userID)
+}
+
+func stormForEach(node storm.Node, kind model.Model, fn func(m model.Model) error) error {
+	return node.Select().Each(kind, func(record any) error {
+		return fn(record.(model.Model))
+	})
+}
+
+func stormItemsForIntegrityCheck(node storm.Node, userID string) ([]*model.Item, error) {
+	items := make([]*model.Item, 0)
+	err := node.Select(q.Eq("UserID", userID), q.Eq("Deleted", false), q.Not(q.Eq("ContentType", nil))).Find(&items)
+	if err != nil && errors.Cause(err) != storm.ErrNotFound {
+		return nil, errors.Wrap(err, "could not find items")
+	}
+	return items, nil
+}
+
+// stormMatchItem decodes the given item and returns it when it is matched, nil is returned for a missing item.
+func stormMatchItem(c codec.MarshalUnmarshaler, v []byte, matcher q.Matcher) (*model.Item, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	item := &model.Item{}
+	if err := c.Unmarshal(v, item); err != nil {
+		return nil, err
+	}
+
+	ok, err := matcher.Match(item)
+	if !ok || err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// stormEach decodes each record of the given kind, nested buckets are skipped.
+func stormEach(tx *bolt.Tx, c codec.MarshalUnmarshaler, kind model.Model, fn func(id []byte, m model.Model) error) error {
+	bucket := tx.Bucket([]byte(stormBucket(kind)))
+	if bucket == nil {
+		return nil
+	}
+
+	t := reflect.TypeOf(kind).Elem()
+	return bucket.ForEach(func(k, v []byte) error {
+		if v == nil {
+			return nil
+		}
+
+		m := reflect.New(t).Interface().(model.Model)
+		if err := c.Unmarshal(v, m); err != nil {
+			return errors.Wrapf(err, "could not decode %s %s", stormBucket(kind), k)
+		}
+		return fn(k, m)
+	})
+}
+
+// stormIndexes returns the indexed fields of the given type and their index kind (index or unique).
+func stormIndexes(t reflect.Type) map[string]string {
+	indexes := map[string]string{}
+	for i := range t.NumField() {
+		f := t.Field(i)
+		switch tag := f.Tag.Get("storm"); tag {
+		case "inline":
+			for name, kind := range stormIndexes(f.Type) {
+				indexes[name] = kind
+			}
+		case "index", "unique":
+			indexes[f.Name] = tag
+		}
+	}
+	return indexes
+}
+
+// stormIndexValue encodes the indexed value like Storm does.
+func stormIndexValue(c codec.MarshalUnmarshaler, v reflect.Value) ([]byte, error) {
+	if v.Kind() == reflect.String {
+		return []byte(v.String()), nil
+	}
+	return c.Marshal(v.Interface())
+}
+
+// stormCheckIndexes verifies that each record is referenced by its indexes and that the indexes do not reference other records.
+func stormCheckIndexes(tx *bolt.Tx, c codec.MarshalUnmarshaler, kind model.Model) ([]string, error) {
+	bucket := tx.Bucket([]byte(stormBucket(kind)))
+	if bucket == nil {
+		return nil, nil
+	}
+
+	var problems []string
+	for field, index := range stormIndexes(reflect.TypeOf(kind).Elem()) {
+		name := stormBucket(kind) + "." + field
+		idx := bucket.Bucket([]byte(stormIndexPrefix + field))
+		if idx == nil {
+			problems = append(problems, fmt.Sprintf("%s: missing index", name))
+			continue
+		}
+
+		ids := idx.Bucket([]byte(stormIndexIDs))
+		if index == "index" && ids == nil {
+			problems = append(problems, fmt.Sprintf("%s: missing index", name))
+			continue
+		}
+
+		var indexed int
+		err := stormEach(tx, c, kind, func(id []byte, m model.Model) error {
+			v := reflect.ValueOf(m).Elem().FieldByName(field)
+			if v.IsZero() {
+				// Zero values are not indexed.
+				if index == "index" && ids.Get(id) != nil {
+					problems = append(problems, fmt.Sprintf("%s: %s is indexed with a zero value", name, id))
+				}
+				return nil
+			}
+			indexed++
+
+			value, err := stormIndexValue(c, v)
+			if err != nil {
+				return errors.Wrapf(err, "could not encode %s", name)
+			}
+
+			key := value
+			if index == "index" {
+				key = append(append(value, '_', '_'), id...)
+				if !bytes.Equal(ids.Get(id), key) {
+					problems = append(problems, fmt.Sprintf("%s: %s is not referenced by its value", name, id))
+					return nil
+				}
+			}
+
+			if !bytes.Equal(idx.Get(key), id) {
+				problems = append(problems, fmt.Sprintf("%s: %s is not indexed", name, id))
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// Entries left by deleted or updated records.
+		entries := stormCountKeys(idx)
+		if index == "index" {
+			if n := stormCountKeys(ids); n != entries {
+				problems = append(problems, fmt.Sprintf("%s: %d values for %d references", name, entries, n))
+			}
+		}
+		if entries != indexed {
+			problems = append(problems, fmt.Sprintf("%s: %d entries for %d records", name, entries, indexed))
+		}
+	}
+
+	sort.Strings(problems)
+	return problems, nil
+}
+
+// stormCountKeys returns the number of keys of the given bucket, nested buckets excluded.
+func stormCountKeys(bucket *bolt.Bucket) (n int) {
+	bucket.ForEach(func(_, v []byte) error {
+		if v != nil {
+			n++
+		}
+		return nil
+	})
+	return n
+}
+
+// stormOpen opens the database with the given codec, nil means the codec the database was created with.
+func stormOpen(database string, c codec.MarshalUnmarshaler) (*storm.DB, error) {
+	bdb, err := bolt.Open(database, 0o600, &bolt.Options{Timeout: stormLockTimeout})
+	if err != nil {
+		return nil, stormLockError(err)
+	}
+
+	recorded, err := stormRecordCodec(bdb, c)
+	if err != nil {
+		bdb.Close()
+		return nil, err
+	}
+
+	if c == nil {
+		c = recorded
+	}
+	if c.Name() != recorded.Name() {
+		bdb.Close()
+		return nil, errors.Errorf("the database is encoded with %s instead of %s, it can be converted with the recodec command", recorded.Name(), c.Name())
+	}
+
+	db, err := storm.Open(database, storm.UseDB(bdb), storm.Codec(c))
+	if err != nil {
+		bdb.Close()
+		return nil, errors.Wrap(err, "could not get database connection")
+	}
+	return db, nil
+}
+
+// stormRecordCodec returns the codec of the database, it is recorded with the given one on creation.
+// The databases created before the codec was recorded use msgpack.
+func stormRecordCodec(bdb *bolt.DB, c codec.MarshalUnmarshaler) (recorded codec.MarshalUnmarshaler, err error) {
+	err = bdb.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(stormMetaBucket))
+		if err != nil {
+			return err
+		}
+
+		name := string(bucket.Get([]byte(stormCodecKey)))
+		if name == "" {
+			switch {
+			case tx.Bucket([]byte(stormInfoBucket)) != nil:
+				name = msgpack.Codec.Name()
+			case c != nil:
+				name = c.Name()
+			default:
+				name = StormCodec.Name()
+			}
+
+			if err = bucket.Put([]byte(stormCodecKey), []byte(name)); err != nil {
+				return err
+			}
+		}
+
+		var ok bool
+		if recorded, ok = StormCodecs[name]; !ok {
+			return errors.Errorf("unsupported codec: %s", name)
+		}
+		return nil
+	})
+	return recorded, errors.Wrap(err, "could not read database codec")
+}
+
+// stormCopy saves all the records of the given kind from src to dst, in batches.
+func stormCopy(src, dst *storm.DB, kind model.Model) error {
+	if err := dst.Init(kind); err != nil {
+		return err
+	}
+
+	var tx storm.Node
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var n int
+	err := src.Select().Each(kind, func(record any) (err error) {
+		if tx == nil {
+			if tx, err = dst.Begin(true); err != nil {
+				return err
+			}
+		}
+
+		// The indexed times are encoded with their location by some codecs.
+		m := record.(model.Model)
+		if t := m.GetCreatedAt(); t != nil {
+			m.SetCreatedAt(t.UTC())
+		}
+		if t := m.GetUpdatedAt(); t != nil {
+			m.SetUpdatedAt(t.UTC())
+		}
+
+		if err = tx.Save(m); err != nil {
+			return err
+		}
+
+		if n++; n%stormCopyBatch == 0 {
+			err = tx.Commit()
+			tx = nil
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if tx != nil {
+		err = tx.Commit()
+		tx = nil
+	}
+	return err
+}
@@ -0,0 +1,277 @@
+// Package dump implements a logical export and import of the database.
+//
+// A dump is a stream of JSON Lines where each line is a record envelope:
+//
+//	{"kind":"header","data":{"version":1,...}}
+//	{"kind":"user","data":{...}}
+//	{"kind":"item","data":{...}}
+//	{"kind":"footer","data":{"counts":{...},"signatures":{...}}}
+//
+// It does not depend on the database driver so it can be used to move data between backends.
+package dump
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/mdouchement/standardfile/internal/database"
+	"github.com/mdouchement/standardfile/internal/model"
+	"github.com/pkg/errors"
+)
+
+// Version is the current version of the dump format.
+const Version = 1
+
+const (
+	kindHeader = "header"
+	kindFooter = "footer"
+)
+
+type (
+	// A Header describes a dump.
+	Header struct {
+		Version   int       `json:"version"`
+		Generator string    `json:"generator"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+
+	// A Footer contains the values used to verify a restored database.
+	Footer struct {
+		// Counts is the number of records per kind.
+		Counts map[string]int `json:"counts"`
+		// Signatures are the integrity hashes of the items per user ID.
+		Signatures map[string]string `json:"signatures"`
+	}
+
+	record struct {
+		Kind string          `json:"kind"`
+		Data json.RawMessage `json:"data"`
+	}
+
+	kind struct {
+		name string
+		new  func() model.Model
+	}
+)
+
+// kinds lists all the dumped records in restoration order.
+var kinds = []kind{
+	{name: "user", new: func() model.Model { return &model.User{} }},
+	{name: "session", new: func() model.Model { return &model.Session{} }},
+	{name: "item", new: func() model.Model { return &model.Item{} }},
+	{name: "revision", new: func() model.Model { return &model.Revision{} }},
+	{name: "setting", new: func() model.Model { return &model.Setting{} }},
+	{name: "lock", new: func() model.Model { return &model.Lock{} }},
+	{name: "invite", new: func() model.Model { return &model.Invite{} }},
+	{name: "audit_event", new: func() model.Model { return &model.AuditEvent{} }},
+	{name: "pkce", new: func() model.Model { return &model.PKCE{} }},
+}
+
+var errStop = errors.New("stop iteration")
+
+// Dump writes all the records of db into w.
+func Dump(db database.Client, w io.Writer, generator string) (*Footer, error) {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+
+	err := write(enc, kindHeader, Header{
+		Version:   Version,
+		Generator: generator,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	footer := &Footer{
+		Counts:     map[string]int{},
+		Signatures: map[string]string{},
+	}
+
+	// The records and the signatures are read from the same snapshot so the footer matches the dumped records
+	// even if the database is modified meanwhile (e.g. sqlite driver used by a running server).
+	err = db.View(func(s database.Snapshot) error {
+		var users []string
+		for _, k := range kinds {
+			footer.Counts[k.name] = 0
+
+			err := s.ForEach(k.new(), func(m model.Model) error {
+				if user, ok := m.(*model.User); ok {
+					users = append(users, user.ID)
+				}
+
+				footer.Counts[k.name]++
+				return write(enc, k.name, m)
+			})
+			if err != nil {
+				return errors.Wrapf(err, "could not dump %s records", k.name)
+			}
+		}
+
+		for _, id := range users {
+			signature, err := database.DataSignature(s, id)
+			if err != nil {
+				return errors.Wrap(err, "could not compute data signature")
+			}
+			footer.Signatures[id] = signature
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err = write(enc, kindFooter, footer); err != nil {
+		return nil, err
+	}
+
+	return footer, errors.Wrap(bw.Flush(), "could not write dump")
+}
+
+// Restore imports all the records read from r into db.
+// The database must be empty and it is verified against the dump's footer once restored.
+// The records are imported in a single transaction, committed once they have been counted against the footer.
+func Restore(db database.Client, r io.Reader) (*Footer, error) {
+	empty, err := IsEmpty(db)
+	if err != nil {
+		return nil, err
+	}
+	if !empty {
+		return nil, errors.New("the target database is not empty")
+	}
+
+	dec := json.NewDecoder(bufio.NewReader(r))
+
+	// Header
+	var rec record
+	if err = dec.Decode(&rec); err != nil {
+		return nil, errors.Wrap(err, "could not read dump header")
+	}
+	if rec.Kind != kindHeader {
+		return nil, errors.New("missing dump header")
+	}
+
+	var header Header
+	if err = json.Unmarshal(rec.Data, &header); err != nil {
+		return nil, errors.Wrap(err, "could not parse dump header")
+	}
+	if header.Version < 1 || header.Version > Version {
+		return nil, errors.Errorf("unsupported dump version %d", header.Version)
+	}
+
+	// Records
+	constructors := map[string]func() model.Model{}
+	for _, k := range kinds {
+		constructors[k.name] = k.new
+	}
+
+	var footer *Footer
+	counts := map[string]int{}
+	err = db.ImportAll(func() (model.Model, error) {
+		rec := record{}
+		if err := dec.Decode(&rec); err != nil {
+			if err == io.EOF {
+				return nil, errors.New("truncated dump: missing footer")
+			}
+			return nil, errors.Wrap(err, "could not read dump record")
+		}
+
+		if rec.Kind == kindFooter {
+			footer = &Footer{}
+			if err := json.Unmarshal(rec.Data, footer); err != nil {
+				return nil, errors.Wrap(err, "could not parse dump footer")
+			}
+			if err := checkCounts(counts, footer); err != nil {
+				return nil, err
+			}
+			return nil, io.EOF // Commits the restored records
+		}
+
+		constructor, ok := constructors[rec.Kind]
+		if !ok {
+			return nil, errors.Errorf("unknown record kind %q", rec.Kind)
+		}
+
+		m := constructor()
+		if err := json.Unmarshal(rec.Data, m); err != nil {
+			return nil, errors.Wrapf(err, "could not parse %s record", rec.Kind)
+		}
+
+		counts[rec.Kind]++
+		return m, nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "could not restore dump, nothing has been restored")
+	}
+
+	return footer, Verify(db, footer)
+}
+
+// Verify checks that db matches the given footer.
+func Verify(db database.Client, footer *Footer) error {
+	counts := map[string]int{}
+	for _, k := range kinds {
+		err := db.ForEach(k.new(), func(model.Model) error {
+			counts[k.name]++
+			return nil
+		})
+		if err != nil {
+			return errors.Wrapf(err, "could not count %s records", k.name)
+		}
+	}
+
+	if err := checkCounts(counts, footer); err != nil {
+		return err
+	}
+
+	for id, expected := range footer.Signatures {
+		signature, err := database.DataSignature(db, id)
+		if err != nil {
+			return errors.Wrap(err, "could not compute data signature")
+		}
+
+		if signature != expected {
+			return errors.Errorf("integrity hash mismatch for user %s", id)
+		}
+	}
+
+	return nil
+}
+
+// IsEmpty returns true if db does not contain any record.
+func IsEmpty(db database.Client) (bool, error) {
+	for _, k := range kinds {
+		err := db.ForEach(k.new(), func(model.Model) error {
+			return errStop
+		})
+		if err == errStop {
+			return false, nil
+		}
+		if err != nil {
+			return false, errors.Wrapf(err, "could not read %s records", k.name)
+		}
+	}
+
+	return true, nil
+}
+
+// checkCounts checks that the given counts of records per kind match the footer.
+func checkCounts(counts map[string]int, footer *Footer) error {
+	for _, k := range kinds {
+		if counts[k.name] != footer.Counts[k.name] {
+			return errors.Errorf("%s records mismatch: %d restored, %d expected", k.name, counts[k.name], footer.Counts[k.name])
+		}
+	}
+	return nil
+}
+
+func write(enc *json.Encoder, kind string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrapf(err, "could not encode %s record", kind)
+	}
+
+	return errors.Wrap(enc.Encode(record{Kind: kind, Data: data}), "could not write dump")
+}
@@ -0,0 +1,93 @@
+package dump_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mdouchement/standardfile/internal/database"
+	"github.com/mdouchement/standardfile/internal/dump"
+	"github.com/mdouchement/standardfile/internal/model"
+	"github.com/mdouchement/standardfile/pkg/libsf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDumpRestore(t *testing.T) {
+	dir, err := os.MkdirTemp("", "standardfile")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	src, err := database.Open(database.DriverStorm, filepath.Join(dir, "standardfile.db"))
+	assert.NoError(t, err)
+	defer src.Close()
+
+	user := model.NewUser()
+	user.Email = "george.abitbol@nowhere.lan"
+	assert.NoError(t, src.Save(user))
+	assert.NoError(t, src.Save(&model.Session{UserID: user.ID, ExpireAt: time.Now().Add(time.Hour)}))
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, src.Save(&model.Item{UserID: user.ID, ContentType: libsf.ContentTypeNote, Content: "003:..."}))
+	}
+
+	var buf bytes.Buffer
+	footer, err := dump.Dump(src, &buf, "test")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"user": 1, "session": 1, "item": 3, "revision": 0, "setting": 0, "lock": 0, "invite": 0, "audit_event": 0, "pkce": 0}, footer.Counts)
+	assert.Len(t, footer.Signatures, 1)
+	assert.Len(t, strings.Split(strings.TrimSpace(buf.String()), "\n"), 7)
+
+	//
+	// Restore into another backend.
+	//
+
+	dst, err := database.Open(database.DriverSQLite, filepath.Join(dir, "standardfile.sqlite"))
+	assert.NoError(t, err)
+	defer dst.Close()
+
+	restored, err := dump.Restore(dst, bytes.NewReader(buf.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, footer, restored)
+
+	v, err := dst.FindUserByMail(user.Email)
+	assert.NoError(t, err)
+	assert.Equal(t, user.ID, v.ID)
+	assert.True(t, user.UpdatedAt.Equal(*v.UpdatedAt))
+
+	_, err = dump.Restore(dst, bytes.NewReader(buf.Bytes()))
+	assert.EqualError(t, err, "the target database is not empty")
+
+	//
+	// Failed restores leave the target empty so they can be retried.
+	//
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	for _, driver := range []string{database.DriverStorm, database.DriverSQLite} {
+		empty, err := database.Open(driver, filepath.Join(dir, "empty."+driver))
+		assert.NoError(t, err)
+		defer empty.Close()
+
+		// Truncated dump
+		_, err = dump.Restore(empty, strings.NewReader(strings.Join(lines[:len(lines)-1], "\n")))
+		assert.EqualError(t, err, "could not restore dump, nothing has been restored: truncated dump: missing footer")
+
+		ok, err := dump.IsEmpty(empty)
+		assert.NoError(t, err)
+		assert.True(t, ok, driver)
+
+		// Missing record
+		_, err = dump.Restore(empty, strings.NewReader(strings.Join(append(lines[:2:2], lines[3:]...), "\n")))
+		assert.ErrorContains(t, err, "records mismatch")
+
+		ok, err = dump.IsEmpty(empty)
+		assert.NoError(t, err)
+		assert.True(t, ok, driver)
+
+		// Retry
+		restored, err := dump.Restore(empty, bytes.NewReader(buf.Bytes()))
+		assert.NoError(t, err)
+		assert.Equal(t, footer, restored)
+	}
+}
@@ -0,0 +1,31 @@
+package model
+
+// Audit event types.
+const (
+	AuditLogin            = "login"
+	AuditLoginFailed      = "login_failed"
+	AuditLogout           = "logout"
+	AuditPasswordChanged  = "password_changed"
+	AuditSessionRefreshed = "session_refreshed"
+	AuditSessionRevoked   = "session_revoked"
+	AuditSessionsRevoked  = "sessions_revoked"
+	AuditMFAEnabled       = "mfa_enabled"
+	AuditMFADisabled      = "mfa_disabled"
+	AuditMFARecoveryCodes = "mfa_recovery_codes_regenerated"
+	AuditAdminDisabled    = "admin_disabled"
+	AuditAdminEnabled     = "admin_enabled"
+	AuditAdminLogout      = "admin_logout"
+	AuditAdminDeleted     = "admin_deleted"
+)
+
+// An AuditEvent represents a database record of a security related event of an account.
+// Events are never updated, they are removed when they are older than the retention or with their user.
+type AuditEvent struct {
+	Base `msgpack:",inline" storm:"inline"`
+
+	UserID    string `msgpack:"user_id"              storm:"index"`
+	Type      string `msgpack:"type"`
+	IP        string `msgpack:"ip"`
+	UserAgent string `msgpack:"user_agent"`
+	SessionID string `msgpack:"session_id,omitempty"` // Session used or affected by the event
+}
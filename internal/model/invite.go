@@ -0,0 +1,20 @@
+package model
+
+import (
+	"time"
+)
+
+// An Invite represents a database record of a registration invite code.
+type Invite struct {
+	Base `msgpack:",inline" storm:"inline"`
+
+	Code     string     `json:"code"      msgpack:"code"      storm:"unique"`
+	MaxUses  int        `json:"max_uses"  msgpack:"max_uses"` // Number of registrations allowed with the code
+	Uses     int        `json:"uses"      msgpack:"uses"`
+	ExpireAt *time.Time `json:"expire_at" msgpack:"expire_at"` // nil means the code never expires
+}
+
+// IsUsable returns true if the invite can still be used to register at the given time.
+func (i *Invite) IsUsable(t time.Time) bool {
+	return i.Uses < i.MaxUses && (i.ExpireAt == nil || t.Before(*i.ExpireAt))
+}
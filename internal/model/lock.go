@@ -0,0 +1,14 @@
+package model
+
+import (
+	"time"
+)
+
+// A Lock represents a database record of the failed login attempts of an account or an IP address.
+type Lock struct {
+	Base `msgpack:",inline" storm:"inline"`
+
+	Key         string    `msgpack:"key"          storm:"unique"` // e.g. "email:george.abitbol@nowhere.lan" or "ip:127.0.0.1"
+	Attempts    int       `msgpack:"attempts"`
+	LockedUntil time.Time `msgpack:"locked_until"`
+}
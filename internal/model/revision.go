@@ -0,0 +1,31 @@
+package model
+
+import (
+	"time"
+)
+
+// A Revision represents a database record of a previous version of an item.
+type Revision struct {
+	Base `msgpack:",inline" storm:"inline"`
+
+	ItemID           string     `json:"item_uuid"       msgpack:"item_id"                 storm:"index"`
+	UserID           string     `json:"user_uuid"       msgpack:"user_id"                 storm:"index"`
+	ItemsKeyID       string     `json:"items_key_id"    msgpack:"items_key_id,omitempty"`
+	Content          string     `json:"content"         msgpack:"content"`
+	ContentType      string     `json:"content_type"    msgpack:"content_type"`
+	EncryptedItemKey string     `json:"enc_item_key"    msgpack:"enc_item_key"`
+	ItemUpdatedAt    *time.Time `json:"item_updated_at" msgpack:"item_updated_at"`
+}
+
+// NewRevision returns a new revision of the given item.
+func NewRevision(item *Item) *Revision {
+	return &Revision{
+		ItemID:           item.ID,
+		UserID:           item.UserID,
+		ItemsKeyID:       item.ItemsKeyID,
+		Content:          item.Content,
+		ContentType:      item.ContentType,
+		EncryptedItemKey: item.EncryptedItemKey,
+		ItemUpdatedAt:    item.UpdatedAt,
+	}
+}
@@ -0,0 +1,12 @@
+package model
+
+// A Setting represents a database record of a user setting.
+type Setting struct {
+	Base `msgpack:",inline" storm:"inline"`
+
+	UserID                  string `json:"user_uuid"                 msgpack:"user_id"                   storm:"index"`
+	Name                    string `json:"name"                      msgpack:"name"                      storm:"index"`
+	Value                   string `json:"value"                     msgpack:"value"`
+	Sensitive               bool   `json:"sensitive"                 msgpack:"sensitive"`
+	ServerEncryptionVersion int    `json:"server_encryption_version" msgpack:"server_encryption_version"`
+}
@@ -19,6 +19,11 @@ type User struct {
 
 	// Custom fields
 	PasswordUpdatedAt int64 `msgpack:"password_updated_at"`
+	Disabled          bool  `msgpack:"disabled,omitempty"` // Disabled accounts can't sign in
+
+	// Two-factor authentication
+	MFASecret        string   `msgpack:"mfa_secret,omitempty"`         // TOTP secret encrypted with the server's MFA key
+	MFARecoveryCodes []string `msgpack:"mfa_recovery_codes,omitempty"` // SHA256 hashes of the unused recovery codes
 }
 
 // NewUser returns a new user with default params.
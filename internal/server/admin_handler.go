@@ -0,0 +1,191 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mdouchement/standardfile/internal/database"
+	"github.com/mdouchement/standardfile/internal/model"
+	"github.com/mdouchement/standardfile/internal/server/service"
+	"github.com/mdouchement/standardfile/internal/sferror"
+)
+
+// admin contains all administration handlers.
+type admin struct {
+	db       database.Client
+	admin    service.AdminService
+	invites  service.InviteService
+	backups  service.BackupService
+	notifier service.Notifier
+	audits   service.AuditService
+}
+
+///// Users
+////
+//
+
+// Users lists all the users with their usage.
+func (h *admin) Users(c echo.Context) error {
+	users, err := h.admin.Users()
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, users)
+}
+
+// User shows a user with their usage.
+func (h *admin) User(c echo.Context) error {
+	user, err := h.admin.User(c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, user)
+}
+
+// Disable prevents a user from signing in and terminates all their sessions.
+func (h *admin) Disable(c echo.Context) error {
+	if err := h.admin.Disable(c.Param("id")); err != nil {
+		return err
+	}
+	h.notifier.Disconnect(c.Param("id"), "")
+	record(c, h.audits, model.AuditAdminDisabled, c.Param("id"), "")
+
+	return h.User(c)
+}
+
+// Enable allows a disabled user to sign in again.
+func (h *admin) Enable(c echo.Context) error {
+	if err := h.admin.Enable(c.Param("id")); err != nil {
+		return err
+	}
+	record(c, h.audits, model.AuditAdminEnabled, c.Param("id"), "")
+
+	return h.User(c)
+}
+
+// Logout terminates all the sessions of a user.
+func (h *admin) Logout(c echo.Context) error {
+	count, err := h.admin.Logout(c.Param("id"))
+	if err != nil {
+		return err
+	}
+	h.notifier.Disconnect(c.Param("id"), "")
+	record(c, h.audits, model.AuditAdminLogout, c.Param("id"), "")
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"count": count,
+	})
+}
+
+// Delete deletes a user with all their records and files.
+func (h *admin) Delete(c echo.Context) error {
+	if err := h.admin.Delete(c.Param("id")); err != nil {
+		return err
+	}
+	h.notifier.Disconnect(c.Param("id"), "")
+	// Kept until the retention as a trace of the deleted account.
+	record(c, h.audits, model.AuditAdminDeleted, c.Param("id"), "")
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+///// Storage
+////
+//
+
+// Storage shows the storage usage of the server.
+func (h *admin) Storage(c echo.Context) error {
+	storage, err := h.admin.Storage()
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, storage)
+}
+
+///// Backup
+////
+//
+
+// Backup streams a snapshot of the database, gzip-compressed with `?gzip=true`.
+func (h *admin) Backup(c echo.Context) error {
+	var compress bool
+	if v := c.QueryParam("gzip"); v != "" {
+		var err error
+		if compress, err = strconv.ParseBool(v); err != nil {
+			return c.JSON(http.StatusBadRequest, sferror.New("Invalid gzip."))
+		}
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, echo.MIMEOctetStream)
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", service.BackupFilename(time.Now(), compress)))
+	c.Response().WriteHeader(http.StatusOK)
+
+	if err := h.backups.Write(c.Response(), compress); err != nil {
+		logger(c).WithError(err).Error("could not backup database")
+		// The status is already sent, aborting the connection prevents the client from keeping a truncated backup.
+		panic(http.ErrAbortHandler)
+	}
+	return nil
+}
+
+///// Invites
+////
+//
+
+// Invites lists all the registration invites.
+func (h *admin) Invites(c echo.Context) error {
+	invites, err := h.invites.List()
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, invites)
+}
+
+// CreateInvite generates a registration invite.
+func (h *admin) CreateInvite(c echo.Context) error {
+	var params struct {
+		Uses int    `json:"uses"`
+		TTL  string `json:"ttl"` // Go duration, empty means no expiration
+	}
+	if err := c.Bind(&params); err != nil {
+		return c.JSON(http.StatusBadRequest, sferror.New("Could not get parameters."))
+	}
+
+	if params.Uses <= 0 {
+		params.Uses = 1
+	}
+
+	var ttl time.Duration
+	if params.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(params.TTL); err != nil || ttl < 0 {
+			return c.JSON(http.StatusBadRequest, sferror.New("Invalid ttl."))
+		}
+	}
+
+	invite, err := h.invites.Create(params.Uses, ttl)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, invite)
+}
+
+// RevokeInvite deletes a registration invite.
+func (h *admin) RevokeInvite(c echo.Context) error {
+	if err := h.invites.Revoke(c.Param("code")); err != nil {
+		if h.db.IsNotFound(err) {
+			return c.JSON(http.StatusNotFound, sferror.New("Invite not found."))
+		}
+		return err
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,251 @@
+package server_test
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/appleboy/gofight/v2"
+	"github.com/mdouchement/standardfile/internal/database"
+	"github.com/mdouchement/standardfile/internal/model"
+	"github.com/mdouchement/standardfile/internal/server"
+	"github.com/mdouchement/standardfile/pkg/libsf"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fastjson"
+)
+
+const adminToken = "0123456789abcdef0123456789abcdef"
+
+func TestRequestAdminDisabled(t *testing.T) {
+	engine, _, r, cleanup := setup()
+	defer cleanup()
+
+	// Unknown routes are handled by the session middleware.
+	r.GET("/admin/users").SetHeader(gofight.H{
+		"Authorization": "Bearer ",
+	}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusUnauthorized, r.Code)
+		assert.JSONEq(t, `{"error":{"tag":"invalid-auth","message":"Invalid login credentials."}}`, r.Body.String())
+	})
+}
+
+func TestRequestAdminUsers(t *testing.T) {
+	engine, ctrl, r, cleanup := setup()
+	defer cleanup()
+
+	ctrl.AdminToken = adminToken
+	engine = server.EchoEngine(ctrl)
+	header := gofight.H{
+		"Authorization": "Bearer " + adminToken,
+	}
+
+	user, session := createUserWithSession(ctrl)
+	assert.NoError(t, ctrl.Database.Save(&model.Item{UserID: user.ID, ContentType: libsf.ContentTypeNote}))
+
+	r.GET("/admin/users").SetHeader(gofight.H{
+		"Authorization": "Bearer " + accessToken(ctrl, session),
+	}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusUnauthorized, r.Code)
+		assert.JSONEq(t, `{"error":{"message":"Invalid admin token."}}`, r.Body.String())
+	})
+
+	r.GET("/admin/users").SetHeader(header).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+
+		v, err := fastjson.Parse(r.Body.String())
+		assert.NoError(t, err)
+
+		users := v.GetArray()
+		assert.Len(t, users, 1)
+		assert.Equal(t, user.ID, string(users[0].GetStringBytes("uuid")))
+		assert.Equal(t, user.Email, string(users[0].GetStringBytes("email")))
+		assert.Equal(t, 1, users[0].GetInt("items"))
+		assert.Equal(t, 1, users[0].GetInt("active_sessions"))
+		assert.False(t, users[0].GetBool("disabled"))
+		assert.NotEmpty(t, users[0].GetStringBytes("last_activity"))
+	})
+
+	r.GET("/admin/users/unknown").SetHeader(header).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusNotFound, r.Code)
+		assert.JSONEq(t, `{"error":{"message":"User not found."}}`, r.Body.String())
+	})
+
+	r.GET("/admin/storage").SetHeader(header).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+
+		v, err := fastjson.Parse(r.Body.String())
+		assert.NoError(t, err)
+		assert.Equal(t, 1, v.GetInt("users"))
+		assert.Equal(t, 1, v.GetInt("items"))
+		assert.Greater(t, v.GetInt64("database", "size"), int64(0))
+	})
+
+	//
+	// Disable
+	//
+
+	r.POST("/admin/users/"+user.ID+"/disable").SetHeader(header).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+
+		v, err := fastjson.Parse(r.Body.String())
+		assert.NoError(t, err)
+		assert.True(t, v.GetBool("disabled"))
+		assert.Equal(t, 0, v.GetInt("active_sessions"))
+	})
+
+	r.GET("/sessions").SetHeader(gofight.H{
+		"Authorization": "Bearer " + accessToken(ctrl, session),
+	}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusUnauthorized, r.Code)
+	})
+
+	login := gofight.D{
+		"api":      libsf.APIVersion20200115,
+		"email":    user.Email,
+		"password": "password42",
+	}
+	r.POST("/auth/sign_in").SetJSON(login).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusForbidden, r.Code)
+		assert.JSONEq(t, `{"error":{"tag":"account-disabled","message":"This account has been disabled."}}`, r.Body.String())
+	})
+
+	login["password"] = "wrong"
+	r.POST("/auth/sign_in").SetJSON(login).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusUnauthorized, r.Code)
+	})
+	login["password"] = "password42"
+
+	//
+	// Enable
+	//
+
+	r.POST("/admin/users/"+user.ID+"/enable").SetHeader(header).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+	})
+
+	r.POST("/auth/sign_in").SetJSON(login).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+	})
+
+	//
+	// Logout
+	//
+
+	r.DELETE("/admin/users/"+user.ID+"/sessions").SetHeader(header).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+		assert.JSONEq(t, `{"count":1}`, r.Body.String())
+	})
+
+	//
+	// Delete
+	//
+
+	r.DELETE("/admin/users/"+user.ID).SetHeader(header).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusNoContent, r.Code)
+	})
+
+	_, err := ctrl.Database.FindUser(user.ID)
+	assert.True(t, ctrl.Database.IsNotFound(err))
+
+	r.DELETE("/admin/users/"+user.ID).SetHeader(header).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusNotFound, r.Code)
+	})
+}
+
+func TestRequestAdminInvites(t *testing.T) {
+	engine, ctrl, r, cleanup := setup()
+	defer cleanup()
+
+	ctrl.AdminToken = adminToken
+	engine = server.EchoEngine(ctrl)
+	header := gofight.H{
+		"Authorization": "Bearer " + adminToken,
+	}
+
+	r.POST("/admin/invites").SetHeader(header).SetJSON(gofight.D{
+		"ttl": "nope",
+	}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusBadRequest, r.Code)
+		assert.JSONEq(t, `{"error":{"message":"Invalid ttl."}}`, r.Body.String())
+	})
+
+	var code string
+	r.POST("/admin/invites").SetHeader(header).SetJSON(gofight.D{
+		"uses": 3,
+		"ttl":  "72h",
+	}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusCreated, r.Code)
+
+		v, err := fastjson.Parse(r.Body.String())
+		assert.NoError(t, err)
+		assert.Equal(t, 3, v.GetInt("max_uses"))
+		assert.NotEmpty(t, v.GetStringBytes("expire_at"))
+		code = string(v.GetStringBytes("code"))
+	})
+
+	r.GET("/admin/invites").SetHeader(header).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+
+		v, err := fastjson.Parse(r.Body.String())
+		assert.NoError(t, err)
+		assert.Len(t, v.GetArray(), 1)
+		assert.Equal(t, code, string(v.GetStringBytes("0", "code")))
+	})
+
+	r.DELETE("/admin/invites/"+code).SetHeader(header).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusNoContent, r.Code)
+	})
+
+	r.DELETE("/admin/invites/"+code).SetHeader(header).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusNotFound, r.Code)
+		assert.JSONEq(t, `{"error":{"message":"Invite not found."}}`, r.Body.String())
+	})
+}
+
+func TestRequestAdminBackup(t *testing.T) {
+	engine, ctrl, r, cleanup := setup()
+	defer cleanup()
+
+	ctrl.AdminToken = adminToken
+	engine = server.EchoEngine(ctrl)
+	header := gofight.H{
+		"Authorization": "Bearer " + adminToken,
+	}
+
+	user := createUser(ctrl)
+
+	r.GET("/admin/backup?gzip=nope").SetHeader(header).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusBadRequest, r.Code)
+		assert.JSONEq(t, `{"error":{"message":"Invalid gzip."}}`, r.Body.String())
+	})
+
+	r.GET("/admin/backup").SetHeader(header).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+		assert.Regexp(t, `^attachment; filename="standardfile-\d{8}T\d{6}Z\.backup"$`, r.HeaderMap.Get("Content-Disposition"))
+		assert.NotEmpty(t, r.Body.Bytes())
+	})
+
+	r.GET("/admin/backup?gzip=true").SetHeader(header).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+		assert.Regexp(t, `\.backup\.gz"$`, r.HeaderMap.Get("Content-Disposition"))
+
+		gz, err := gzip.NewReader(r.Body)
+		assert.NoError(t, err)
+		payload, err := io.ReadAll(gz)
+		assert.NoError(t, err)
+
+		filename := filepath.Join(t.TempDir(), "standardfile.db")
+		assert.NoError(t, os.WriteFile(filename, payload, 0o600))
+
+		db, err := database.StormOpen(filename)
+		assert.NoError(t, err)
+		defer db.Close()
+
+		v, err := db.FindUserByMail(user.Email)
+		assert.NoError(t, err)
+		assert.Equal(t, user.ID, v.ID)
+	})
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mdouchement/standardfile/internal/model"
+	"github.com/mdouchement/standardfile/internal/server/serializer"
+	"github.com/mdouchement/standardfile/internal/server/service"
+	"github.com/mdouchement/standardfile/internal/sferror"
+)
+
+// audit contains all audit log handlers.
+type audit struct {
+	audits service.AuditService
+}
+
+// List lists the recent security events of the current user.
+func (h *audit) List(c echo.Context) error {
+	user := currentUser(c)
+	if c.Param("id") != user.ID {
+		return c.JSON(http.StatusUnauthorized, sferror.New("The given ID is not the user's one."))
+	}
+
+	events, err := h.audits.Recent(user.ID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, serializer.AuditEvents(events))
+}
+
+// currentSessionID returns the ID of the current session, empty with JWT authentication.
+func currentSessionID(c echo.Context) string {
+	if session := currentSession(c); session != nil {
+		return session.ID
+	}
+	return ""
+}
+
+// record appends an event of the given user to the audit log with the client's IP address and user agent.
+// A failure is logged without failing the request.
+func record(c echo.Context, audits service.AuditService, kind, userID, sessionID string) {
+	err := audits.Record(&model.AuditEvent{
+		UserID:    userID,
+		Type:      kind,
+		IP:        c.RealIP(),
+		UserAgent: c.Request().UserAgent(),
+		SessionID: sessionID,
+	})
+	if err != nil {
+		logger(c).WithError(err).WithField("type", kind).Error("could not record audit event")
+	}
+}
@@ -0,0 +1,186 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gofight/v2"
+	"github.com/mdouchement/standardfile/internal/model"
+	"github.com/mdouchement/standardfile/internal/server"
+	"github.com/mdouchement/standardfile/internal/totp"
+	"github.com/mdouchement/standardfile/pkg/libsf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestAuditEvents(t *testing.T) {
+	engine, ctrl, r, cleanup := setup()
+	defer cleanup()
+
+	user, session := createUserWithSession(ctrl)
+
+	login := func(password string, status int) {
+		r.POST("/v1/login").SetHeader(gofight.H{
+			"X-Forwarded-For": "10.0.0.1", // gofight requests have no remote address so they are handled like unix socket ones
+			"User-Agent":      "audit-test",
+		}).SetJSON(gofight.D{
+			"api":      libsf.APIVersion20200115,
+			"email":    user.Email,
+			"password": password,
+		}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, status, r.Code)
+		})
+	}
+	login("wrong", http.StatusUnauthorized)
+	login("password42", http.StatusOK)
+
+	r.POST("/v1/sessions/refresh").SetJSON(gofight.D{
+		"access_token":  accessToken(ctrl, session),
+		"refresh_token": refreshToken(ctrl, session),
+	}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+	})
+
+	session, err := ctrl.Database.FindSession(session.ID)
+	assert.NoError(t, err)
+	header := gofight.H{
+		"Authorization": "Bearer " + accessToken(ctrl, session),
+	}
+
+	r.DELETE("/v1/sessions").SetHeader(header).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusNoContent, r.Code)
+	})
+
+	r.GET("/v1/users/another-user/audit-events").SetHeader(header).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusUnauthorized, r.Code)
+		assert.JSONEq(t, `{"error":{"message":"The given ID is not the user's one."}}`, r.Body.String())
+	})
+
+	r.GET("/v1/users/"+user.ID+"/audit-events").SetHeader(header).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+
+		var events []struct {
+			Type      string `json:"type"`
+			IP        string `json:"ip"`
+			UserAgent string `json:"user_agent"`
+			SessionID string `json:"session_uuid"`
+		}
+		assert.NoError(t, json.Unmarshal(r.Body.Bytes(), &events))
+
+		types := make([]string, len(events))
+		for i, event := range events {
+			types[i] = event.Type
+		}
+		assert.Equal(t, []string{
+			model.AuditSessionsRevoked,
+			model.AuditSessionRefreshed,
+			model.AuditLogin,
+			model.AuditLoginFailed,
+		}, types)
+
+		if len(events) == 4 {
+			assert.Equal(t, session.ID, events[0].SessionID)
+			assert.Equal(t, session.ID, events[1].SessionID)
+			assert.NotEmpty(t, events[2].SessionID) // Created by the login
+			assert.NotEqual(t, session.ID, events[2].SessionID)
+			assert.Equal(t, "10.0.0.1", events[3].IP)
+			assert.Equal(t, "audit-test", events[3].UserAgent)
+		}
+	})
+}
+
+func TestRequestAuditEventsMFAAndAdmin(t *testing.T) {
+	engine, ctrl, r, cleanup := setup()
+	defer cleanup()
+
+	ctrl.AdminToken = adminToken
+	engine = server.EchoEngine(ctrl)
+
+	user, session := createUserWithSession(ctrl)
+	header := gofight.H{
+		"Authorization": "Bearer " + accessToken(ctrl, session),
+	}
+
+	secret := "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"
+	code, err := totp.Code(secret, time.Now())
+	assert.NoError(t, err)
+
+	r.PUT("/v1/users/"+user.ID+"/mfa").SetHeader(header).SetJSON(gofight.D{
+		"secret":   secret,
+		"mfa_code": code,
+	}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+	})
+
+	r.POST("/v1/users/"+user.ID+"/mfa/recovery-codes").SetHeader(header).SetJSON(gofight.D{
+		"mfa_code": code,
+	}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+	})
+
+	r.DELETE("/v1/users/"+user.ID+"/mfa").SetHeader(header).SetJSON(gofight.D{
+		"mfa_code": code,
+	}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusNoContent, r.Code)
+	})
+
+	r.PUT("/v1/users/"+user.ID+"/settings").SetHeader(header).SetJSON(gofight.D{
+		"name":  "MFA_SECRET",
+		"value": secret,
+	}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusCreated, r.Code)
+	})
+
+	r.DELETE("/v1/users/"+user.ID+"/settings/MFA_SECRET").SetHeader(header).SetJSON(gofight.D{
+		"mfa_code": code,
+	}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+	})
+
+	events, err := ctrl.Database.FindAuditEventsByUserID(user.ID, 100)
+	assert.NoError(t, err)
+	for _, event := range events {
+		assert.Equal(t, session.ID, event.SessionID)
+	}
+
+	admin := gofight.H{
+		"Authorization": "Bearer " + adminToken,
+	}
+	for _, path := range []string{"/disable", "/enable"} {
+		r.POST("/admin/users/"+user.ID+path).SetHeader(admin).SetJSON(gofight.D{}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+	}
+	r.DELETE("/admin/users/"+user.ID+"/sessions").SetHeader(admin).SetJSON(gofight.D{}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+	})
+
+	events, err = ctrl.Database.FindAuditEventsByUserID(user.ID, 100)
+	assert.NoError(t, err)
+
+	types := make([]string, len(events))
+	for i, event := range events {
+		types[i] = event.Type
+	}
+	assert.ElementsMatch(t, []string{
+		model.AuditMFAEnabled,
+		model.AuditMFARecoveryCodes,
+		model.AuditMFADisabled,
+		model.AuditMFAEnabled,
+		model.AuditMFADisabled,
+		model.AuditAdminDisabled,
+		model.AuditAdminEnabled,
+		model.AuditAdminLogout,
+	}, types)
+
+	r.DELETE("/admin/users/"+user.ID).SetHeader(admin).SetJSON(gofight.D{}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusNoContent, r.Code)
+	})
+
+	events, err = ctrl.Database.FindAuditEventsByUserID(user.ID, 100)
+	assert.NoError(t, err)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, model.AuditAdminDeleted, events[0].Type)
+	}
+}
@@ -2,22 +2,34 @@ package server
 
 import (
 	"crypto/sha256"
-	"log"
 	"net/http"
 	"os"
+	"strings"
 
 	"github.com/labstack/echo/v4"
 	"github.com/mdouchement/standardfile/internal/database"
+	"github.com/mdouchement/standardfile/internal/model"
+	"github.com/mdouchement/standardfile/internal/server/metrics"
+	"github.com/mdouchement/standardfile/internal/server/middlewares"
 	"github.com/mdouchement/standardfile/internal/server/service"
 	"github.com/mdouchement/standardfile/internal/server/session"
 	"github.com/mdouchement/standardfile/internal/sferror"
+	"github.com/mdouchement/standardfile/internal/storage"
 	"github.com/mdouchement/standardfile/pkg/libsf"
+	"github.com/pkg/errors"
 )
 
 // auth contains all authentication handlers.
 type auth struct {
 	db       database.Client
 	sessions session.Manager
+	notifier service.Notifier
+	mfa      service.MFAService
+	lockout  service.LockoutService
+	invites  service.InviteService
+	audits   service.AuditService
+	files    *storage.Local // nil when the files endpoints are disabled
+	metrics  *metrics.Metrics
 }
 
 ///// Register
@@ -48,8 +60,15 @@ func (h *auth) Register(c echo.Context) error {
 		return c.JSON(http.StatusUnauthorized, sferror.New("No password cost provided."))
 	}
 
-	service := service.NewUser(h.db, h.sessions, params.APIVersion)
-	register, err := service.Register(params)
+	code := params.InviteCode
+	if code == "" {
+		code = c.Request().Header.Get(middlewares.HeaderInviteCode)
+	}
+
+	users := service.NewUser(h.db, h.sessions, params.APIVersion)
+	register, err := h.invites.Register(params.Email, code, func() (service.Render, error) {
+		return users.Register(params)
+	})
 	if err != nil {
 		return err
 	}
@@ -70,14 +89,21 @@ func (h *auth) Params(c echo.Context) error {
 		return c.JSON(http.StatusUnauthorized, sferror.New("No email provided."))
 	}
 
-	return h.params(c, email)
+	mfa := map[string]string{}
+	for k := range c.QueryParams() {
+		if strings.HasPrefix(k, "mfa_") {
+			mfa[k] = c.QueryParam(k)
+		}
+	}
+
+	return h.params(c, email, mfa)
 }
 
 // ParamsPKCE used for password generation with PKCE protection mechanism.
 func (h *auth) ParamsPKCE(c echo.Context) error {
 	var params service.LoginParams
 	if err := c.Bind(&params); err != nil {
-		log.Println("Could not get parameters:", err)
+		logger(c).WithError(err).Warn("could not get parameters")
 		return c.JSON(http.StatusBadRequest, sferror.New("Could not get credentials."))
 	}
 	params.UserAgent = c.Request().UserAgent()
@@ -94,14 +120,18 @@ func (h *auth) ParamsPKCE(c echo.Context) error {
 	pkce := service.NewPKCE(h.db, params.Params)
 
 	if err := pkce.StoreChallenge(params.CodeChallenge); err != nil {
-		log.Println("Could not store code challenge:", err)
+		logger(c).WithError(err).Error("could not store code challenge")
 		return c.JSON(http.StatusBadRequest, sferror.New("Could not store code challenge."))
 	}
 
-	return h.params(c, params.Email)
+	return h.params(c, params.Email, params.MFA)
 }
 
-func (h *auth) params(c echo.Context, email string) error {
+func (h *auth) params(c echo.Context, email string, mfa map[string]string) error {
+	if err := h.lockout.Check(email, c.RealIP()); err != nil {
+		return err
+	}
+
 	// Check if the user exists.
 	user, err := h.db.FindUserByMail(email)
 	if err != nil {
@@ -113,10 +143,29 @@ func (h *auth) params(c echo.Context, email string) error {
 		})
 	}
 
-	// TODO 2FA
+	// The code is only checked here, it is consumed on login.
 	// https://github.com/standardfile/ruby-server/blob/master/app/controllers/api/auth_controller.rb#L16
+	if err := h.mfa.Verify(user, mfa, false); err != nil {
+		if len(mfa) > 0 {
+			h.fail(c, user, email, c.RealIP(), err)
+		}
+		return err
+	}
+
+	return c.JSON(http.StatusOK, keyParams(user))
+}
+
+// UserParams returns the password generation params of the current user.
+func (h *auth) UserParams(c echo.Context) error {
+	user := currentUser(c)
+	if c.Param("id") != user.ID {
+		return c.JSON(http.StatusUnauthorized, sferror.New("The given ID is not the user's one."))
+	}
+
+	return c.JSON(http.StatusOK, keyParams(user))
+}
 
-	// Render
+func keyParams(user *model.User) echo.Map {
 	params := echo.Map{
 		"identifier": user.Email,
 		"version":    user.Version,
@@ -133,7 +182,7 @@ func (h *auth) params(c echo.Context, email string) error {
 		params["pw_nonce"] = user.PasswordNonce
 	}
 
-	return c.JSON(http.StatusOK, params)
+	return params
 }
 
 ///// Login
@@ -146,7 +195,7 @@ func (h *auth) Login(c echo.Context) error {
 	// Filter params
 	var params service.LoginParams
 	if err := c.Bind(&params); err != nil {
-		log.Println("Could not get parameters:", err)
+		logger(c).WithError(err).Warn("could not get parameters")
 		return c.JSON(http.StatusBadRequest, sferror.New("Could not get credentials."))
 	}
 	params.UserAgent = c.Request().UserAgent()
@@ -165,7 +214,7 @@ func (h *auth) LoginPKCE(c echo.Context) error {
 	// Filter params
 	var params service.LoginParams
 	if err := c.Bind(&params); err != nil {
-		log.Println("Could not get parameters:", err)
+		logger(c).WithError(err).Warn("could not get parameters")
 		return c.JSON(http.StatusBadRequest, sferror.New("Could not get credentials."))
 	}
 	params.UserAgent = c.Request().UserAgent()
@@ -180,7 +229,7 @@ func (h *auth) LoginPKCE(c echo.Context) error {
 	challenge := pkce.ComputeChallenge(params.CodeVerifier)
 	err := pkce.CheckChallenge(challenge)
 	if err != nil {
-		log.Println("Could not check code challenge:", err)
+		logger(c).WithError(err).Error("could not check code challenge")
 		return c.JSON(http.StatusBadRequest, sferror.New("Could not get credentials."))
 	}
 
@@ -188,18 +237,84 @@ func (h *auth) LoginPKCE(c echo.Context) error {
 }
 
 func (h *auth) login(c echo.Context, params service.LoginParams) error {
-	// TODO 2FA
+	ip := c.RealIP()
+	if err := h.lockout.Check(params.Email, ip); err != nil {
+		return err
+	}
+
 	// https://github.com/standardfile/ruby-server/blob/master/app/controllers/api/auth_controller.rb#L16
+	user, err := h.db.FindUserByMail(params.Email)
+	if err != nil && !h.db.IsNotFound(err) {
+		return errors.Wrap(err, "could not get user")
+	}
+	if user != nil {
+		if err = h.mfa.Verify(user, params.MFA, false); err != nil {
+			if len(params.MFA) > 0 { // Not a failure when the client has to ask for the code
+				h.fail(c, user, params.Email, ip, err)
+			}
+			return err
+		}
+	}
 
 	service := service.NewUser(h.db, h.sessions, params.APIVersion)
 	login, err := service.Login(params)
 	if err != nil {
+		h.fail(c, user, params.Email, ip, err)
 		return err
 	}
 
+	if user != nil {
+		// Consumes the recovery code once the password is verified.
+		if err = h.mfa.Verify(user, params.MFA, true); err != nil {
+			h.fail(c, user, params.Email, ip, err)
+			return err
+		}
+	}
+
+	if err = h.lockout.Reset(params.Email, ip); err != nil {
+		logger(c).WithError(err).Error("could not reset login attempts")
+	}
+
+	if user != nil {
+		record(c, h.audits, model.AuditLogin, user.ID, h.sessionID(login))
+	}
+
 	return c.JSON(http.StatusOK, login)
 }
 
+// sessionID returns the ID of the session created by a login, empty with JWT authentication.
+func (h *auth) sessionID(login service.Render) string {
+	response, _ := login.(service.M)
+	session, _ := response["session"].(echo.Map)
+	token, _ := session["access_token"].(string)
+	if token == "" {
+		return ""
+	}
+
+	id, _, err := h.sessions.ParseToken(token)
+	if err != nil {
+		return ""
+	}
+	return id
+}
+
+// fail records a failed login attempt when err is caused by invalid credentials.
+// The user is nil when the email does not match an account.
+func (h *auth) fail(c echo.Context, user *model.User, email, ip string, err error) {
+	if sferror.StatusCode(err) != http.StatusUnauthorized {
+		return
+	}
+
+	h.metrics.LoginFailed()
+	if err = h.lockout.Fail(email, ip); err != nil {
+		logger(c).WithError(err).Error("could not record failed login attempt")
+	}
+
+	if user != nil {
+		record(c, h.audits, model.AuditLoginFailed, user.ID, "")
+	}
+}
+
 ///// Logout
 ////
 //
@@ -212,6 +327,9 @@ func (h *auth) Logout(c echo.Context) error {
 		if err != nil && h.db.IsNotFound(err) {
 			return err
 		}
+
+		h.notifier.Disconnect(currentUser(c).ID, session.ID)
+		record(c, h.audits, model.AuditLogout, currentUser(c).ID, session.ID)
 	}
 
 	return c.NoContent(http.StatusNoContent)
@@ -226,14 +344,21 @@ func (h *auth) Update(c echo.Context) error {
 	// Filter params
 	var params service.UpdateUserParams
 	if err := c.Bind(&params); err != nil {
-		log.Println("Could not get parameters:", err)
+		logger(c).WithError(err).Warn("could not get parameters")
 		return c.JSON(http.StatusUnauthorized, sferror.New("Could not get parameters."))
 	}
 	params.UserAgent = c.Request().UserAgent()
 	params.Session = currentSession(c)
 
+	user := currentUser(c)
+
+	// When id parameter passed, check it's the same like in bearer token.
+	if c.Param("id") != "" && c.Param("id") != user.ID {
+		return c.JSON(http.StatusUnauthorized, sferror.New("The given ID is not the user's one."))
+	}
+
 	service := service.NewUser(h.db, h.sessions, params.APIVersion)
-	update, err := service.Update(currentUser(c), params)
+	update, err := service.Update(user, params)
 	if err != nil {
 		return err
 	}
@@ -251,7 +376,7 @@ func (h *auth) UpdatePassword(c echo.Context) error {
 	// Filter params
 	var params service.UpdatePasswordParams
 	if err := c.Bind(&params); err != nil {
-		log.Println("Could not get parameters:", err)
+		logger(c).WithError(err).Warn("could not get parameters")
 		return c.JSON(http.StatusUnauthorized, sferror.New("Could not get parameters."))
 	}
 
@@ -286,5 +411,46 @@ func (h *auth) UpdatePassword(c echo.Context) error {
 		return err
 	}
 
+	record(c, h.audits, model.AuditPasswordChanged, user.ID, currentSessionID(c))
+
 	return c.JSON(http.StatusOK, password)
 }
+
+///// Delete
+////
+//
+
+// Delete used to delete the current user and all their data.
+func (h *auth) Delete(c echo.Context) error {
+	// Filter params
+	var params service.DeleteUserParams
+	if err := c.Bind(&params); err != nil {
+		logger(c).WithError(err).Warn("could not get parameters")
+		return c.JSON(http.StatusUnauthorized, sferror.New("Could not get parameters."))
+	}
+
+	if params.Password == "" {
+		return c.JSON(http.StatusUnauthorized, sferror.New("Your current password is required to delete your account."))
+	}
+
+	user := currentUser(c)
+	if c.Param("id") != user.ID {
+		return c.JSON(http.StatusUnauthorized, sferror.New("The given ID is not the user's one."))
+	}
+
+	service := service.NewUser(h.db, h.sessions, params.APIVersion)
+	if err := service.Delete(user, params); err != nil {
+		return err
+	}
+	h.notifier.Disconnect(user.ID, "")
+
+	if h.files != nil {
+		if err := h.files.RemoveAll(user.ID); err != nil {
+			logger(c).WithError(err).Error("could not remove user's files")
+		}
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"message": "Successfully deleted user.",
+	})
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/appleboy/gofight/v2"
 	"github.com/labstack/echo/v4"
+	"github.com/mdouchement/standardfile/internal/model"
 	"github.com/mdouchement/standardfile/internal/server/session"
 	"github.com/mdouchement/standardfile/internal/sferror"
 	"github.com/mdouchement/standardfile/pkg/libsf"
@@ -500,3 +501,63 @@ func TestRequestUpdatePassword20200115(t *testing.T) {
 		assert.JSONEq(t, `{"error":{"message":"The given ID is not the user's one."}}`, r.Body.String())
 	})
 }
+
+func TestRequestDelete20200115(t *testing.T) {
+	engine, ctrl, r, cleanup := setup()
+	defer cleanup()
+
+	r.DELETE("/v1/users/42").Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusUnauthorized, r.Code)
+	})
+
+	user, session := createUserWithSession(ctrl)
+	header := gofight.H{
+		"Authorization": "Bearer " + accessToken(ctrl, session),
+	}
+
+	item := &model.Item{UserID: user.ID, Content: "004:note", ContentType: libsf.ContentTypeNote}
+	assert.NoError(t, ctrl.Database.Save(item))
+
+	r.DELETE("/v1/users/"+user.ID).SetHeader(header).SetJSON(gofight.D{
+		"api": libsf.APIVersion20200115,
+	}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusUnauthorized, r.Code)
+		assert.JSONEq(t, `{"error":{"message":"Your current password is required to delete your account."}}`, r.Body.String())
+	})
+
+	r.DELETE("/v1/users/"+user.ID).SetHeader(header).SetJSON(gofight.D{
+		"api":      libsf.APIVersion20200115,
+		"password": "yolo!",
+	}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusUnauthorized, r.Code)
+		assert.JSONEq(t, `{"error":{"message":"The current password you entered is incorrect. Please try again."}}`, r.Body.String())
+	})
+
+	r.DELETE("/v1/users/DIFFERENT-ID-THAN-IN-BEARER-TOKEN").SetHeader(header).SetJSON(gofight.D{
+		"api":      libsf.APIVersion20200115,
+		"password": "password42",
+	}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusUnauthorized, r.Code)
+		assert.JSONEq(t, `{"error":{"message":"The given ID is not the user's one."}}`, r.Body.String())
+	})
+
+	r.DELETE("/v1/users/"+user.ID).SetHeader(header).SetJSON(gofight.D{
+		"api":      libsf.APIVersion20200115,
+		"password": "password42",
+	}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+		assert.JSONEq(t, `{"message":"Successfully deleted user."}`, r.Body.String())
+	})
+
+	_, err := ctrl.Database.FindUser(user.ID)
+	assert.True(t, ctrl.Database.IsNotFound(err))
+	_, err = ctrl.Database.FindItem(item.ID)
+	assert.True(t, ctrl.Database.IsNotFound(err))
+	_, err = ctrl.Database.FindSession(session.ID)
+	assert.True(t, ctrl.Database.IsNotFound(err))
+
+	// The session is revoked with the account.
+	r.GET("/v1/sessions").SetHeader(header).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusUnauthorized, r.Code)
+	})
+}
@@ -0,0 +1,329 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mdouchement/standardfile/internal/server/middlewares"
+	sessionpkg "github.com/mdouchement/standardfile/internal/server/session"
+	"github.com/mdouchement/standardfile/internal/sferror"
+	"github.com/mdouchement/standardfile/internal/storage"
+	"github.com/pkg/errors"
+)
+
+type (
+	// file contains all encrypted file handlers.
+	file struct {
+		files    *storage.Local
+		sessions sessionpkg.Manager
+		// Quota is the maximum number of bytes stored per user, 0 means unlimited.
+		quota     int64
+		serverURL string
+	}
+
+	valetTokenParams struct {
+		Operation string                     `json:"operation"`
+		Resources []sessionpkg.ValetResource `json:"resources"`
+	}
+)
+
+// ValetToken creates a valet token granting an operation on the given files.
+func (h *file) ValetToken(c echo.Context) error {
+	user := currentUser(c)
+
+	// Filter params
+	var params valetTokenParams
+	if err := c.Bind(&params); err != nil {
+		return c.JSON(http.StatusBadRequest, sferror.NewWithTagCode(
+			http.StatusBadRequest,
+			"invalid-parameters",
+			"Invalid request body.",
+		))
+	}
+
+	switch params.Operation {
+	case sessionpkg.ValetRead, sessionpkg.ValetWrite, sessionpkg.ValetDelete:
+	default:
+		return c.JSON(http.StatusBadRequest, sferror.NewWithTagCode(
+			http.StatusBadRequest,
+			"invalid-parameters",
+			"Invalid operation.",
+		))
+	}
+
+	if len(params.Resources) == 0 {
+		return c.JSON(http.StatusBadRequest, sferror.NewWithTagCode(
+			http.StatusBadRequest,
+			"invalid-parameters",
+			"No resources provided.",
+		))
+	}
+
+	// The files endpoints operate on a single file.
+	if len(params.Resources) > 1 {
+		return c.JSON(http.StatusBadRequest, sferror.NewWithTagCode(
+			http.StatusBadRequest,
+			"invalid-parameters",
+			"Only one resource per valet token is supported.",
+		))
+	}
+
+	used, err := h.files.Usage(user.ID)
+	if err != nil {
+		return err
+	}
+
+	if params.Operation == sessionpkg.ValetWrite && h.quota > 0 {
+		var requested int64
+		for _, resource := range params.Resources {
+			requested += resource.UnencryptedFileSize
+		}
+
+		if used+requested > h.quota {
+			return c.JSON(http.StatusForbidden, sferror.NewWithTagCode(
+				http.StatusForbidden,
+				"no-space",
+				"The file you are trying to upload is too big. Please upgrade your storage quota.",
+			))
+		}
+	}
+
+	valet := sessionpkg.NewValet(user, currentSession(c), params.Operation, params.Resources)
+	valet.UploadBytesUsed = used
+	valet.UploadBytesLimit = h.quota
+
+	token, err := h.sessions.ValetToken(valet)
+	if err != nil {
+		return errors.Wrap(err, "could not generate valet token")
+	}
+
+	serverURL := h.serverURL
+	if serverURL == "" {
+		serverURL = c.Scheme() + "://" + c.Request().Host
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"success":    true,
+		"valetToken": token,
+		"meta": echo.Map{
+			"server": echo.Map{
+				"filesServerUrl": serverURL,
+			},
+		},
+	})
+}
+
+// CreateUploadSession starts the upload of a file.
+func (h *file) CreateUploadSession(c echo.Context) error {
+	valet := currentValet(c)
+	if valet.Operation != sessionpkg.ValetWrite {
+		return errNotAllowed(c)
+	}
+
+	if err := h.files.CreateUpload(valet.UserID, valet.Resource()); err != nil {
+		if err == storage.ErrInvalidIdentifier {
+			return errInvalidResource(c)
+		}
+		return errors.Wrap(err, "could not create upload session")
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"success":  true,
+		"uploadId": valet.Resource(),
+	})
+}
+
+// UploadChunk stores an encrypted chunk of the file being uploaded.
+func (h *file) UploadChunk(c echo.Context) error {
+	valet := currentValet(c)
+	if valet.Operation != sessionpkg.ValetWrite {
+		return errNotAllowed(c)
+	}
+
+	chunkID, err := strconv.Atoi(c.Request().Header.Get("X-Chunk-Id"))
+	if err != nil || chunkID < 0 {
+		return c.JSON(http.StatusBadRequest, sferror.NewWithTagCode(
+			http.StatusBadRequest,
+			"invalid-parameters",
+			"Invalid chunk id.",
+		))
+	}
+
+	// The concurrent chunks of the user must not share the same remaining quota.
+	defer h.files.Lock(valet.UserID)()
+
+	remaining := int64(-1)
+	if h.quota > 0 {
+		used, err := h.files.Usage(valet.UserID)
+		if err != nil {
+			return err
+		}
+		remaining = max(h.quota-used, 0)
+	}
+
+	_, err = h.files.WriteChunk(valet.UserID, valet.Resource(), chunkID, c.Request().Body, remaining)
+	switch {
+	case err == storage.ErrInvalidIdentifier:
+		return errInvalidResource(c)
+	case err == storage.ErrQuotaExceeded:
+		return c.JSON(http.StatusForbidden, sferror.NewWithTagCode(
+			http.StatusForbidden,
+			"no-space",
+			"Could not save file: storage quota exceeded.",
+		))
+	case os.IsNotExist(errors.Cause(err)):
+		return c.JSON(http.StatusBadRequest, sferror.NewWithTagCode(
+			http.StatusBadRequest,
+			"invalid-parameters",
+			"Upload session not found.",
+		))
+	case err != nil:
+		return errors.Wrap(err, "could not upload chunk")
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"success": true,
+		"message": "Chunk uploaded successfully",
+	})
+}
+
+// CloseUploadSession assembles the uploaded chunks.
+func (h *file) CloseUploadSession(c echo.Context) error {
+	valet := currentValet(c)
+	if valet.Operation != sessionpkg.ValetWrite {
+		return errNotAllowed(c)
+	}
+
+	// The chunks and the assembled file are both counted in the usage while the upload is closed.
+	defer h.files.Lock(valet.UserID)()
+
+	_, err := h.files.CloseUpload(valet.UserID, valet.Resource())
+	switch {
+	case err == storage.ErrInvalidIdentifier:
+		return errInvalidResource(c)
+	case os.IsNotExist(errors.Cause(err)):
+		return c.JSON(http.StatusBadRequest, sferror.NewWithTagCode(
+			http.StatusBadRequest,
+			"invalid-parameters",
+			"Upload session not found.",
+		))
+	case err != nil:
+		return errors.Wrap(err, "could not close upload session")
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"success": true,
+		"message": "File uploaded successfully",
+	})
+}
+
+// Download streams the requested range of a file.
+// The `X-Chunk-Size' header caps the size of the returned range.
+func (h *file) Download(c echo.Context) error {
+	valet := currentValet(c)
+	if valet.Operation != sessionpkg.ValetRead {
+		return errNotAllowed(c)
+	}
+
+	f, err := h.files.Open(valet.UserID, valet.Resource())
+	switch {
+	case err == storage.ErrInvalidIdentifier:
+		return errInvalidResource(c)
+	case os.IsNotExist(errors.Cause(err)):
+		return c.JSON(http.StatusNotFound, sferror.New("File not found."))
+	case err != nil:
+		return errors.Wrap(err, "could not open file")
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return errors.Wrap(err, "could not stat file")
+	}
+
+	chunkSize, _ := strconv.ParseInt(c.Request().Header.Get("X-Chunk-Size"), 10, 64)
+	if chunkSize > 0 {
+		rg := c.Request().Header.Get("Range")
+		if rg == "" {
+			rg = "bytes=0-"
+		}
+		c.Request().Header.Set("Range", capRange(rg, chunkSize))
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, echo.MIMEOctetStream)
+	http.ServeContent(c.Response(), c.Request(), "", info.ModTime(), f)
+	return nil
+}
+
+// Delete removes a file.
+func (h *file) Delete(c echo.Context) error {
+	valet := currentValet(c)
+	if valet.Operation != sessionpkg.ValetDelete {
+		return errNotAllowed(c)
+	}
+
+	err := h.files.Remove(valet.UserID, valet.Resource())
+	switch {
+	case err == storage.ErrInvalidIdentifier:
+		return errInvalidResource(c)
+	case os.IsNotExist(errors.Cause(err)):
+		return c.JSON(http.StatusNotFound, sferror.New("File not found."))
+	case err != nil:
+		return errors.Wrap(err, "could not remove file")
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"success": true,
+		"message": "File removed successfully",
+	})
+}
+
+// capRange limits the single range `bytes=start-[end]' to size bytes.
+// Other range forms are returned unchanged and handled by http.ServeContent.
+func capRange(rg string, size int64) string {
+	spec, ok := strings.CutPrefix(rg, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return rg
+	}
+
+	first, last, _ := strings.Cut(spec, "-")
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return rg // Suffix range
+	}
+
+	end := start + size - 1
+	if v, err := strconv.ParseInt(last, 10, 64); err == nil && v < end {
+		end = v
+	}
+
+	return fmt.Sprintf("bytes=%d-%d", start, end)
+}
+
+func currentValet(c echo.Context) *sessionpkg.Valet {
+	valet, ok := c.Get(middlewares.CurrentValetContextKey).(*sessionpkg.Valet)
+	if ok {
+		return valet
+	}
+	return nil
+}
+
+func errNotAllowed(c echo.Context) error {
+	return c.JSON(http.StatusForbidden, sferror.NewWithTagCode(
+		http.StatusForbidden,
+		"invalid-auth",
+		"Operation not allowed by the valet token.",
+	))
+}
+
+func errInvalidResource(c echo.Context) error {
+	return c.JSON(http.StatusBadRequest, sferror.NewWithTagCode(
+		http.StatusBadRequest,
+		"invalid-parameters",
+		"Invalid resource identifier.",
+	))
+}
@@ -0,0 +1,267 @@
+package server_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gofight/v2"
+	"github.com/gofrs/uuid"
+	"github.com/mdouchement/standardfile/internal/server"
+	sessionpkg "github.com/mdouchement/standardfile/internal/server/session"
+	"github.com/mdouchement/standardfile/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestFiles(t *testing.T) {
+	engine, ctrl, r, cleanup := setup()
+	defer cleanup()
+
+	dir, err := os.MkdirTemp("", "standardfile")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ctrl.Files, err = storage.NewLocal(dir)
+	assert.NoError(t, err)
+	ctrl.FilesQuota = 16
+	engine = server.EchoEngine(ctrl)
+
+	r.POST("/v1/files/valet-tokens").Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusUnauthorized, r.Code)
+	})
+
+	r.POST("/v1/files/upload/create-session").Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusUnauthorized, r.Code)
+		assert.JSONEq(t, `{"error":{"tag":"invalid-auth","message":"Invalid valet token."}}`, r.Body.String())
+	})
+
+	user, session := createUserWithSession(ctrl)
+	header := gofight.H{
+		"Authorization": "Bearer " + accessToken(ctrl, session),
+	}
+	resource := uuid.Must(uuid.NewV4()).String()
+
+	valet := func(operation string, size int) (token string) {
+		r.POST("/v1/files/valet-tokens").SetHeader(header).SetJSON(gofight.D{
+			"operation": operation,
+			"resources": []gofight.D{{"remoteIdentifier": resource, "unencryptedFileSize": size}},
+		}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+
+			var v map[string]any
+			err := json.Unmarshal(r.Body.Bytes(), &v)
+			assert.NoError(t, err)
+			assert.Equal(t, true, v["success"])
+			token = v["valetToken"].(string)
+		})
+		return token
+	}
+
+	//
+	// Quota
+	//
+
+	r.POST("/v1/files/valet-tokens").SetHeader(header).SetJSON(gofight.D{
+		"operation": "write",
+		"resources": []gofight.D{{"remoteIdentifier": resource, "unencryptedFileSize": 17}},
+	}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusForbidden, r.Code)
+	})
+
+	//
+	// Upload
+	//
+
+	write := gofight.H{"X-Valet-Token": valet("write", 10)}
+
+	r.POST("/v1/files/upload/create-session").SetHeader(write).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+		assert.JSONEq(t, `{"success":true,"uploadId":"`+resource+`"}`, r.Body.String())
+	})
+
+	for id, chunk := range []string{"01234", "56789"} {
+		write["X-Chunk-Id"] = []string{"1", "2"}[id]
+		r.POST("/v1/files/upload/chunk").SetHeader(write).SetBody(chunk).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.JSONEq(t, `{"success":true,"message":"Chunk uploaded successfully"}`, r.Body.String())
+		})
+	}
+
+	write["X-Chunk-Id"] = "3"
+	r.POST("/v1/files/upload/chunk").SetHeader(write).SetBody("abcdefghijklmnop").Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusForbidden, r.Code)
+	})
+
+	r.POST("/v1/files/upload/close-session").SetHeader(write).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+		assert.JSONEq(t, `{"success":true,"message":"File uploaded successfully"}`, r.Body.String())
+	})
+
+	//
+	// Download
+	//
+
+	r.GET("/v1/files").SetHeader(write).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusForbidden, r.Code)
+	})
+
+	read := gofight.H{"X-Valet-Token": valet("read", 0)}
+
+	r.GET("/v1/files").SetHeader(read).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+		assert.Equal(t, "0123456789", r.Body.String())
+	})
+
+	read["Range"] = "bytes=2-"
+	read["X-Chunk-Size"] = "4"
+	r.GET("/v1/files").SetHeader(read).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusPartialContent, r.Code)
+		assert.Equal(t, "bytes 2-5/10", r.HeaderMap.Get("Content-Range"))
+		assert.Equal(t, "2345", r.Body.String())
+	})
+
+	//
+	// Delete
+	//
+
+	remove := gofight.H{"X-Valet-Token": valet("delete", 0)}
+
+	r.DELETE("/v1/files").SetHeader(remove).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+		assert.JSONEq(t, `{"success":true,"message":"File removed successfully"}`, r.Body.String())
+	})
+
+	r.DELETE("/v1/files").SetHeader(remove).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusNotFound, r.Code)
+	})
+
+	//
+	// Revocation
+	//
+
+	r.POST("/v1/files/valet-tokens").SetHeader(header).SetJSON(gofight.D{
+		"operation": "read",
+		"resources": []gofight.D{{"remoteIdentifier": resource}, {"remoteIdentifier": resource}},
+	}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusBadRequest, r.Code)
+		assert.JSONEq(t, `{"error":{"tag":"invalid-parameters","message":"Only one resource per valet token is supported."}}`, r.Body.String())
+	})
+
+	sessions := sessionpkg.NewManager(ctrl.Database, ctrl.SigningKey, ctrl.SessionSecret, ctrl.AccessTokenExpirationTime, ctrl.RefreshTokenExpirationTime)
+	token, err := sessions.ValetToken(sessionpkg.NewValet(user, session, "delete", []sessionpkg.ValetResource{{RemoteIdentifier: resource}, {RemoteIdentifier: resource}}))
+	assert.NoError(t, err)
+
+	r.DELETE("/v1/files").SetHeader(gofight.H{"X-Valet-Token": token}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusUnauthorized, r.Code)
+		assert.JSONEq(t, `{"error":{"tag":"invalid-auth","message":"Invalid valet token."}}`, r.Body.String())
+	})
+
+	read = gofight.H{"X-Valet-Token": valet("read", 0)}
+
+	user.Disabled = true
+	assert.NoError(t, ctrl.Database.Save(user))
+
+	r.GET("/v1/files").SetHeader(read).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusUnauthorized, r.Code)
+		assert.JSONEq(t, `{"error":{"tag":"invalid-auth","message":"Invalid valet token."}}`, r.Body.String())
+	})
+
+	user.Disabled = false
+	assert.NoError(t, ctrl.Database.Save(user))
+
+	r.GET("/v1/files").SetHeader(read).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusNotFound, r.Code)
+	})
+
+	assert.NoError(t, ctrl.Database.Delete(session)) // Sign out
+
+	r.GET("/v1/files").SetHeader(read).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusUnauthorized, r.Code)
+		assert.JSONEq(t, `{"error":{"tag":"invalid-auth","message":"Invalid valet token."}}`, r.Body.String())
+	})
+}
+
+func TestRequestFilesConcurrentChunks(t *testing.T) {
+	engine, ctrl, r, cleanup := setup()
+	defer cleanup()
+
+	dir, err := os.MkdirTemp("", "standardfile")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ctrl.Files, err = storage.NewLocal(dir)
+	assert.NoError(t, err)
+	ctrl.FilesQuota = 16
+	engine = server.EchoEngine(ctrl)
+
+	_, session := createUserWithSession(ctrl)
+	resource := uuid.Must(uuid.NewV4()).String()
+
+	var token string
+	r.POST("/v1/files/valet-tokens").SetHeader(gofight.H{
+		"Authorization": "Bearer " + accessToken(ctrl, session),
+	}).SetJSON(gofight.D{
+		"operation": "write",
+		"resources": []gofight.D{{"remoteIdentifier": resource, "unencryptedFileSize": 16}},
+	}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+
+		var v map[string]any
+		assert.NoError(t, json.Unmarshal(r.Body.Bytes(), &v))
+		token, _ = v["valetToken"].(string)
+	})
+
+	r.POST("/v1/files/upload/create-session").SetHeader(gofight.H{"X-Valet-Token": token}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+	})
+
+	// Each chunk fits in the quota but two of them do not.
+	var wg sync.WaitGroup
+	codes := make([]int, 8)
+	for i := range codes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/files/upload/chunk", &slowReader{data: []byte("012345678")})
+			req.Header.Set("X-Valet-Token", token)
+			req.Header.Set("X-Chunk-Id", strconv.Itoa(i))
+			rec := httptest.NewRecorder()
+			engine.ServeHTTP(rec, req)
+			codes[i] = rec.Code
+		}()
+	}
+	wg.Wait()
+
+	var uploaded int
+	for _, code := range codes {
+		if code == http.StatusOK {
+			uploaded++
+			continue
+		}
+		assert.Equal(t, http.StatusForbidden, code)
+	}
+	assert.Equal(t, 1, uploaded)
+}
+
+// A slowReader reads its data one byte at a time.
+type slowReader struct {
+	data []byte
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+
+	time.Sleep(time.Millisecond)
+	p[0] = r.data[0]
+	r.data = r.data[1:]
+	return 1, nil
+}
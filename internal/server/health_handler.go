@@ -0,0 +1,59 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mdouchement/standardfile/internal/database"
+)
+
+// readinessTimeout is the maximum duration of the database read performed by the readiness probe.
+const readinessTimeout = 5 * time.Second
+
+// health contains all probe handlers.
+type health struct {
+	db database.Client
+}
+
+// Live reports that the server is running.
+func (h *health) Live(c echo.Context) error {
+	return c.JSON(http.StatusOK, echo.Map{
+		"status": "ok",
+	})
+}
+
+// Ready reports whether the server can serve requests.
+// The database is read so a wedged database makes the instance unready.
+func (h *health) Ready(c echo.Context) error {
+	type result struct {
+		stats database.Stats
+		err   error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		stats, err := h.db.Stats()
+		done <- result{stats: stats, err: err}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			logger(c).WithError(r.err).Error("readiness check failed")
+			return c.JSON(http.StatusServiceUnavailable, echo.Map{
+				"status": "unavailable",
+			})
+		}
+
+		return c.JSON(http.StatusOK, echo.Map{
+			"status":   "ok",
+			"database": r.stats,
+		})
+	case <-time.After(readinessTimeout):
+		logger(c).Error("readiness check failed: database read timed out")
+		return c.JSON(http.StatusServiceUnavailable, echo.Map{
+			"status": "unavailable",
+		})
+	}
+}
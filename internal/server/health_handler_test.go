@@ -0,0 +1,36 @@
+package server_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/appleboy/gofight/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fastjson"
+)
+
+func TestRequestHealth(t *testing.T) {
+	engine, ctrl, r, cleanup := setup()
+	defer cleanup()
+
+	r.GET("/healthz").Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+		assert.JSONEq(t, `{"status":"ok"}`, r.Body.String())
+	})
+
+	r.GET("/readyz").Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+
+		v, err := fastjson.Parse(r.Body.String())
+		assert.NoError(t, err)
+		assert.Equal(t, "ok", string(v.GetStringBytes("status")))
+		assert.Greater(t, v.GetInt64("database", "size"), int64(0))
+		assert.True(t, v.Exists("database", "free_pages"))
+	})
+
+	ctrl.Database.Close()
+	r.GET("/readyz").Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusServiceUnavailable, r.Code)
+		assert.JSONEq(t, `{"status":"unavailable"}`, r.Body.String())
+	})
+}
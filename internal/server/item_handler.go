@@ -5,13 +5,17 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"github.com/mdouchement/standardfile/internal/database"
+	"github.com/mdouchement/standardfile/internal/server/metrics"
 	"github.com/mdouchement/standardfile/internal/server/service"
 	"github.com/mdouchement/standardfile/internal/sferror"
 )
 
 // item contains all item handlers.
 type item struct {
-	db database.Client
+	db        database.Client
+	revisions service.RevisionService
+	notifier  service.Notifier
+	metrics   *metrics.Metrics
 }
 
 ///// Sync
@@ -28,13 +32,26 @@ func (h *item) Sync(c echo.Context) error {
 	}
 	params.UserAgent = c.Request().UserAgent()
 	params.Session = currentSession(c)
+	params.Logger = logger(c)
 
-	sync := service.NewSync(h.db, currentUser(c), params)
+	sync := service.NewSync(h.db, h.revisions, h.notifier, currentUser(c), params)
 	if err := sync.Execute(); err != nil {
 		return err
 	}
+	saved, conflicted := sync.Stats()
+	h.metrics.ObserveSync(c.Request().ContentLength, saved, conflicted)
 
-	return c.JSON(http.StatusOK, sync)
+	c.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if err := sync.WriteJSON(c.Response()); err != nil {
+		if !c.Response().Committed {
+			return err
+		}
+
+		logger(c).WithError(err).Error("could not write sync response")
+		// The status is already sent, aborting the connection prevents the client from reading a truncated response.
+		panic(http.ErrAbortHandler)
+	}
+	return nil
 }
 
 ///// Backup
@@ -54,11 +71,26 @@ func (h *item) Backup(c echo.Context) error {
 //
 
 // Delete used for remove all defined items.
+// https://github.com/standardfile/ruby-server/blob/master/app/controllers/api/items_controller.rb#L72-L76
 func (h *item) Delete(c echo.Context) error {
-	// user := currentUser(c)
-	// https://github.com/standardfile/ruby-server/blob/master/app/controllers/api/items_controller.rb#L72-L76
+	// Filter params
+	var params service.DeleteItemsParams
+	if err := c.Bind(&params); err != nil {
+		return c.JSON(http.StatusBadRequest, sferror.New("Could not get parameters."))
+	}
+	params.UserAgent = c.Request().UserAgent()
+	params.Session = currentSession(c)
+
+	if !params.All && len(params.UUIDs) == 0 && params.UUID == "" {
+		return c.JSON(http.StatusBadRequest, sferror.New("Please provide the items to delete."))
+	}
 
-	// TODO undocumented feature and seems not used by official client.
+	count, err := service.DeleteItems(h.db, h.revisions, h.notifier, currentUser(c), params)
+	if err != nil {
+		return err
+	}
 
-	return c.NoContent(http.StatusNoContent)
+	return c.JSON(http.StatusOK, echo.Map{
+		"count": count,
+	})
 }
@@ -152,3 +152,108 @@ func TestRequestItemsSync20190520(t *testing.T) {
 		assert.Empty(t, v.Conflicts)
 	})
 }
+
+func TestRequestItemsFirstSync20190520(t *testing.T) {
+	engine, ctrl, r, cleanup := setup()
+	defer cleanup()
+
+	user := createUser(ctrl)
+	header := gofight.H{
+		"Authorization": "Bearer " + server.CreateJWT(ctrl, user),
+	}
+
+	// Items and notes are listed most recently updated first.
+	var ids, notes []string
+	items := map[string]*model.Item{}
+	for i := range 6 {
+		item := &model.Item{UserID: user.ID, Content: "004:note", ContentType: libsf.ContentTypeNote}
+		switch i {
+		case 0:
+			item.ContentType = libsf.ContentTypeItemsKey
+		case 1:
+			item.Deleted = true
+		}
+		if err := ctrl.Database.Save(item); err != nil {
+			panic(err)
+		}
+
+		items[item.ID] = item
+		if !item.Deleted {
+			ids = append([]string{item.ID}, ids...)
+		}
+		if i > 1 {
+			notes = append([]string{item.ID}, notes...)
+		}
+	}
+	if err := ctrl.Database.Save(&model.Item{UserID: "b329a187-ddf8-4e9b-960d-49c272a58794", ContentType: libsf.ContentTypeNote}); err != nil {
+		panic(err)
+	}
+
+	retrieved := func(v sync20190520) (ids []string) {
+		for _, item := range v.Retrieved {
+			ids = append(ids, item.ID)
+		}
+		return ids
+	}
+
+	params := gofight.D{
+		"api":   "20190520",
+		"limit": 1,
+		"items": []*model.Item{},
+	}
+
+	r.POST("/items/sync").SetHeader(header).SetJSON(params).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+		assert.Equal(t, "application/json", r.HeaderMap.Get("Content-Type"))
+
+		var v sync20190520
+		err := json.Unmarshal(r.Body.Bytes(), &v)
+		assert.NoError(t, err)
+
+		// The limit is ignored and the deleted items are not retrieved.
+		assert.Equal(t, ids, retrieved(v))
+		assert.Empty(t, v.Saved)
+		assert.Empty(t, v.Conflicts)
+		assert.Empty(t, v.CursorToken)
+		assert.NotEmpty(t, v.SyncToken)
+	})
+
+	params["content_type"] = libsf.ContentTypeNote
+	r.POST("/items/sync").SetHeader(header).SetJSON(params).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+
+		var v sync20190520
+		err := json.Unmarshal(r.Body.Bytes(), &v)
+		assert.NoError(t, err)
+
+		assert.Equal(t, notes, retrieved(v))
+	})
+
+	// A stale incoming item is conflicted and the server one is not retrieved.
+	stale := *items[notes[3]]
+	staleAt := stale.UpdatedAt.Add(-time.Minute)
+	stale.UpdatedAt = &staleAt
+	// A saved item is retrieved as it was before being saved, in its previous place.
+	updated := *items[notes[1]]
+	updated.Content = "004:updated"
+	params["items"] = []*model.Item{&stale, &updated}
+	r.POST("/items/sync").SetHeader(header).SetJSON(params).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+
+		var v sync20190520
+		err := json.Unmarshal(r.Body.Bytes(), &v)
+		assert.NoError(t, err)
+
+		assert.Equal(t, notes[:3], retrieved(v))
+		for _, item := range v.Retrieved {
+			assert.Equal(t, "004:note", item.Content)
+		}
+		if assert.Len(t, v.Saved, 1) {
+			assert.Equal(t, updated.ID, v.Saved[0].ID)
+		}
+		if assert.Len(t, v.Conflicts, 1) {
+			assert.Equal(t, "sync_conflict", v.Conflicts[0].Type)
+			assert.Equal(t, stale.ID, v.Conflicts[0].ServerItem.ID)
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package server_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/appleboy/gofight/v2"
+	"github.com/mdouchement/standardfile/internal/model"
+	"github.com/mdouchement/standardfile/internal/server"
+	"github.com/mdouchement/standardfile/pkg/libsf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestItemsDelete(t *testing.T) {
+	engine, ctrl, r, cleanup := setup()
+	defer cleanup()
+
+	r.DELETE("/items").Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusUnauthorized, r.Code)
+	})
+
+	user := createUser(ctrl)
+	header := gofight.H{
+		"Authorization": "Bearer " + server.CreateJWT(ctrl, user),
+	}
+
+	items := make([]*model.Item, 3)
+	for i := range items {
+		items[i] = &model.Item{
+			UserID:           user.ID,
+			Content:          "004:component",
+			EncryptedItemKey: "004:key",
+			ContentType:      libsf.ContentTypeComponent,
+		}
+		assert.NoError(t, ctrl.Database.Save(items[i]))
+	}
+
+	other := &model.Item{UserID: "b329a187-ddf8-4e9b-960d-49c272a58794", Content: "004:other", ContentType: libsf.ContentTypeNote}
+	assert.NoError(t, ctrl.Database.Save(other))
+
+	r.DELETE("/items").SetHeader(header).SetJSON(gofight.D{}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusBadRequest, r.Code)
+		assert.JSONEq(t, `{"error":{"message":"Please provide the items to delete."}}`, r.Body.String())
+	})
+
+	r.DELETE("/items").SetHeader(header).SetJSON(gofight.D{
+		"uuids": []string{items[0].ID, other.ID, items[0].ID},
+	}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+		assert.JSONEq(t, `{"count":1}`, r.Body.String())
+	})
+
+	item, err := ctrl.Database.FindItem(items[0].ID)
+	assert.NoError(t, err)
+	assert.True(t, item.Deleted)
+	assert.Empty(t, item.Content)
+	assert.Empty(t, item.EncryptedItemKey)
+	assert.True(t, item.UpdatedAt.After(*items[0].UpdatedAt))
+
+	item, err = ctrl.Database.FindItem(other.ID)
+	assert.NoError(t, err)
+	assert.False(t, item.Deleted)
+
+	r.DELETE("/items").SetHeader(header).SetJSON(gofight.D{
+		"all": true,
+	}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+		assert.JSONEq(t, `{"count":2}`, r.Body.String())
+	})
+
+	for _, item := range items {
+		item, err = ctrl.Database.FindItem(item.ID)
+		assert.NoError(t, err)
+		assert.True(t, item.Deleted)
+	}
+
+	r.DELETE("/items").SetHeader(header).SetJSON(gofight.D{
+		"all": true,
+	}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+		assert.JSONEq(t, `{"count":0}`, r.Body.String())
+	})
+}
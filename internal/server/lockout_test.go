@@ -0,0 +1,144 @@
+package server_test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gofight/v2"
+	"github.com/labstack/echo/v4"
+	"github.com/mdouchement/standardfile/internal/server"
+	"github.com/mdouchement/standardfile/internal/server/service"
+	"github.com/mdouchement/standardfile/pkg/libsf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestLoginLockout(t *testing.T) {
+	engine, ctrl, r, cleanup := setup()
+	defer cleanup()
+
+	ctrl.Lockout = service.LockoutPolicy{
+		MaxAttempts:   2,
+		MaxIPAttempts: 3,
+		Duration:      time.Minute,
+		MaxDuration:   time.Hour,
+	}
+	engine = server.EchoEngine(ctrl)
+	createUser(ctrl)
+
+	login := func(email, password, ip string, status int) {
+		r.POST("/auth/sign_in").SetHeader(gofight.H{
+			"X-Forwarded-For": ip, // gofight requests have no remote address so they are handled like unix socket ones
+		}).SetJSON(gofight.D{
+			"api":      libsf.APIVersion20200115,
+			"email":    email,
+			"password": password,
+		}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, status, r.Code)
+			if status == http.StatusLocked {
+				assert.JSONEq(t, `{"error":{"message":"Too many successive login requests. Please try your request again later."}}`, r.Body.String())
+			}
+		})
+	}
+
+	// A success forgets the failures.
+	login("george.abitbol@nowhere.lan", "wrong", "10.0.0.1", http.StatusUnauthorized)
+	login("george.abitbol@nowhere.lan", "password42", "10.0.0.2", http.StatusOK)
+
+	// Account lockout, the case variants of the email share the same lock
+	login("george.abitbol@nowhere.lan", "wrong", "10.0.0.3", http.StatusUnauthorized)
+	login(" George.Abitbol@Nowhere.LAN", "wrong", "10.0.0.4", http.StatusUnauthorized)
+	login("george.abitbol@nowhere.lan", "password42", "10.0.0.5", http.StatusLocked)
+
+	r.GET("/auth/params?email=george.abitbol@nowhere.lan").Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusLocked, r.Code)
+	})
+
+	lock, err := ctrl.Database.FindLock("email:george.abitbol@nowhere.lan")
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), lock.LockedUntil, 5*time.Second)
+
+	// Exponential backoff once the lockout is over
+	lock.LockedUntil = time.Now()
+	assert.NoError(t, ctrl.Database.Save(lock))
+	login("george.abitbol@nowhere.lan", "wrong", "10.0.0.6", http.StatusUnauthorized)
+
+	lock, err = ctrl.Database.FindLock("email:george.abitbol@nowhere.lan")
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(2*time.Minute), lock.LockedUntil, 5*time.Second)
+
+	// IP lockout
+	login("nobody@nowhere.lan", "wrong", "10.0.0.7", http.StatusUnauthorized)
+	login("other@nowhere.lan", "wrong", "10.0.0.7", http.StatusUnauthorized)
+	login("another@nowhere.lan", "wrong", "10.0.0.7", http.StatusUnauthorized)
+	login("nobody@nowhere.lan", "wrong", "10.0.0.7", http.StatusLocked)
+	login("nobody@nowhere.lan", "wrong", "10.0.0.8", http.StatusUnauthorized)
+}
+
+func TestLockoutConcurrentFailures(t *testing.T) {
+	_, ctrl, _, cleanup := setup()
+	defer cleanup()
+
+	lockout := service.NewLockout(ctrl.Database, service.LockoutPolicy{
+		MaxAttempts: 100,
+		Duration:    time.Minute,
+		MaxDuration: time.Hour,
+	})
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, lockout.Fail("george.abitbol@nowhere.lan", "10.0.0.1"))
+		}()
+	}
+	wg.Wait()
+
+	lock, err := ctrl.Database.FindLock("email:george.abitbol@nowhere.lan")
+	assert.NoError(t, err)
+	assert.Equal(t, 20, lock.Attempts)
+}
+
+func TestRequestLoginLockoutTrustedProxy(t *testing.T) {
+	_, ctrl, _, cleanup := setup()
+	defer cleanup()
+
+	ctrl.Lockout = service.LockoutPolicy{
+		MaxIPAttempts: 1,
+		Duration:      time.Minute,
+		MaxDuration:   time.Hour,
+	}
+	ctrl.TrustedProxies = []*net.IPNet{{IP: net.IPv4(192, 0, 2, 0).To4(), Mask: net.CIDRMask(24, 32)}}
+	engine := server.EchoEngine(ctrl)
+
+	login := func(remote, ip string, status int) {
+		req := httptest.NewRequest(http.MethodPost, "/auth/sign_in", strings.NewReader(`{"api":"20200115","email":"nobody@nowhere.lan","password":"wrong"}`))
+		req.RemoteAddr = remote
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(echo.HeaderXForwardedFor, ip)
+
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, req)
+		assert.Equal(t, status, rec.Code)
+	}
+
+	// Trusted proxy
+	login("192.0.2.1:1234", "198.51.100.1", http.StatusUnauthorized)
+	login("192.0.2.1:1234", "198.51.100.1", http.StatusLocked)
+	login("192.0.2.1:1234", "198.51.100.2", http.StatusUnauthorized)
+
+	// Untrusted proxy
+	login("203.0.113.1:1234", "198.51.100.3", http.StatusUnauthorized)
+	login("203.0.113.1:1234", "198.51.100.4", http.StatusLocked)
+
+	// Unix socket without forwarded address, the clients do not share the socket address lock
+	login("@", "", http.StatusUnauthorized)
+	login("@", "", http.StatusUnauthorized)
+	login("@", "198.51.100.5", http.StatusUnauthorized)
+	login("@", "198.51.100.5", http.StatusLocked)
+}
@@ -0,0 +1,96 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/appleboy/gofight/v2"
+	"github.com/mdouchement/standardfile/pkg/libsf"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestID(t *testing.T) {
+	engine, _, r, cleanup := setup()
+	defer cleanup()
+
+	r.GET("/version").SetHeader(gofight.H{
+		"X-Request-ID": "req-42",
+	}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+		assert.Equal(t, "req-42", r.HeaderMap.Get("X-Request-ID"))
+	})
+
+	r.GET("/version").SetHeader(gofight.H{
+		"X-Request-ID": "req\n42",
+	}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+		assert.Len(t, r.HeaderMap.Get("X-Request-ID"), 36) // Generated UUID
+	})
+
+	r.GET("/version").Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+		assert.Len(t, r.HeaderMap.Get("X-Request-ID"), 36)
+	})
+}
+
+func TestRequestLogger(t *testing.T) {
+	engine, ctrl, r, cleanup := setup()
+	defer cleanup()
+
+	var logs bytes.Buffer
+	logrus.SetOutput(&logs)
+	logrus.SetFormatter(&logrus.JSONFormatter{})
+	defer func() {
+		logrus.SetOutput(os.Stderr)
+		logrus.SetFormatter(&logrus.TextFormatter{})
+	}()
+
+	user, session := createUserWithSession(ctrl)
+	token := accessToken(ctrl, session)
+
+	r.POST("/items/sync").SetHeader(gofight.H{
+		"Authorization": "Bearer " + token,
+		"X-Request-ID":  "req-42",
+	}).SetJSON(gofight.D{
+		"api": libsf.APIVersion20200115,
+		"items": []gofight.D{
+			{
+				"uuid":         "1e1e1e1e-1e1e-1e1e-1e1e-1e1e1e1e1e1e",
+				"content":      "secret-content",
+				"content_type": "Note",
+			},
+		},
+	}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+	})
+
+	gofight.New().GET("/v1/sockets?authToken=v2.local.forged").Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusUnauthorized, r.Code)
+	})
+
+	assert.NotContains(t, logs.String(), token)
+	assert.NotContains(t, logs.String(), "forged")
+	assert.NotContains(t, logs.String(), "secret-content")
+
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	if assert.Len(t, lines, 2) {
+		var entry map[string]any
+		assert.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+		assert.Equal(t, "request", entry["msg"])
+		assert.Equal(t, "req-42", entry["request_id"])
+		assert.Equal(t, user.ID, entry["user_id"])
+		assert.Equal(t, session.ID, entry["session_id"])
+		assert.Equal(t, "/items/sync", entry["path"])
+		assert.EqualValues(t, http.StatusOK, entry["status"])
+
+		entry = nil
+		assert.NoError(t, json.Unmarshal([]byte(lines[1]), &entry))
+		assert.Equal(t, "/v1/sockets", entry["path"])
+		assert.NotContains(t, entry, "user_id")
+	}
+}
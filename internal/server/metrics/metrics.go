@@ -0,0 +1,180 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mdouchement/standardfile/internal/database"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+)
+
+const namespace = "standardfile"
+
+// Metrics holds the Prometheus collectors of the server.
+// All the methods are no-op on a nil Metrics so it can be disabled without checks in the handlers.
+type Metrics struct {
+	registry      *prometheus.Registry
+	requests      *prometheus.CounterVec
+	latencies     *prometheus.HistogramVec
+	syncSizes     prometheus.Histogram
+	syncItems     *prometheus.HistogramVec
+	loginFailures prometheus.Counter
+	cleanups      *prometheus.CounterVec
+}
+
+// New instantiates the server metrics.
+// The active sessions and the size of the database are collected on each scrape.
+func New(db database.Client) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Number of HTTP requests by method, route and status.",
+		}, []string{"method", "route", "status"}),
+		latencies: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of HTTP requests by method, route and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		syncSizes: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "sync_request_size_bytes",
+			Help:      "Size of the sync payloads sent by the clients.",
+			Buckets:   prometheus.ExponentialBuckets(256, 4, 10), // 256B to 64MB
+		}),
+		syncItems: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "sync_items",
+			Help:      "Number of items saved or conflicted per sync.",
+			Buckets:   []float64{0, 1, 5, 10, 50, 100, 500, 1000},
+		}, []string{"result"}),
+		loginFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "login_failures_total",
+			Help:      "Number of failed login attempts.",
+		}),
+		cleanups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "janitor_removed_total",
+			Help:      "Number of expired records removed by the janitor.",
+		}, []string{"kind"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.latencies,
+		m.syncSizes,
+		m.syncItems,
+		m.loginFailures,
+		m.cleanups,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "active_sessions",
+			Help:      "Number of sessions not expired.",
+		}, func() float64 {
+			n, err := db.CountActiveSessions()
+			if err != nil {
+				logrus.WithError(err).Error("could not count active sessions")
+				return 0
+			}
+			return float64(n)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "database_size_bytes",
+			Help:      "Size of the database.",
+		}, func() float64 {
+			stats, err := db.Stats()
+			if err != nil {
+				return 0
+			}
+			return float64(stats.Size)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "database_free_pages",
+			Help:      "Number of pages allocated in the database but not used.",
+		}, func() float64 {
+			stats, err := db.Stats()
+			if err != nil {
+				return 0
+			}
+			return float64(stats.FreePages)
+		}),
+	)
+
+	return m
+}
+
+// Handler returns the HTTP handler exposing the metrics.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Middleware returns a middleware that records the requests count and latency.
+// The route template is used as label to keep the cardinality bounded.
+func (m *Metrics) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if m == nil {
+				return next(c)
+			}
+
+			start := time.Now()
+			if err := next(c); err != nil {
+				// Renders the error to know the returned status.
+				c.Error(err)
+			}
+
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			status := strconv.Itoa(c.Response().Status)
+
+			m.requests.WithLabelValues(c.Request().Method, route, status).Inc()
+			m.latencies.WithLabelValues(c.Request().Method, route, status).Observe(time.Since(start).Seconds())
+			return nil
+		}
+	}
+}
+
+// ObserveSync records the payload size and the number of saved and conflicted items of a sync.
+func (m *Metrics) ObserveSync(size int64, saved, conflicted int) {
+	if m == nil {
+		return
+	}
+
+	if size >= 0 {
+		m.syncSizes.Observe(float64(size))
+	}
+	m.syncItems.WithLabelValues("saved").Observe(float64(saved))
+	m.syncItems.WithLabelValues("conflicted").Observe(float64(conflicted))
+}
+
+// LoginFailed records a failed login attempt.
+func (m *Metrics) LoginFailed() {
+	if m == nil {
+		return
+	}
+
+	m.loginFailures.Inc()
+}
+
+// Cleaned records the number of expired records of the given kind removed by the janitor.
+func (m *Metrics) Cleaned(kind string, n int) {
+	if m == nil {
+		return
+	}
+
+	m.cleanups.WithLabelValues(kind).Add(float64(n))
+}
@@ -0,0 +1,57 @@
+package server_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/appleboy/gofight/v2"
+	"github.com/mdouchement/standardfile/internal/model"
+	"github.com/mdouchement/standardfile/internal/server"
+	"github.com/mdouchement/standardfile/internal/server/metrics"
+	"github.com/mdouchement/standardfile/pkg/libsf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	engine, ctrl, r, cleanup := setup()
+	defer cleanup()
+
+	ctrl.Metrics = metrics.New(ctrl.Database)
+	engine = server.EchoEngine(ctrl)
+
+	_, session := createUserWithSession(ctrl)
+
+	r.POST("/v1/login").SetJSON(gofight.D{
+		"api":      libsf.APIVersion20200115,
+		"email":    "george.abitbol@nowhere.lan",
+		"password": "wrong",
+	}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusUnauthorized, r.Code)
+	})
+
+	r.POST("/v1/items").SetHeader(gofight.H{
+		"Authorization": "Bearer " + accessToken(ctrl, session),
+	}).SetJSON(gofight.D{
+		"api":   libsf.APIVersion20200115,
+		"items": []*model.Item{{Content: "004:note", ContentType: libsf.ContentTypeNote}},
+	}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+	})
+
+	ctrl.Metrics.Cleaned("sessions", 2)
+
+	w := httptest.NewRecorder()
+	ctrl.Metrics.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	body := w.Body.String()
+	assert.Contains(t, body, `standardfile_http_requests_total{method="POST",route="/v1/login",status="401"} 1`)
+	assert.Contains(t, body, `standardfile_http_requests_total{method="POST",route="/v1/items",status="200"} 1`)
+	assert.Contains(t, body, `standardfile_login_failures_total 1`)
+	assert.Contains(t, body, `standardfile_sync_items_sum{result="saved"} 1`)
+	assert.Contains(t, body, `standardfile_sync_items_sum{result="conflicted"} 0`)
+	assert.Contains(t, body, `standardfile_sync_request_size_bytes_count 1`)
+	assert.Contains(t, body, `standardfile_active_sessions 1`)
+	assert.Contains(t, body, `standardfile_janitor_removed_total{kind="sessions"} 2`)
+}
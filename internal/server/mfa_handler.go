@@ -0,0 +1,130 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mdouchement/standardfile/internal/model"
+	"github.com/mdouchement/standardfile/internal/server/service"
+	"github.com/mdouchement/standardfile/internal/sferror"
+)
+
+type (
+	// mfa contains all two-factor authentication handlers.
+	mfa struct {
+		mfa    service.MFAService
+		audits service.AuditService
+	}
+
+	mfaParams struct {
+		Secret string `json:"secret"`
+		Code   string `json:"mfa_code"`
+	}
+)
+
+// Show returns the two-factor authentication status of the current user.
+func (h *mfa) Show(c echo.Context) error {
+	user := currentUser(c)
+	if c.Param("id") != user.ID {
+		return c.JSON(http.StatusUnauthorized, sferror.New("The given ID is not the user's one."))
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"enabled":              h.mfa.Enabled(user),
+		"recovery_codes_count": len(user.MFARecoveryCodes),
+	})
+}
+
+// Secret generates a new secret to enroll in an authenticator application.
+// The secret is not stored until it is confirmed by Enable.
+func (h *mfa) Secret(c echo.Context) error {
+	user := currentUser(c)
+	if c.Param("id") != user.ID {
+		return c.JSON(http.StatusUnauthorized, sferror.New("The given ID is not the user's one."))
+	}
+
+	secret, err := h.mfa.GenerateSecret(user)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, secret)
+}
+
+// Enable enables the two-factor authentication and returns the recovery codes.
+func (h *mfa) Enable(c echo.Context) error {
+	user := currentUser(c)
+	if c.Param("id") != user.ID {
+		return c.JSON(http.StatusUnauthorized, sferror.New("The given ID is not the user's one."))
+	}
+
+	var params mfaParams
+	if err := c.Bind(&params); err != nil || params.Secret == "" || params.Code == "" {
+		return c.JSON(http.StatusBadRequest, sferror.NewWithTagCode(
+			http.StatusBadRequest,
+			"invalid-parameters",
+			"Please provide the secret and the two-factor authentication code.",
+		))
+	}
+
+	codes, err := h.mfa.Enable(user, params.Secret, params.Code)
+	if err != nil {
+		return err
+	}
+	record(c, h.audits, model.AuditMFAEnabled, user.ID, currentSessionID(c))
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"recovery_codes": codes,
+	})
+}
+
+// Disable disables the two-factor authentication.
+func (h *mfa) Disable(c echo.Context) error {
+	user := currentUser(c)
+	if c.Param("id") != user.ID {
+		return c.JSON(http.StatusUnauthorized, sferror.New("The given ID is not the user's one."))
+	}
+
+	var params mfaParams
+	if err := c.Bind(&params); err != nil || params.Code == "" {
+		return c.JSON(http.StatusBadRequest, sferror.NewWithTagCode(
+			http.StatusBadRequest,
+			"invalid-parameters",
+			"Please provide the two-factor authentication code.",
+		))
+	}
+
+	if err := h.mfa.Disable(user, params.Code); err != nil {
+		return err
+	}
+	record(c, h.audits, model.AuditMFADisabled, user.ID, currentSessionID(c))
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RecoveryCodes regenerates the recovery codes, the previous ones are revoked.
+func (h *mfa) RecoveryCodes(c echo.Context) error {
+	user := currentUser(c)
+	if c.Param("id") != user.ID {
+		return c.JSON(http.StatusUnauthorized, sferror.New("The given ID is not the user's one."))
+	}
+
+	var params mfaParams
+	if err := c.Bind(&params); err != nil || params.Code == "" {
+		return c.JSON(http.StatusBadRequest, sferror.NewWithTagCode(
+			http.StatusBadRequest,
+			"invalid-parameters",
+			"Please provide the two-factor authentication code.",
+		))
+	}
+
+	codes, err := h.mfa.RecoveryCodes(user, params.Code)
+	if err != nil {
+		return err
+	}
+	record(c, h.audits, model.AuditMFARecoveryCodes, user.ID, currentSessionID(c))
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"recovery_codes": codes,
+	})
+}
@@ -0,0 +1,147 @@
+package server_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gofight/v2"
+	"github.com/mdouchement/standardfile/internal/totp"
+	"github.com/mdouchement/standardfile/pkg/libsf"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fastjson"
+)
+
+func TestRequestMFA(t *testing.T) {
+	engine, ctrl, r, cleanup := setup()
+	defer cleanup()
+
+	user, session := createUserWithSession(ctrl)
+	header := gofight.H{
+		"Authorization": "Bearer " + accessToken(ctrl, session),
+	}
+
+	r.GET("/v1/users/"+user.ID+"/mfa").SetHeader(header).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+		assert.JSONEq(t, `{"enabled":false,"recovery_codes_count":0}`, r.Body.String())
+	})
+
+	//
+	// Enrollment
+	//
+
+	var secret string
+	r.GET("/v1/users/"+user.ID+"/mfa/secret").SetHeader(header).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+
+		v, err := fastjson.Parse(r.Body.String())
+		assert.NoError(t, err)
+
+		secret = string(v.GetStringBytes("secret"))
+		assert.Len(t, secret, 32)
+		assert.Contains(t, string(v.GetStringBytes("uri")), "otpauth://totp/StandardFile:george.abitbol@nowhere.lan?")
+	})
+
+	r.PUT("/v1/users/"+user.ID+"/mfa").SetHeader(header).SetJSON(gofight.D{
+		"secret":   secret,
+		"mfa_code": "000000",
+	}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusUnauthorized, r.Code)
+		assert.Contains(t, r.Body.String(), `"tag":"mfa-invalid"`)
+	})
+
+	code, err := totp.Code(secret, time.Now())
+	assert.NoError(t, err)
+
+	var recoveryCodes []string
+	r.PUT("/v1/users/"+user.ID+"/mfa").SetHeader(header).SetJSON(gofight.D{
+		"secret":   secret,
+		"mfa_code": code,
+	}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+
+		v, err := fastjson.Parse(r.Body.String())
+		assert.NoError(t, err)
+
+		for _, code := range v.GetArray("recovery_codes") {
+			recoveryCodes = append(recoveryCodes, string(code.GetStringBytes()))
+		}
+		assert.Len(t, recoveryCodes, 10)
+	})
+
+	u, err := ctrl.Database.FindUser(user.ID)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, u.MFASecret)
+	assert.NotContains(t, u.MFASecret, secret) // Encrypted at rest
+	assert.NotContains(t, u.MFARecoveryCodes, recoveryCodes[0])
+
+	//
+	// Params & login
+	//
+
+	var key string
+	r.GET("/auth/params?email=george.abitbol@nowhere.lan").Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusUnauthorized, r.Code)
+
+		v, err := fastjson.Parse(r.Body.String())
+		assert.NoError(t, err)
+
+		assert.Equal(t, "mfa-required", string(v.GetStringBytes("error", "tag")))
+		key = string(v.GetStringBytes("error", "payload", "mfa_key"))
+		assert.Regexp(t, `^mfa_[a-f0-9\-]{36}$`, key)
+	})
+
+	r.GET("/auth/params?email=george.abitbol@nowhere.lan&"+key+"=000000").Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusUnauthorized, r.Code)
+		assert.JSONEq(t, `{"error":{"tag":"mfa-invalid","message":"The two-factor authentication code you entered is incorrect. Please try again.","payload":{"mfa_key":"`+key+`"}}}`, r.Body.String())
+	})
+
+	r.GET("/auth/params?email=george.abitbol@nowhere.lan&"+key+"="+code).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+	})
+
+	params := gofight.D{
+		"api":      libsf.APIVersion20200115,
+		"email":    "george.abitbol@nowhere.lan",
+		"password": "password42",
+	}
+	r.POST("/auth/sign_in").SetJSON(params).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusUnauthorized, r.Code)
+		assert.Contains(t, r.Body.String(), `"tag":"mfa-required"`)
+	})
+
+	params[key] = code
+	r.POST("/auth/sign_in").SetJSON(params).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+	})
+
+	// A recovery code can only be used once.
+	params[key] = recoveryCodes[0]
+	r.POST("/auth/sign_in").SetJSON(params).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+	})
+	r.POST("/auth/sign_in").SetJSON(params).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusUnauthorized, r.Code)
+		assert.Contains(t, r.Body.String(), `"tag":"mfa-invalid"`)
+	})
+
+	r.GET("/v1/users/"+user.ID+"/mfa").SetHeader(header).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+		assert.JSONEq(t, `{"enabled":true,"recovery_codes_count":9}`, r.Body.String())
+	})
+
+	//
+	// Disable
+	//
+
+	r.DELETE("/v1/users/"+user.ID+"/mfa").SetHeader(header).SetJSON(gofight.D{
+		"mfa_code": recoveryCodes[1],
+	}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusNoContent, r.Code)
+	})
+
+	delete(params, key)
+	r.POST("/auth/sign_in").SetJSON(params).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+	})
+}
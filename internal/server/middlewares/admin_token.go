@@ -0,0 +1,23 @@
+package middlewares
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mdouchement/standardfile/internal/sferror"
+)
+
+// AdminToken returns a middleware that only accepts the requests authenticated with the given bearer token.
+func AdminToken(expected string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			given := []byte(token(c.Request().Header.Get(echo.HeaderAuthorization)))
+			if expected == "" || subtle.ConstantTimeCompare(given, []byte(expected)) != 1 {
+				return c.JSON(http.StatusUnauthorized, sferror.New("Invalid admin token."))
+			}
+
+			return next(c)
+		}
+	}
+}
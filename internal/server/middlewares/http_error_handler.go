@@ -2,7 +2,6 @@ package middlewares
 
 import (
 	"fmt"
-	"log"
 	"net/http"
 
 	"github.com/gofrs/uuid"
@@ -15,7 +14,9 @@ func HTTPErrorHandler(err error, c echo.Context) {
 	if !c.Response().Committed {
 		switch err := err.(type) {
 		case *echo.HTTPError:
-			log.Printf("Error [ECHO]: %s", err.Internal)
+			if err.Internal != nil {
+				Logger(c).WithError(err.Internal).Warn("echo error")
+			}
 			_ = c.JSON(err.Code, echo.Map{
 				"error": echo.Map{
 					"message": err.Message,
@@ -35,9 +36,13 @@ func HTTPErrorHandler(err error, c echo.Context) {
 	}
 }
 
+// internal renders an unexpected error, the ID returned to the client is the request ID used in the logs.
 func internal(err error, c echo.Context) {
-	id := uuid.Must(uuid.NewV4()).String()
-	log.Printf("Error [%s]: %s", id, err.Error())
+	id, ok := c.Get(RequestIDContextKey).(string)
+	if !ok {
+		id = uuid.Must(uuid.NewV4()).String()
+	}
+	Logger(c).WithError(err).Error("unexpected error")
 
 	_ = c.JSON(http.StatusInternalServerError, echo.Map{
 		"error": echo.Map{
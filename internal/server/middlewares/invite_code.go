@@ -0,0 +1,28 @@
+package middlewares
+
+import (
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HeaderInviteCode is the header holding the registration invite code.
+const HeaderInviteCode = "X-Invite-Code"
+
+// InviteCode returns a middleware that moves the invite code of `/invite/:code/...' URLs to the X-Invite-Code header.
+// The official clients can't send an invite code, so `https://host/invite/:code' is used as sync server URL to register.
+func InviteCode() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			r := c.Request()
+			if rest, ok := strings.CutPrefix(r.URL.Path, "/invite/"); ok {
+				code, path, _ := strings.Cut(rest, "/")
+				r.Header.Set(HeaderInviteCode, code)
+				r.URL.Path = "/" + path
+				r.URL.RawPath = ""
+			}
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package middlewares
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// IPExtractor returns an extractor of the client IP address.
+// The X-Forwarded-For header is only used when the request comes from one of the given trusted proxies.
+// Requests received on a unix socket come from a local reverse proxy, so the address it added to the header is used.
+// Without this header, the IP address is unknown and an empty string is returned.
+func IPExtractor(trusted []*net.IPNet) echo.IPExtractor {
+	options := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, network := range trusted {
+		options = append(options, echo.TrustIPRange(network))
+	}
+	xff := echo.ExtractIPFromXFFHeader(options...)
+
+	return func(r *http.Request) string {
+		if _, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			return xff(r)
+		}
+
+		// Unix socket
+		forwarded := strings.Split(r.Header.Get(echo.HeaderXForwardedFor), ",")
+		if ip := strings.TrimSpace(forwarded[len(forwarded)-1]); net.ParseIP(ip) != nil {
+			return ip
+		}
+		return "" // The socket address is shared by all the clients
+	}
+}
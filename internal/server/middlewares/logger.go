@@ -0,0 +1,69 @@
+package middlewares
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/mdouchement/standardfile/internal/model"
+	"github.com/mdouchement/standardfile/internal/server/session"
+	"github.com/sirupsen/logrus"
+)
+
+// Logger returns the logger of the request.
+// The log lines contain the request ID and the IDs of the authenticated user and session, if any.
+//
+// Items content and tokens must never be logged.
+func Logger(c echo.Context) *logrus.Entry {
+	fields := logrus.Fields{}
+	if id, ok := c.Get(RequestIDContextKey).(string); ok {
+		fields["request_id"] = id
+	}
+
+	if user, ok := c.Get(CurrentUserContextKey).(*model.User); ok && user != nil {
+		fields["user_id"] = user.ID
+	}
+	if session, ok := c.Get(CurrentSessionContextKey).(*model.Session); ok && session != nil {
+		fields["session_id"] = session.ID
+	}
+	if valet, ok := c.Get(CurrentValetContextKey).(*session.Valet); ok && valet != nil {
+		fields["user_id"] = valet.UserID
+	}
+
+	return logrus.WithFields(fields)
+}
+
+// RequestLogger returns a middleware that logs the served requests.
+// The query string is not logged because it may contain a token (e.g. WebSocket authentication).
+func RequestLogger() echo.MiddlewareFunc {
+	return middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
+		LogStatus:        true,
+		LogMethod:        true,
+		LogURIPath:       true,
+		LogLatency:       true,
+		LogContentLength: true,
+		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
+			entry := Logger(c).WithFields(logrus.Fields{
+				"status":  v.Status,
+				"method":  v.Method,
+				"path":    v.URIPath,
+				"latency": v.Latency.String(),
+			})
+			if v.ContentLength != "" {
+				entry = entry.WithField("content_length", v.ContentLength)
+			}
+
+			entry.Info("request")
+			return nil
+		},
+	})
+}
+
+// Recover returns a middleware that recovers from panics and logs them with their stack.
+func Recover() echo.MiddlewareFunc {
+	return middleware.RecoverWithConfig(middleware.RecoverConfig{
+		DisableStackAll: true,
+		LogErrorFunc: func(c echo.Context, err error, stack []byte) error {
+			Logger(c).WithError(err).WithField("stack", string(stack)).Error("panic recovered")
+			return err
+		},
+	})
+}
@@ -0,0 +1,21 @@
+package middlewares
+
+import (
+	"github.com/labstack/echo/v4"
+)
+
+// QueryToken returns a middleware that uses the given query parameter as bearer token
+// when no Authorization header is provided.
+// Browsers can't set headers when they open a WebSocket.
+func QueryToken(param string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			header := c.Request().Header
+			if token := c.QueryParam(param); token != "" && header.Get(echo.HeaderAuthorization) == "" {
+				header.Set(echo.HeaderAuthorization, "Bearer "+token)
+			}
+
+			return next(c)
+		}
+	}
+}
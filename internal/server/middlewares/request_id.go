@@ -0,0 +1,49 @@
+package middlewares
+
+import (
+	"github.com/gofrs/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// RequestIDContextKey is the key to retrieve the request_id from echo.Context.
+	RequestIDContextKey = "request_id"
+
+	maxRequestIDLength = 128
+)
+
+// RequestID returns a middleware that identifies the requests.
+// The X-Request-ID header of the request is used when it is valid, otherwise a new ID is generated.
+// The ID is sent back in the X-Request-ID header of the response.
+// It stores request_id into echo.Context
+func RequestID() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			id := c.Request().Header.Get(echo.HeaderXRequestID)
+			if !validRequestID(id) {
+				id = uuid.Must(uuid.NewV4()).String()
+			}
+
+			c.Response().Header().Set(echo.HeaderXRequestID, id)
+			c.Set(RequestIDContextKey, id)
+			return next(c)
+		}
+	}
+}
+
+// validRequestID prevents clients from injecting arbitrary content in the logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, r := range id {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,29 @@
+package middlewares
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/mdouchement/standardfile/internal/server/session"
+)
+
+const (
+	// HeaderValetToken is the header containing the valet token used by the files endpoints.
+	HeaderValetToken = "X-Valet-Token"
+	// CurrentValetContextKey is the key to retrieve the current_valet from echo.Context.
+	CurrentValetContextKey = "current_valet"
+)
+
+// ValetToken returns a valet token auth middleware used by the files endpoints.
+// It stores current_valet into echo.Context
+func ValetToken(m session.Manager) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			valet, err := m.ParseValetToken(c.Request().Header.Get(HeaderValetToken))
+			if err != nil {
+				return err
+			}
+
+			c.Set(CurrentValetContextKey, valet)
+			return next(c)
+		}
+	}
+}
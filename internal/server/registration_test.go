@@ -0,0 +1,87 @@
+package server_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gofight/v2"
+	"github.com/mdouchement/standardfile/internal/server"
+	"github.com/mdouchement/standardfile/internal/server/service"
+	"github.com/mdouchement/standardfile/pkg/libsf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestRegisterInviteOnly(t *testing.T) {
+	engine, ctrl, r, cleanup := setup()
+	defer cleanup()
+
+	ctrl.Registration = service.RegistrationPolicy{
+		InviteOnly:     true,
+		AllowedDomains: []string{"@Nowhere.lan"},
+	}
+	engine = server.EchoEngine(ctrl)
+
+	invites := service.NewInvite(ctrl.Database, ctrl.Registration)
+	invite, err := invites.Create(2, time.Hour)
+	assert.NoError(t, err)
+
+	register := func(path, email string, params gofight.D, status int, message string) {
+		body := gofight.D{
+			"api":      libsf.APIVersion20200115,
+			"email":    email,
+			"password": "password42",
+			"pw_nonce": "nonce42",
+			"version":  libsf.ProtocolVersion4,
+		}
+		for k, v := range params {
+			body[k] = v
+		}
+
+		r.POST(path).SetJSON(body).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, status, r.Code)
+			if message != "" {
+				assert.JSONEq(t, fmt.Sprintf(`{"error":{"message":"%s"}}`, message), r.Body.String())
+			}
+		})
+	}
+
+	register("/v1/users", "george.abitbol@elsewhere.lan", gofight.D{"invite_code": invite.Code}, http.StatusUnauthorized, "This email address is not allowed to register.")
+	register("/v1/users", "george.abitbol@nowhere.lan", nil, http.StatusUnauthorized, "A valid invite code is required to register.")
+	register("/v1/users", "george.abitbol@nowhere.lan", gofight.D{"invite_code": "unknown"}, http.StatusUnauthorized, "A valid invite code is required to register.")
+
+	// Body parameter
+	register("/v1/users", "george.abitbol@nowhere.lan", gofight.D{"invite_code": invite.Code}, http.StatusOK, "")
+	// A failed registration does not use the invite.
+	register("/v1/users", "george.abitbol@nowhere.lan", gofight.D{"invite_code": invite.Code}, http.StatusUnauthorized, "This email is already registered.")
+	// URL prefix used by the official clients
+	register("/invite/"+invite.Code+"/v1/users", "jean.dujardin@NOWHERE.lan", nil, http.StatusOK, "")
+	register("/invite/"+invite.Code+"/v1/users", "dominique.farrugia@nowhere.lan", nil, http.StatusUnauthorized, "A valid invite code is required to register.")
+
+	v, err := ctrl.Database.FindInvite(invite.Code)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, v.Uses)
+
+	// The prefix is also removed from the other requests.
+	r.GET("/invite/"+invite.Code+"/version").Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+		assert.JSONEq(t, `{"version":"test"}`, r.Body.String())
+	})
+
+	// Expired invite
+	expired, err := invites.Create(1, time.Nanosecond)
+	assert.NoError(t, err)
+	register("/v1/users", "dominique.farrugia@nowhere.lan", gofight.D{"invite_code": expired.Code}, http.StatusUnauthorized, "A valid invite code is required to register.")
+
+	// Revoked invite
+	revoked, err := invites.Create(1, 0)
+	assert.NoError(t, err)
+	assert.Nil(t, revoked.ExpireAt)
+	assert.NoError(t, invites.Revoke(revoked.Code))
+	register("/v1/users", "dominique.farrugia@nowhere.lan", gofight.D{"invite_code": revoked.Code}, http.StatusUnauthorized, "A valid invite code is required to register.")
+
+	list, err := invites.List()
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+}
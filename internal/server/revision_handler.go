@@ -0,0 +1,39 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mdouchement/standardfile/internal/database"
+	"github.com/mdouchement/standardfile/internal/server/serializer"
+	"github.com/mdouchement/standardfile/internal/sferror"
+	"github.com/pkg/errors"
+)
+
+// revision contains all item revision handlers.
+type revision struct {
+	db database.Client
+}
+
+// List lists all the revisions of an item.
+func (h *revision) List(c echo.Context) error {
+	revisions, err := h.db.FindRevisionsByItemID(c.Param("item_id"), currentUser(c).ID)
+	if err != nil {
+		return errors.Wrap(err, "could not get item revisions")
+	}
+
+	return c.JSON(http.StatusOK, serializer.RevisionEntries(revisions))
+}
+
+// Show returns the content of an item's revision.
+func (h *revision) Show(c echo.Context) error {
+	revision, err := h.db.FindRevisionByItemID(c.Param("id"), c.Param("item_id"), currentUser(c).ID)
+	if err != nil {
+		if h.db.IsNotFound(err) {
+			return c.JSON(http.StatusNotFound, sferror.New("Revision not found."))
+		}
+		return errors.Wrap(err, "could not get item revision")
+	}
+
+	return c.JSON(http.StatusOK, serializer.Revision(revision))
+}
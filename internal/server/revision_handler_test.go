@@ -0,0 +1,169 @@
+package server_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gofight/v2"
+	"github.com/gofrs/uuid"
+	"github.com/mdouchement/standardfile/internal/model"
+	"github.com/mdouchement/standardfile/internal/server"
+	"github.com/mdouchement/standardfile/pkg/libsf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestItemRevisions(t *testing.T) {
+	engine, ctrl, r, cleanup := setup()
+	defer cleanup()
+
+	ctrl.RevisionRetention.Count = 2
+	engine = server.EchoEngine(ctrl)
+
+	r.GET("/v1/items/42/revisions").Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusUnauthorized, r.Code)
+	})
+
+	user, session := createUserWithSession(ctrl)
+	header := gofight.H{
+		"Authorization": "Bearer " + accessToken(ctrl, session),
+	}
+
+	item := &model.Item{
+		UserID:      user.ID,
+		Content:     "004:v0",
+		ContentType: libsf.ContentTypeNote,
+	}
+	err := ctrl.Database.Save(item)
+	assert.NoError(t, err)
+
+	//
+	// Each update keeps the previous version.
+	//
+
+	for _, content := range []string{"004:v1", "004:v2", "004:v3"} {
+		item.Content = content
+
+		r.POST("/v1/items").SetHeader(header).SetJSON(gofight.D{
+			"api":   "20200115",
+			"items": []*model.Item{item},
+		}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+
+			var v sync20190520
+			err := json.Unmarshal(r.Body.Bytes(), &v)
+			assert.NoError(t, err)
+			assert.Len(t, v.Saved, 1)
+			assert.Empty(t, v.Conflicts)
+
+			item.UpdatedAt = v.Saved[0].UpdatedAt
+		})
+	}
+
+	var revisions []map[string]any
+	r.GET("/v1/items/"+item.ID+"/revisions").SetHeader(header).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+
+		err := json.Unmarshal(r.Body.Bytes(), &revisions)
+		assert.NoError(t, err)
+		assert.Len(t, revisions, 2) // Retention count
+		assert.Equal(t, libsf.ContentTypeNote, revisions[0]["content_type"])
+		assert.NotContains(t, revisions[0], "content")
+	})
+
+	r.GET("/v1/items/"+item.ID+"/revisions/"+revisions[0]["uuid"].(string)).SetHeader(header).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+
+		var v map[string]any
+		err := json.Unmarshal(r.Body.Bytes(), &v)
+		assert.NoError(t, err)
+		assert.Equal(t, item.ID, v["item_uuid"])
+		assert.Equal(t, "004:v2", v["content"])
+	})
+
+	r.GET("/items/"+item.ID+"/revisions/42").SetHeader(header).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusNotFound, r.Code)
+		assert.JSONEq(t, `{"error":{"message":"Revision not found."}}`, r.Body.String())
+	})
+
+	//
+	// Revisions are dropped with the item.
+	//
+
+	item.Deleted = true
+	r.POST("/v1/items").SetHeader(header).SetJSON(gofight.D{
+		"api":   "20200115",
+		"items": []*model.Item{item},
+	}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+	})
+
+	r.GET("/items/"+item.ID+"/revisions").SetHeader(header).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+		assert.JSONEq(t, `[]`, r.Body.String())
+	})
+}
+
+func TestRequestItemRevisionsRetention(t *testing.T) {
+	engine, ctrl, r, cleanup := setup()
+	defer cleanup()
+
+	ctrl.RevisionRetention.Count = 3
+	engine = server.EchoEngine(ctrl)
+
+	user, session := createUserWithSession(ctrl)
+	header := gofight.H{
+		"Authorization": "Bearer " + accessToken(ctrl, session),
+	}
+
+	item := &model.Item{
+		UserID:      user.ID,
+		Content:     "004:v5",
+		ContentType: libsf.ContentTypeNote,
+	}
+	err := ctrl.Database.Save(item)
+	assert.NoError(t, err)
+
+	// Older revisions, one per hour, with nanoseconds decreasing over time.
+	base := time.Now().Truncate(time.Second)
+	for i := range 5 {
+		createdAt := base.Add(time.Duration(i-5)*time.Hour + time.Duration(5-i)*time.Microsecond)
+		revision := model.NewRevision(item)
+		revision.ID = uuid.Must(uuid.NewV4()).String()
+		revision.Content = fmt.Sprintf("004:v%d", i)
+		revision.CreatedAt = &createdAt
+		revision.UpdatedAt = &createdAt
+		assert.NoError(t, ctrl.Database.Import(revision))
+	}
+
+	item.Content = "004:v6"
+	r.POST("/v1/items").SetHeader(header).SetJSON(gofight.D{
+		"api":   "20200115",
+		"items": []*model.Item{item},
+	}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+	})
+
+	// The most recent revisions are kept, most recent first.
+	revisions, err := ctrl.Database.FindRevisionsByItemID(item.ID, user.ID)
+	assert.NoError(t, err)
+	var contents []string
+	for _, revision := range revisions {
+		contents = append(contents, revision.Content)
+	}
+	assert.Equal(t, []string{"004:v5", "004:v4", "004:v3"}, contents)
+
+	r.GET("/v1/items/"+item.ID+"/revisions").SetHeader(header).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+
+		var v []map[string]any
+		err := json.Unmarshal(r.Body.Bytes(), &v)
+		assert.NoError(t, err)
+		if assert.Len(t, v, 3) {
+			assert.Equal(t, revisions[0].ID, v[0]["uuid"])
+			assert.Equal(t, revisions[2].ID, v[2]["uuid"])
+		}
+	})
+}
@@ -0,0 +1,24 @@
+package serializer
+
+import "github.com/mdouchement/standardfile/internal/model"
+
+// AuditEvent serializes the render of an audit event.
+func AuditEvent(m *model.AuditEvent) map[string]any {
+	return map[string]any{
+		"uuid":         m.ID,
+		"type":         m.Type,
+		"created_at":   m.CreatedAt.UTC(),
+		"ip":           m.IP,
+		"user_agent":   m.UserAgent,
+		"session_uuid": m.SessionID,
+	}
+}
+
+// AuditEvents serializes the render of audit events.
+func AuditEvents(m []*model.AuditEvent) []map[string]any {
+	events := make([]map[string]any, len(m))
+	for i, e := range m {
+		events[i] = AuditEvent(e)
+	}
+	return events
+}
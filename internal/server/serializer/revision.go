@@ -0,0 +1,48 @@
+package serializer
+
+import (
+	"time"
+
+	"github.com/mdouchement/standardfile/internal/model"
+)
+
+// Revision serializes the render of a revision.
+func Revision(m *model.Revision) map[string]any {
+	r := RevisionEntry(m)
+	r["item_uuid"] = m.ItemID
+	r["content"] = m.Content
+	r["items_key_id"] = m.ItemsKeyID
+	r["enc_item_key"] = m.EncryptedItemKey
+	r["auth_hash"] = nil
+	r["creation_date"] = versionDate(m).Format("2006-01-02")
+	return r
+}
+
+// RevisionEntry serializes the render of a revision without its content.
+func RevisionEntry(m *model.Revision) map[string]any {
+	// The date displayed by the clients is the one of the item's version, not the date of the snapshot.
+	t := versionDate(m)
+	return map[string]any{
+		"uuid":          m.ID,
+		"content_type":  m.ContentType,
+		"created_at":    t,
+		"updated_at":    t,
+		"required_role": "CORE_USER",
+	}
+}
+
+// RevisionEntries serializes the render of revisions without their content.
+func RevisionEntries(m []*model.Revision) []map[string]any {
+	revisions := make([]map[string]any, len(m))
+	for i, r := range m {
+		revisions[i] = RevisionEntry(r)
+	}
+	return revisions
+}
+
+func versionDate(m *model.Revision) time.Time {
+	if m.ItemUpdatedAt != nil {
+		return m.ItemUpdatedAt.UTC()
+	}
+	return m.CreatedAt.UTC()
+}
@@ -0,0 +1,33 @@
+package serializer
+
+import (
+	"github.com/mdouchement/standardfile/internal/model"
+)
+
+// Setting serializes the render of a setting.
+// The value of a sensitive setting is never rendered.
+func Setting(m *model.Setting) map[string]any {
+	r := map[string]any{
+		"uuid":      m.ID,
+		"name":      m.Name,
+		"value":     m.Value,
+		"sensitive": m.Sensitive,
+		"createdAt": m.CreatedAt.UTC().UnixMilli(),
+		"updatedAt": m.UpdatedAt.UTC().UnixMilli(),
+	}
+
+	if m.Sensitive {
+		r["value"] = nil
+	}
+
+	return r
+}
+
+// Settings serializes the render of settings.
+func Settings(m []*model.Setting) []map[string]any {
+	settings := make([]map[string]any, len(m))
+	for i, s := range m {
+		settings[i] = Setting(s)
+	}
+	return settings
+}
@@ -2,17 +2,22 @@ package server
 
 import (
 	"fmt"
-	"log"
+	"net"
 	"net/http"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/mdouchement/standardfile/internal/database"
 	"github.com/mdouchement/standardfile/internal/model"
+	"github.com/mdouchement/standardfile/internal/server/metrics"
 	"github.com/mdouchement/standardfile/internal/server/middlewares"
+	"github.com/mdouchement/standardfile/internal/server/service"
 	"github.com/mdouchement/standardfile/internal/server/session"
+	"github.com/mdouchement/standardfile/internal/storage"
+	"github.com/sirupsen/logrus"
 )
 
 // A Controller is an Iversion Of Control pattern used to init the server package.
@@ -20,15 +25,33 @@ type Controller struct {
 	Version             string
 	Database            database.Client
 	NoRegistration      bool
+	Registration        service.RegistrationPolicy
 	ShowRealVersion     bool
 	SubscriptionPayload []byte
 	FeaturesPayload     []byte
 	AllowOrigins        []string
 	AllowMethods        []string
+	RevisionRetention   service.RevisionRetention
+	Lockout             service.LockoutPolicy
+	// TrustedProxies are allowed to set the client IP address with the X-Forwarded-For header
+	TrustedProxies []*net.IPNet
+	// AdminToken authenticates the requests on the admin API, the API is disabled when AdminToken is empty
+	AdminToken string
+	// AuditRetention is the maximum age of the audit events, 0 means unlimited
+	AuditRetention time.Duration
+	// Metrics are not recorded when Metrics is nil
+	Metrics *metrics.Metrics
+	// Notifier must be shared by the engines serving the same clients, a new one is used when nil
+	Notifier service.Notifier
+	// Files params, files endpoints are disabled when Files is nil
+	Files          *storage.Local
+	FilesQuota     int64
+	FilesServerURL string
 	// JWT params
 	SigningKey []byte
 	// Session params
 	SessionSecret              []byte
+	MFASecretKey               []byte // Used to encrypt the TOTP secrets at rest
 	AccessTokenExpirationTime  time.Duration
 	RefreshTokenExpirationTime time.Duration
 }
@@ -36,35 +59,35 @@ type Controller struct {
 // EchoEngine instantiates the wep server.
 func EchoEngine(ctrl Controller) *echo.Echo {
 	engine := echo.New()
-	engine.Use(middleware.Recover())
+	engine.Use(middlewares.RequestID())
+	engine.Use(middlewares.Recover())
+	if ctrl.Metrics != nil {
+		engine.Use(ctrl.Metrics.Middleware())
+	}
 	// engine.Use(middleware.CSRF()) // not supported by StandardNotes
 	engine.Use(middleware.Secure())
 	engine.Use(middleware.CORSWithConfig(middleware.CORSConfig{
 		AllowCredentials: true,
 		AllowOrigins:     ctrl.AllowOrigins,
 		AllowMethods:     ctrl.AllowMethods,
+		ExposeHeaders:    []string{"Content-Range", "Accept-Ranges"},
 	}))
-	engine.Use(middleware.Gzip())
-
-	engine.Use(middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
-		LogStatus:        true,
-		LogMethod:        true,
-		LogURI:           true,
-		LogLatency:       true,
-		LogContentLength: true,
-		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
-			if v.ContentLength != "" {
-				log.Printf("[%d] %s %s (%s) %s", v.Status, v.Method, v.URI, v.ContentLength, v.Latency)
-				return nil
-			}
-			log.Printf("[%d] %s %s %s", v.Status, v.Method, v.URI, v.Latency)
-			return nil
+	engine.Use(middleware.GzipWithConfig(middleware.GzipConfig{
+		Skipper: func(c echo.Context) bool {
+			// Encrypted files are not compressible and ranges must match the raw content.
+			// WebSocket connections are hijacked.
+			// Backups are compressed on demand.
+			return strings.HasPrefix(c.Path(), "/v1/files") || strings.HasPrefix(c.Path(), "/v1/sockets") || c.Path() == "/admin/backup"
 		},
 	}))
+
+	engine.Use(middlewares.RequestLogger())
 	engine.Binder = middlewares.NewBinder()
+	engine.IPExtractor = middlewares.IPExtractor(ctrl.TrustedProxies)
 	// Error handler
 	engine.HTTPErrorHandler = middlewares.HTTPErrorHandler
 
+	engine.Pre(middlewares.InviteCode())
 	engine.Pre(middleware.Rewrite(map[string]string{
 		"/": "/version",
 	}))
@@ -101,12 +124,34 @@ func EchoEngine(ctrl Controller) *echo.Echo {
 		})
 	})
 
+	//
+	// health handlers
+	//
+	health := &health{
+		db: ctrl.Database,
+	}
+	router.GET("/healthz", health.Live)
+	router.GET("/readyz", health.Ready)
+
 	//
 	// auth handlers
 	//
+	audits := service.NewAudit(ctrl.Database, ctrl.AuditRetention)
+	mfaService := service.NewMFA(ctrl.Database, ctrl.MFASecretKey)
+	notifier := ctrl.Notifier
+	if notifier == nil {
+		notifier = service.NewNotifier()
+	}
 	auth := &auth{
 		db:       ctrl.Database,
 		sessions: sessions,
+		notifier: notifier,
+		mfa:      mfaService,
+		lockout:  service.NewLockout(ctrl.Database, ctrl.Lockout),
+		invites:  service.NewInvite(ctrl.Database, ctrl.Registration),
+		audits:   audits,
+		files:    ctrl.Files,
+		metrics:  ctrl.Metrics,
 	}
 	if !ctrl.NoRegistration {
 		router.POST("/auth", auth.Register)
@@ -123,12 +168,44 @@ func EchoEngine(ctrl Controller) *echo.Echo {
 	v1.POST("/login", auth.Login)
 	v1restricted.POST("/logout", auth.Logout)
 	v1restricted.PUT("/users/:id/attributes/credentials", auth.UpdatePassword)
+	v1restricted.GET("/users/:id/params", auth.UserParams)
+	v1restricted.PATCH("/users/:id", auth.Update)
+	v1restricted.DELETE("/users/:id", auth.Delete)
+
+	//
+	// mfa handlers
+	//
+	mfa := &mfa{
+		mfa:    mfaService,
+		audits: audits,
+	}
+	v1restricted.GET("/users/:id/mfa", mfa.Show)
+	v1restricted.GET("/users/:id/mfa/secret", mfa.Secret)
+	v1restricted.PUT("/users/:id/mfa", mfa.Enable)
+	v1restricted.DELETE("/users/:id/mfa", mfa.Disable)
+	v1restricted.POST("/users/:id/mfa/recovery-codes", mfa.RecoveryCodes)
+
+	//
+	// setting handlers
+	//
+	setting := &setting{
+		settings: service.NewSetting(ctrl.Database, mfaService),
+		audits:   audits,
+	}
+	v1restricted.GET("/users/:id/settings", setting.List)
+	v1restricted.GET("/users/:id/settings/:name", setting.Show)
+	v1restricted.PUT("/users/:id/settings", setting.Update)
+	v1restricted.DELETE("/users/:id/settings/:name", setting.Delete)
+
+	//
+	// audit handlers
+	//
+	audit := &audit{
+		audits: audits,
+	}
+	v1restricted.GET("/users/:id/audit-events", audit.List)
 
 	// TODO: GET    /auth/methods
-	// TODO: GET    /v1/users/:id/params => currentuser auth.Params
-	// TODO: PATCH  /v1/users/:id
-	// TODO: PUT    /v1/users/:id/settings
-	// TODO: DELETE /v1/users/:id/settings/:param
 
 	//
 	// session handlers
@@ -136,6 +213,8 @@ func EchoEngine(ctrl Controller) *echo.Echo {
 	session := &sess{
 		db:       ctrl.Database,
 		sessions: sessions,
+		notifier: notifier,
+		audits:   audits,
 	}
 	router.POST("/session/refresh", session.Refresh)
 	restricted.GET("/sessions", session.List)
@@ -151,7 +230,10 @@ func EchoEngine(ctrl Controller) *echo.Echo {
 	// item handlers
 	//
 	item := &item{
-		db: ctrl.Database,
+		db:        ctrl.Database,
+		revisions: service.NewRevision(ctrl.Database, ctrl.RevisionRetention),
+		notifier:  notifier,
+		metrics:   ctrl.Metrics,
 	}
 	restricted.POST("/items/sync", item.Sync)
 	restricted.POST("/items/backup", item.Backup)
@@ -159,6 +241,74 @@ func EchoEngine(ctrl Controller) *echo.Echo {
 
 	v1restricted.POST("/items", item.Sync)
 
+	//
+	// socket handlers
+	//
+	socket := &socket{
+		notifier: notifier,
+		sessions: sessions,
+	}
+	sockets := router.Group("/v1/sockets", middlewares.QueryToken("authToken"), middlewares.Session(sessions))
+	sockets.GET("", socket.Connect)
+
+	//
+	// revision handlers
+	//
+	revision := &revision{
+		db: ctrl.Database,
+	}
+	restricted.GET("/items/:item_id/revisions", revision.List)
+	restricted.GET("/items/:item_id/revisions/:id", revision.Show)
+
+	v1restricted.GET("/items/:item_id/revisions", revision.List)
+	v1restricted.GET("/items/:item_id/revisions/:id", revision.Show)
+
+	//
+	// file handlers
+	//
+	if ctrl.Files != nil {
+		file := &file{
+			files:     ctrl.Files,
+			sessions:  sessions,
+			quota:     ctrl.FilesQuota,
+			serverURL: ctrl.FilesServerURL,
+		}
+		valet := middlewares.ValetToken(sessions)
+
+		v1restricted.POST("/files/valet-tokens", file.ValetToken)
+		v1.POST("/files/upload/create-session", file.CreateUploadSession, valet)
+		v1.POST("/files/upload/chunk", file.UploadChunk, valet)
+		v1.POST("/files/upload/close-session", file.CloseUploadSession, valet)
+		v1.GET("/files", file.Download, valet)
+		v1.DELETE("/files", file.Delete, valet)
+	}
+
+	//
+	// admin handlers
+	//
+	if ctrl.AdminToken != "" {
+		admin := &admin{
+			db:       ctrl.Database,
+			admin:    service.NewAdmin(ctrl.Database, ctrl.Files),
+			invites:  service.NewInvite(ctrl.Database, ctrl.Registration),
+			backups:  service.NewBackup(ctrl.Database, service.BackupPolicy{}),
+			notifier: notifier,
+			audits:   audits,
+		}
+		admins := router.Group("/admin", middlewares.AdminToken(ctrl.AdminToken))
+		admins.GET("/users", admin.Users)
+		admins.GET("/users/:id", admin.User)
+		admins.DELETE("/users/:id", admin.Delete)
+		admins.POST("/users/:id/disable", admin.Disable)
+		admins.POST("/users/:id/enable", admin.Enable)
+		admins.DELETE("/users/:id/sessions", admin.Logout)
+		admins.GET("/storage", admin.Storage)
+		admins.GET("/backup", admin.Backup)
+		admins.GET("/invites", admin.Invites)
+		admins.POST("/invites", admin.CreateInvite)
+		admins.DELETE("/invites/:code", admin.RevokeInvite)
+	}
+
 	v2 := router.Group("/v2")
 	v2.POST("/login", auth.LoginPKCE)
 	v2.POST("/login-params", auth.ParamsPKCE)
@@ -223,3 +373,7 @@ func currentSession(c echo.Context) *model.Session {
 	}
 	return nil
 }
+
+func logger(c echo.Context) *logrus.Entry {
+	return middlewares.Logger(c)
+}
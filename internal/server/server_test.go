@@ -61,6 +61,7 @@ func setup() (engine *echo.Echo, ctrl server.Controller, r *gofight.RequestConfi
 		ShowRealVersion:            true,
 		SigningKey:                 []byte("secret"),
 		SessionSecret:              []byte("00000000000000000000000000000000"),
+		MFASecretKey:               []byte("11111111111111111111111111111111"),
 		AccessTokenExpirationTime:  60 * 24 * time.Hour,
 		RefreshTokenExpirationTime: 365 * 24 * time.Hour,
 	}
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/mdouchement/standardfile/internal/database"
+	"github.com/mdouchement/standardfile/internal/model"
+	"github.com/mdouchement/standardfile/internal/sferror"
+	"github.com/mdouchement/standardfile/internal/storage"
+	"github.com/pkg/errors"
+)
+
+type (
+	// A UserReport summarizes the account and the usage of a user.
+	UserReport struct {
+		ID             string     `json:"uuid"`
+		Email          string     `json:"email"`
+		Version        string     `json:"version"`
+		CreatedAt      *time.Time `json:"created_at"`
+		Disabled       bool       `json:"disabled"`
+		MFAEnabled     bool       `json:"mfa_enabled"`
+		Items          int        `json:"items"`
+		ActiveSessions int        `json:"active_sessions"`
+		FilesUsage     int64      `json:"files_usage"`   // Bytes, 0 when the files are disabled
+		LastActivity   *time.Time `json:"last_activity"` // Last item update or session refresh
+	}
+
+	// A StorageReport summarizes the storage usage of the server.
+	StorageReport struct {
+		Database   database.Stats `json:"database"`
+		Users      int            `json:"users"`
+		Items      int            `json:"items"`
+		FilesUsage int64          `json:"files_usage"` // Bytes, 0 when the files are disabled
+	}
+
+	// An AdminService is a service used for managing the users of the server.
+	AdminService interface {
+		// Users returns the reports of all the users, the oldest first.
+		Users() ([]*UserReport, error)
+		// User returns the report of the given user.
+		User(id string) (*UserReport, error)
+		// Disable prevents the given user from signing in and terminates all their sessions.
+		Disable(id string) error
+		// Enable allows the given user to sign in again.
+		Enable(id string) error
+		// Logout terminates all the sessions of the given user and returns the number of terminated sessions.
+		Logout(id string) (int, error)
+		// Delete deletes the given user with all their records and files.
+		Delete(id string) error
+		// Storage returns the storage usage of the server.
+		Storage() (*StorageReport, error)
+	}
+
+	adminService struct {
+		db    database.Client
+		files *storage.Local // nil when the files are disabled
+	}
+)
+
+// NewAdmin instantiates a new Admin service.
+func NewAdmin(db database.Client, files *storage.Local) AdminService {
+	return &adminService{
+		db:    db,
+		files: files,
+	}
+}
+
+func (s *adminService) Users() ([]*UserReport, error) {
+	var users []*model.User
+	err := s.db.ForEach(&model.User{}, func(m model.Model) error {
+		users = append(users, m.(*model.User))
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "could not list users")
+	}
+
+	sort.SliceStable(users, func(i, j int) bool {
+		return users[i].CreatedAt.Before(*users[j].CreatedAt)
+	})
+
+	reports := make([]*UserReport, 0, len(users))
+	for _, user := range users {
+		report, err := s.report(user)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+func (s *adminService) User(id string) (*UserReport, error) {
+	user, err := s.user(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.report(user)
+}
+
+func (s *adminService) Disable(id string) error {
+	user, err := s.user(id)
+	if err != nil {
+		return err
+	}
+
+	user.Disabled = true
+	if err = s.db.Save(user); err != nil {
+		return errors.Wrap(err, "could not persist user")
+	}
+
+	_, err = s.db.DeleteSessionsByUserID(user.ID)
+	return err
+}
+
+func (s *adminService) Enable(id string) error {
+	user, err := s.user(id)
+	if err != nil {
+		return err
+	}
+
+	user.Disabled = false
+	return errors.Wrap(s.db.Save(user), "could not persist user")
+}
+
+func (s *adminService) Logout(id string) (int, error) {
+	user, err := s.user(id)
+	if err != nil {
+		return 0, err
+	}
+
+	return s.db.DeleteSessionsByUserID(user.ID)
+}
+
+func (s *adminService) Delete(id string) error {
+	user, err := s.user(id)
+	if err != nil {
+		return err
+	}
+
+	if err = s.db.DeleteUser(user.ID); err != nil {
+		return errors.Wrap(err, "could not delete user")
+	}
+
+	if s.files != nil {
+		return s.files.RemoveAll(user.ID)
+	}
+	return nil
+}
+
+func (s *adminService) Storage() (*StorageReport, error) {
+	stats, err := s.db.Stats()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get database stats")
+	}
+
+	report := &StorageReport{
+		Database: stats,
+	}
+
+	// The database must not be queried while iterating.
+	var ids []string
+	err = s.db.ForEach(&model.User{}, func(m model.Model) error {
+		ids = append(ids, m.GetID())
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "could not list users")
+	}
+	report.Users = len(ids)
+
+	for _, id := range ids {
+		items, err := s.db.ItemStatsByUserID(id)
+		if err != nil {
+			return nil, err
+		}
+		report.Items += items.Count
+
+		if s.files != nil {
+			usage, err := s.files.Usage(id)
+			if err != nil {
+				return nil, err
+			}
+			report.FilesUsage += usage
+		}
+	}
+
+	return report, nil
+}
+
+func (s *adminService) user(id string) (*model.User, error) {
+	user, err := s.db.FindUser(id)
+	if err != nil {
+		if s.db.IsNotFound(err) {
+			return nil, sferror.NewWithTagCode(http.StatusNotFound, "", "User not found.")
+		}
+		return nil, errors.Wrap(err, "could not get user")
+	}
+	return user, nil
+}
+
+func (s *adminService) report(user *model.User) (*UserReport, error) {
+	report := &UserReport{
+		ID:         user.ID,
+		Email:      user.Email,
+		Version:    user.Version,
+		CreatedAt:  user.CreatedAt,
+		Disabled:   user.Disabled,
+		MFAEnabled: user.MFASecret != "",
+	}
+
+	items, err := s.db.ItemStatsByUserID(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	report.Items = items.Count
+	report.LastActivity = items.UpdatedAt
+
+	sessions, err := s.db.FindActiveSessionsByUserID(user.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get sessions")
+	}
+	report.ActiveSessions = len(sessions)
+	for _, session := range sessions {
+		if session.UpdatedAt != nil && (report.LastActivity == nil || session.UpdatedAt.After(*report.LastActivity)) {
+			report.LastActivity = session.UpdatedAt
+		}
+	}
+
+	if s.files != nil {
+		report.FilesUsage, err = s.files.Usage(user.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"time"
+
+	"github.com/mdouchement/standardfile/internal/database"
+	"github.com/mdouchement/standardfile/internal/model"
+	"github.com/pkg/errors"
+)
+
+// auditRecentLimit is the maximum number of events returned to a user.
+const auditRecentLimit = 100
+
+type (
+	// An AuditService is a service used for recording the security events of the accounts.
+	AuditService interface {
+		// Record appends the given event to the audit log.
+		Record(event *model.AuditEvent) error
+		// Recent returns the last events of the given user, the most recent first.
+		Recent(userID string) ([]*model.AuditEvent, error)
+		// Prune deletes the events older than the retention and returns the number of deleted events.
+		Prune() (int, error)
+	}
+
+	auditService struct {
+		db        database.Client
+		retention time.Duration // 0 means unlimited
+	}
+)
+
+// NewAudit instantiates a new Audit service.
+func NewAudit(db database.Client, retention time.Duration) AuditService {
+	return &auditService{
+		db:        db,
+		retention: retention,
+	}
+}
+
+func (s *auditService) Record(event *model.AuditEvent) error {
+	// Events are never updated.
+	event.ID = ""
+	return errors.Wrap(s.db.Save(event), "could not save audit event")
+}
+
+func (s *auditService) Recent(userID string) ([]*model.AuditEvent, error) {
+	return s.db.FindAuditEventsByUserID(userID, auditRecentLimit)
+}
+
+func (s *auditService) Prune() (int, error) {
+	if s.retention <= 0 {
+		return 0, nil
+	}
+
+	return s.db.DeleteAuditEventsBefore(time.Now().Add(-s.retention))
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mdouchement/standardfile/internal/database"
+	"github.com/pkg/errors"
+)
+
+const (
+	backupPrefix = "standardfile-"
+	backupExt    = ".backup"
+)
+
+type (
+	// A BackupPolicy defines where the scheduled snapshots are written and how many are kept.
+	BackupPolicy struct {
+		Dir      string
+		Count    int  // 0 means unlimited
+		Compress bool // gzip
+	}
+
+	// A BackupService is a service used for taking snapshots of the database while it is in use.
+	BackupService interface {
+		// Write writes a snapshot of the database to w, gzip-compressed when compress is true.
+		Write(w io.Writer, compress bool) error
+		// Snapshot writes a snapshot in the policy's directory, removes the oldest ones beyond the policy's count
+		// and returns the path of the snapshot.
+		Snapshot() (string, error)
+	}
+
+	backupService struct {
+		db     database.Client
+		policy BackupPolicy
+	}
+)
+
+// NewBackup instantiates a new Backup service.
+func NewBackup(db database.Client, policy BackupPolicy) BackupService {
+	return &backupService{
+		db:     db,
+		policy: policy,
+	}
+}
+
+// BackupFilename returns the name of a snapshot taken at the given time.
+func BackupFilename(t time.Time, compress bool) string {
+	name := backupPrefix + t.UTC().Format("20060102T150405Z") + backupExt
+	if compress {
+		name += ".gz"
+	}
+	return name
+}
+
+func (s *backupService) Write(w io.Writer, compress bool) error {
+	if !compress {
+		_, err := s.db.Backup(w)
+		return err
+	}
+
+	gz := gzip.NewWriter(w)
+	if _, err := s.db.Backup(gz); err != nil {
+		return err
+	}
+	return errors.Wrap(gz.Close(), "could not compress backup")
+}
+
+func (s *backupService) Snapshot() (string, error) {
+	if err := os.MkdirAll(s.policy.Dir, 0o700); err != nil {
+		return "", errors.Wrap(err, "could not create backup directory")
+	}
+
+	// The snapshot is written aside so an incomplete one is never rotated in.
+	filename := filepath.Join(s.policy.Dir, BackupFilename(time.Now(), s.policy.Compress))
+	f, err := os.CreateTemp(s.policy.Dir, ".snapshot-*")
+	if err != nil {
+		return "", errors.Wrap(err, "could not create backup file")
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if err = s.Write(f, s.policy.Compress); err != nil {
+		return "", err
+	}
+	if err = f.Sync(); err != nil {
+		return "", errors.Wrap(err, "could not sync backup file")
+	}
+	if err = f.Close(); err != nil {
+		return "", errors.Wrap(err, "could not close backup file")
+	}
+	if err = os.Rename(f.Name(), filename); err != nil {
+		return "", errors.Wrap(err, "could not rename backup file")
+	}
+
+	return filename, s.rotate()
+}
+
+// rotate removes the oldest snapshots beyond the policy's count.
+func (s *backupService) rotate() error {
+	if s.policy.Count <= 0 {
+		return nil
+	}
+
+	entries, err := os.ReadDir(s.policy.Dir)
+	if err != nil {
+		return errors.Wrap(err, "could not list backups")
+	}
+
+	var snapshots []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.Type().IsRegular() && strings.HasPrefix(name, backupPrefix) && strings.Contains(name, backupExt) {
+			snapshots = append(snapshots, name)
+		}
+	}
+	if len(snapshots) <= s.policy.Count {
+		return nil
+	}
+
+	// Names are sorted by date.
+	sort.Strings(snapshots)
+	for _, name := range snapshots[:len(snapshots)-s.policy.Count] {
+		if err = os.Remove(filepath.Join(s.policy.Dir, name)); err != nil {
+			return errors.Wrap(err, "could not remove old backup")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mdouchement/standardfile/internal/database"
+	"github.com/mdouchement/standardfile/internal/model"
+	"github.com/mdouchement/standardfile/internal/server/session"
+	"github.com/mdouchement/standardfile/internal/sferror"
+	"github.com/pkg/errors"
+)
+
+// registrations serializes the registrations so concurrent requests can't exceed the uses of an invite.
+var registrations sync.Mutex
+
+type (
+	// A RegistrationPolicy defines who is allowed to register.
+	RegistrationPolicy struct {
+		InviteOnly     bool     // A valid invite code is required to register
+		AllowedDomains []string // Email domains allowed to register, empty means any domain
+	}
+
+	// An InviteService is a service used for managing the registration invites.
+	InviteService interface {
+		// Create generates a new invite usable maxUses times, it never expires when ttl is 0.
+		Create(maxUses int, ttl time.Duration) (*model.Invite, error)
+		// List returns all the invites, the oldest first.
+		List() ([]*model.Invite, error)
+		// Revoke deletes the invite of the given code.
+		Revoke(code string) error
+		// Register checks the registration policy for the given email and invite code then calls register.
+		// The invite is only used when register succeeds.
+		Register(email, code string, register func() (Render, error)) (Render, error)
+	}
+
+	inviteService struct {
+		db     database.Client
+		policy RegistrationPolicy
+	}
+)
+
+// NewInvite instantiates a new Invite service.
+func NewInvite(db database.Client, policy RegistrationPolicy) InviteService {
+	domains := make([]string, 0, len(policy.AllowedDomains))
+	for _, domain := range policy.AllowedDomains {
+		domains = append(domains, normalizeDomain(domain))
+	}
+	policy.AllowedDomains = domains
+
+	return &inviteService{
+		db:     db,
+		policy: policy,
+	}
+}
+
+func (s *inviteService) Create(maxUses int, ttl time.Duration) (*model.Invite, error) {
+	if maxUses <= 0 {
+		return nil, errors.New("an invite must be usable at least once")
+	}
+
+	invite := &model.Invite{
+		Code:    strings.ToLower(session.SecureToken(16)),
+		MaxUses: maxUses,
+	}
+	if ttl > 0 {
+		expireAt := time.Now().Add(ttl).UTC()
+		invite.ExpireAt = &expireAt
+	}
+
+	if err := s.db.Save(invite); err != nil {
+		return nil, errors.Wrap(err, "could not persist invite")
+	}
+	return invite, nil
+}
+
+func (s *inviteService) List() ([]*model.Invite, error) {
+	invites := make([]*model.Invite, 0)
+	err := s.db.ForEach(&model.Invite{}, func(m model.Model) error {
+		invites = append(invites, m.(*model.Invite))
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "could not list invites")
+	}
+
+	sort.SliceStable(invites, func(i, j int) bool {
+		return invites[i].CreatedAt.Before(*invites[j].CreatedAt)
+	})
+	return invites, nil
+}
+
+func (s *inviteService) Revoke(code string) error {
+	invite, err := s.db.FindInvite(strings.TrimSpace(code))
+	if err != nil {
+		return err
+	}
+
+	return errors.Wrap(s.db.Delete(invite), "could not delete invite")
+}
+
+func (s *inviteService) Register(email, code string, register func() (Render, error)) (Render, error) {
+	if len(s.policy.AllowedDomains) > 0 && !slices.Contains(s.policy.AllowedDomains, emailDomain(email)) {
+		// StatusUnauthorized is used by the reference implementation for all registration errors.
+		return nil, sferror.NewWithTagCode(http.StatusUnauthorized, "", "This email address is not allowed to register.")
+	}
+
+	if !s.policy.InviteOnly {
+		return register()
+	}
+
+	registrations.Lock()
+	defer registrations.Unlock()
+
+	invite, err := s.db.FindInvite(strings.TrimSpace(code))
+	if err != nil && !s.db.IsNotFound(err) {
+		return nil, errors.Wrap(err, "could not get invite")
+	}
+	if code == "" || invite == nil || !invite.IsUsable(time.Now()) {
+		return nil, sferror.NewWithTagCode(http.StatusUnauthorized, "", "A valid invite code is required to register.")
+	}
+
+	render, err := register()
+	if err != nil {
+		return nil, err
+	}
+
+	invite.Uses++
+	if err = s.db.Save(invite); err != nil {
+		return nil, errors.Wrap(err, "could not persist invite")
+	}
+	return render, nil
+}
+
+func emailDomain(email string) string {
+	i := strings.LastIndex(email, "@")
+	if i < 0 {
+		return ""
+	}
+	return normalizeDomain(email[i+1:])
+}
+
+func normalizeDomain(domain string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "@"))
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"time"
+
+	"github.com/mdouchement/standardfile/internal/database"
+	"github.com/mdouchement/standardfile/internal/model"
+	"github.com/pkg/errors"
+)
+
+// DeleteItemsParams are used to delete items.
+type DeleteItemsParams struct {
+	Params
+	UUIDs []string `json:"uuids"`
+	UUID  string   `json:"uuid"` // Single item form of the reference implementation
+	All   bool     `json:"all"`  // Deletes all the items of the user
+}
+
+// DeleteItems marks the matching items as deleted and returns the number of affected items.
+// Like a sync, the content is wiped and the items are sent as deleted to the other clients.
+func DeleteItems(db database.Client, revisions RevisionService, notifier Notifier, user *model.User, params DeleteItemsParams) (int, error) {
+	base := &syncServiceBase{
+		db:        db,
+		revisions: revisions,
+		notifier:  notifier,
+		User:      user,
+		Params:    SyncParams{Params: params.Params},
+	}
+
+	var deleted []*model.Item
+	err := forEachDeletableItem(db, user, params, func(item *model.Item) error {
+		base.prepareDelete(item)
+		item.Deleted = true
+
+		if err := db.Save(item); err != nil { // UpdatedAt is bumped so the deletion is synced
+			return errors.Wrap(err, "could not delete item")
+		}
+		base.revise(nil, item)
+
+		deleted = append(deleted, item) // Its content is wiped, only the ID is kept for the notification
+		return nil
+	})
+
+	base.notify(deleted)
+	return len(deleted), err
+}
+
+// forEachDeletableItem calls fn for each matching item not already deleted.
+// All the items of the user are iterated without being loaded in memory.
+func forEachDeletableItem(db database.Client, user *model.User, params DeleteItemsParams, fn func(item *model.Item) error) error {
+	if params.All {
+		return db.ForEachItemByParams(user.ID, "", time.Time{}, false, true, fn)
+	}
+
+	uuids := params.UUIDs
+	if params.UUID != "" {
+		uuids = append(uuids, params.UUID)
+	}
+
+	seen := make(map[string]bool, len(uuids))
+	for _, id := range uuids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		item, err := db.FindItemByUserID(id, user.ID)
+		if err != nil {
+			if db.IsNotFound(err) {
+				continue
+			}
+			return errors.Wrap(err, "could not find item")
+		}
+
+		if item.Deleted {
+			continue
+		}
+
+		if err = fn(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
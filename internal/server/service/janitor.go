@@ -0,0 +1,54 @@
+package service
+
+import (
+	"time"
+
+	"github.com/mdouchement/standardfile/internal/database"
+	"github.com/pkg/errors"
+)
+
+type (
+	// A JanitorReport holds the number of records removed by a cleanup.
+	JanitorReport struct {
+		Sessions   int
+		Challenges int
+		Locks      int
+	}
+
+	// A JanitorService is a service used for removing the expired records.
+	JanitorService interface {
+		// Cleanup removes the expired sessions, PKCE challenges and login locks.
+		// The report holds the records removed before an error occurred.
+		Cleanup() (JanitorReport, error)
+	}
+
+	janitorService struct {
+		db      database.Client
+		lockout LockoutPolicy
+	}
+)
+
+// NewJanitor instantiates a new Janitor service.
+// The login locks are removed once their attempts are forgotten by the given lockout policy.
+func NewJanitor(db database.Client, lockout LockoutPolicy) JanitorService {
+	return &janitorService{
+		db:      db,
+		lockout: lockout,
+	}
+}
+
+func (s *janitorService) Cleanup() (report JanitorReport, err error) {
+	report.Sessions, err = s.db.DeleteSessionsExpiredBefore(time.Now())
+	if err != nil {
+		return report, errors.Wrap(err, "could not remove expired sessions")
+	}
+
+	report.Challenges, err = s.db.RevokeExpiredChallenges()
+	if err != nil {
+		return report, errors.Wrap(err, "could not remove expired challenges")
+	}
+
+	// Like the lockout service, the attempts are forgotten after MaxDuration without failure.
+	report.Locks, err = s.db.DeleteLocksBefore(time.Now().Add(-max(s.lockout.MaxDuration, s.lockout.Duration)))
+	return report, errors.Wrap(err, "could not remove expired locks")
+}
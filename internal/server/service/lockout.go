@@ -0,0 +1,191 @@
+package service
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mdouchement/standardfile/internal/database"
+	"github.com/mdouchement/standardfile/internal/model"
+	"github.com/mdouchement/standardfile/internal/sferror"
+	"github.com/pkg/errors"
+)
+
+type (
+	// A LockoutPolicy defines when the login attempts are locked.
+	// Each failure during a lockout doubles its duration.
+	LockoutPolicy struct {
+		MaxAttempts   int           // Failed attempts per account before locking it, 0 means unlimited
+		MaxIPAttempts int           // Failed attempts per IP address before locking it, 0 means unlimited
+		Duration      time.Duration // Duration of the first lockout
+		MaxDuration   time.Duration // Maximum duration of a lockout, the attempts are forgotten after this duration without failure
+	}
+
+	// A LockoutService is a service used for limiting the failed login attempts.
+	LockoutService interface {
+		// Check returns an error when the account or the IP address is locked.
+		Check(email, ip string) error
+		// Fail records a failed login attempt of the account from the IP address.
+		Fail(email, ip string) error
+		// Reset forgets the failed login attempts of the account and the IP address.
+		Reset(email, ip string) error
+	}
+
+	lockoutService struct {
+		db     database.Client
+		policy LockoutPolicy
+		mu     sync.Mutex
+		keyMu  map[string]*keyMutex // Serializes the updates of each lock
+	}
+
+	keyMutex struct {
+		sync.Mutex
+		refs int
+	}
+)
+
+// NewLockout instantiates a new Lockout service.
+func NewLockout(db database.Client, policy LockoutPolicy) LockoutService {
+	if policy.MaxDuration < policy.Duration {
+		policy.MaxDuration = policy.Duration
+	}
+
+	return &lockoutService{
+		db:     db,
+		policy: policy,
+		keyMu:  map[string]*keyMutex{},
+	}
+}
+
+func (s *lockoutService) Check(email, ip string) error {
+	now := time.Now()
+	for key := range s.keys(email, ip) {
+		lock, err := s.db.FindLock(key)
+		if err != nil {
+			if s.db.IsNotFound(err) {
+				continue
+			}
+			return errors.Wrap(err, "could not get lock")
+		}
+
+		if lock.LockedUntil.After(now) {
+			// Same status and message as the reference implementation.
+			return sferror.NewWithTagCode(http.StatusLocked, "", "Too many successive login requests. Please try your request again later.")
+		}
+	}
+
+	return nil
+}
+
+func (s *lockoutService) Fail(email, ip string) error {
+	now := time.Now()
+	for key, max := range s.keys(email, ip) {
+		if err := s.fail(key, max, now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *lockoutService) fail(key string, max int, now time.Time) error {
+	defer s.lock(key)()
+
+	lock, err := s.db.FindLock(key)
+	if err != nil {
+		if !s.db.IsNotFound(err) {
+			return errors.Wrap(err, "could not get lock")
+		}
+		lock = &model.Lock{Key: key}
+	}
+
+	if lock.UpdatedAt != nil && now.Sub(*lock.UpdatedAt) > s.policy.MaxDuration {
+		lock.Attempts = 0
+	}
+
+	lock.Attempts++
+	if lock.Attempts >= max {
+		lock.LockedUntil = now.Add(s.duration(lock.Attempts - max))
+	}
+
+	return errors.Wrap(s.db.Save(lock), "could not persist lock")
+}
+
+func (s *lockoutService) Reset(email, ip string) error {
+	for key := range s.keys(email, ip) {
+		if err := s.reset(key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *lockoutService) reset(key string) error {
+	defer s.lock(key)()
+
+	lock, err := s.db.FindLock(key)
+	if err != nil {
+		if s.db.IsNotFound(err) {
+			return nil
+		}
+		return errors.Wrap(err, "could not get lock")
+	}
+
+	if err = s.db.Delete(lock); err != nil && !s.db.IsNotFound(err) {
+		return errors.Wrap(err, "could not delete lock")
+	}
+
+	return nil
+}
+
+// lock locks the given key and returns the function unlocking it.
+func (s *lockoutService) lock(key string) func() {
+	s.mu.Lock()
+	m, ok := s.keyMu[key]
+	if !ok {
+		m = &keyMutex{}
+		s.keyMu[key] = m
+	}
+	m.refs++
+	s.mu.Unlock()
+
+	m.Lock()
+	return func() {
+		m.Unlock()
+
+		s.mu.Lock()
+		m.refs--
+		if m.refs == 0 {
+			delete(s.keyMu, key)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// keys returns the lock keys with their maximum attempts, the unlimited ones are omitted.
+// The email is normalized so its case variants share the same lock.
+func (s *lockoutService) keys(email, ip string) map[string]int {
+	keys := map[string]int{}
+	email = strings.ToLower(strings.TrimSpace(email))
+	if s.policy.MaxAttempts > 0 && email != "" {
+		keys["email:"+email] = s.policy.MaxAttempts
+	}
+	if s.policy.MaxIPAttempts > 0 && ip != "" {
+		keys["ip:"+ip] = s.policy.MaxIPAttempts
+	}
+	return keys
+}
+
+// duration returns the lockout duration after the given number of failures during lockouts.
+func (s *lockoutService) duration(failures int) time.Duration {
+	d := s.policy.Duration
+	for range failures {
+		d *= 2
+		if d >= s.policy.MaxDuration {
+			return s.policy.MaxDuration
+		}
+	}
+	return d
+}
@@ -0,0 +1,261 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/mdouchement/standardfile/internal/database"
+	"github.com/mdouchement/standardfile/internal/model"
+	"github.com/mdouchement/standardfile/internal/server/session"
+	"github.com/mdouchement/standardfile/internal/sferror"
+	"github.com/mdouchement/standardfile/internal/totp"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	mfaIssuer             = "StandardFile"
+	mfaRecoveryCodesCount = 10
+)
+
+// mfaNamespace is used to derive the mfa_key of a user without exposing its ID.
+var mfaNamespace = uuid.Must(uuid.FromString("9b1f3c4e-7a0d-4f43-9a56-2f8e0c6d1b7a"))
+
+type (
+	// An MFASecret is a new TOTP secret to enroll in an authenticator application.
+	MFASecret struct {
+		Secret string `json:"secret"`
+		URI    string `json:"uri"`
+	}
+
+	// A MFAService is a service used for managing the two-factor authentication of the users.
+	MFAService interface {
+		// Enabled returns true if the two-factor authentication is enabled for the given user.
+		Enabled(user *model.User) bool
+		// Key returns the name of the parameter holding the code sent by the clients.
+		Key(user *model.User) string
+		// GenerateSecret returns a new secret for the given user.
+		GenerateSecret(user *model.User) (*MFASecret, error)
+		// Enable enables the two-factor authentication with the given secret once the code is validated.
+		// It returns the recovery codes.
+		Enable(user *model.User, secret, code string) ([]string, error)
+		// Disable disables the two-factor authentication, the code can be a recovery code.
+		Disable(user *model.User, code string) error
+		// Store stores the given secret already validated by the client (e.g. MFA_SECRET setting).
+		// The recovery codes of the previous secret are revoked.
+		Store(user *model.User, secret string) error
+		// Reset disables the two-factor authentication without code verification.
+		Reset(user *model.User) error
+		// RecoveryCodes regenerates the recovery codes, the code can be a recovery code.
+		RecoveryCodes(user *model.User, code string) ([]string, error)
+		// Verify checks the code found in the given params.
+		// A recovery code is only consumed when consume is true.
+		// It returns a `mfa-required' or `mfa-invalid' error expected by the clients.
+		Verify(user *model.User, params map[string]string, consume bool) error
+	}
+
+	mfaService struct {
+		db  database.Client
+		key []byte
+	}
+)
+
+// NewMFA instantiates a new MFA service.
+// The key is used to encrypt the TOTP secrets at rest.
+func NewMFA(db database.Client, key []byte) MFAService {
+	return &mfaService{
+		db:  db,
+		key: key,
+	}
+}
+
+func (s *mfaService) Enabled(user *model.User) bool {
+	return user.MFASecret != ""
+}
+
+func (s *mfaService) Key(user *model.User) string {
+	return "mfa_" + uuid.NewV5(mfaNamespace, user.ID).String()
+}
+
+func (s *mfaService) GenerateSecret(user *model.User) (*MFASecret, error) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	return &MFASecret{
+		Secret: secret,
+		URI:    totp.URI(mfaIssuer, user.Email, secret),
+	}, nil
+}
+
+func (s *mfaService) Enable(user *model.User, secret, code string) ([]string, error) {
+	if s.Enabled(user) {
+		return nil, sferror.NewWithTagCode(http.StatusBadRequest, "mfa-enabled", "Two-factor authentication is already enabled.")
+	}
+
+	if !totp.Validate(secret, code, time.Now()) {
+		return nil, s.invalid(user)
+	}
+
+	encrypted, err := s.encrypt(secret)
+	if err != nil {
+		return nil, err
+	}
+	user.MFASecret = encrypted
+
+	return s.regenerate(user)
+}
+
+func (s *mfaService) Disable(user *model.User, code string) error {
+	if err := s.check(user, code, false); err != nil {
+		return err
+	}
+
+	return s.Reset(user)
+}
+
+func (s *mfaService) Store(user *model.User, secret string) error {
+	if _, err := totp.Code(secret, time.Now()); err != nil {
+		return sferror.NewWithTagCode(http.StatusBadRequest, "invalid-parameters", "Invalid two-factor authentication secret.")
+	}
+
+	encrypted, err := s.encrypt(secret)
+	if err != nil {
+		return err
+	}
+
+	user.MFASecret = encrypted
+	user.MFARecoveryCodes = nil
+	return errors.Wrap(s.db.Save(user), "could not persist user")
+}
+
+func (s *mfaService) Reset(user *model.User) error {
+	user.MFASecret = ""
+	user.MFARecoveryCodes = nil
+	return errors.Wrap(s.db.Save(user), "could not persist user")
+}
+
+func (s *mfaService) RecoveryCodes(user *model.User, code string) ([]string, error) {
+	if err := s.check(user, code, false); err != nil {
+		return nil, err
+	}
+
+	return s.regenerate(user)
+}
+
+func (s *mfaService) Verify(user *model.User, params map[string]string, consume bool) error {
+	if !s.Enabled(user) {
+		return nil
+	}
+
+	code, ok := params[s.Key(user)]
+	if !ok || code == "" {
+		return sferror.NewWithPayload(
+			http.StatusUnauthorized,
+			"mfa-required",
+			"Please enter your two-factor authentication code.",
+			map[string]string{"mfa_key": s.Key(user)},
+		)
+	}
+
+	return s.check(user, code, consume)
+}
+
+// check validates the given TOTP or recovery code.
+// A recovery code is removed from the user when persist is true.
+func (s *mfaService) check(user *model.User, code string, persist bool) error {
+	if !s.Enabled(user) {
+		return sferror.NewWithTagCode(http.StatusBadRequest, "mfa-disabled", "Two-factor authentication is not enabled.")
+	}
+
+	secret, err := s.decrypt(user.MFASecret)
+	if err != nil {
+		return err
+	}
+
+	if totp.Validate(secret, code, time.Now()) {
+		return nil
+	}
+
+	hash := recoveryCodeHash(code)
+	for i, recovery := range user.MFARecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(recovery), []byte(hash)) != 1 {
+			continue
+		}
+
+		if !persist {
+			return nil
+		}
+
+		// A recovery code can only be used once.
+		user.MFARecoveryCodes = append(user.MFARecoveryCodes[:i:i], user.MFARecoveryCodes[i+1:]...)
+		return errors.Wrap(s.db.Save(user), "could not persist user")
+	}
+
+	return s.invalid(user)
+}
+
+func (s *mfaService) regenerate(user *model.User) ([]string, error) {
+	codes := make([]string, mfaRecoveryCodesCount)
+	user.MFARecoveryCodes = make([]string, mfaRecoveryCodesCount)
+	for i := range codes {
+		codes[i] = strings.ToLower(session.SecureToken(16))
+		user.MFARecoveryCodes[i] = recoveryCodeHash(codes[i])
+	}
+
+	if err := s.db.Save(user); err != nil {
+		return nil, errors.Wrap(err, "could not persist user")
+	}
+	return codes, nil
+}
+
+func (s *mfaService) invalid(user *model.User) error {
+	return sferror.NewWithPayload(
+		http.StatusUnauthorized,
+		"mfa-invalid",
+		"The two-factor authentication code you entered is incorrect. Please try again.",
+		map[string]string{"mfa_key": s.Key(user)},
+	)
+}
+
+func (s *mfaService) encrypt(secret string) (string, error) {
+	aead, err := chacha20poly1305.NewX(s.key)
+	if err != nil {
+		return "", errors.Wrap(err, "could not initialize MFA cipher")
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(secret)+aead.Overhead())
+	if _, err = rand.Read(nonce); err != nil {
+		return "", errors.Wrap(err, "could not generate nonce")
+	}
+
+	return base64.RawStdEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(secret), nil)), nil
+}
+
+func (s *mfaService) decrypt(secret string) (string, error) {
+	aead, err := chacha20poly1305.NewX(s.key)
+	if err != nil {
+		return "", errors.Wrap(err, "could not initialize MFA cipher")
+	}
+
+	payload, err := base64.RawStdEncoding.DecodeString(secret)
+	if err != nil || len(payload) < aead.NonceSize() {
+		return "", errors.New("malformed MFA secret")
+	}
+
+	plaintext, err := aead.Open(nil, payload[:aead.NonceSize()], payload[aead.NonceSize():], nil)
+	return string(plaintext), errors.Wrap(err, "could not decrypt MFA secret")
+}
+
+func recoveryCodeHash(code string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"sync"
+)
+
+// EventItemsChanged is sent when items are saved by another session of the user.
+const EventItemsChanged = "items_changed"
+
+type (
+	// An Event is a notification pushed to the sessions of a user.
+	Event struct {
+		Type  string   `json:"type"`
+		Items []string `json:"items,omitempty"` // UUIDs of the changed items
+	}
+
+	// A Subscription receives the events of a user.
+	Subscription struct {
+		// Events is closed when the subscription is canceled.
+		Events <-chan Event
+
+		events    chan Event
+		userID    string
+		sessionID string
+	}
+
+	// A Notifier is a service used for pushing events to the connected sessions of the users.
+	Notifier interface {
+		// Subscribe registers the given session to receive the events of the given user.
+		Subscribe(userID, sessionID string) *Subscription
+		// Unsubscribe cancels the given subscription.
+		Unsubscribe(s *Subscription)
+		// Notify sends the event to all the subscriptions of the given user except the emitting session.
+		// A slow subscription misses the event instead of blocking the caller.
+		Notify(userID, sessionID string, event Event)
+		// Disconnect cancels the subscriptions of the given session, or of all the sessions of the user when sessionID is empty.
+		Disconnect(userID, sessionID string)
+	}
+
+	notifier struct {
+		mu            sync.Mutex
+		subscriptions map[string]map[*Subscription]bool
+	}
+)
+
+// NewNotifier instantiates a new Notifier service.
+func NewNotifier() Notifier {
+	return &notifier{
+		subscriptions: map[string]map[*Subscription]bool{},
+	}
+}
+
+func (n *notifier) Subscribe(userID, sessionID string) *Subscription {
+	events := make(chan Event, 16)
+	s := &Subscription{
+		Events:    events,
+		events:    events,
+		userID:    userID,
+		sessionID: sessionID,
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.subscriptions[userID] == nil {
+		n.subscriptions[userID] = map[*Subscription]bool{}
+	}
+	n.subscriptions[userID][s] = true
+
+	return s
+}
+
+func (n *notifier) Unsubscribe(s *Subscription) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.cancel(s)
+}
+
+func (n *notifier) Disconnect(userID, sessionID string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for s := range n.subscriptions[userID] {
+		if sessionID == "" || s.sessionID == sessionID {
+			n.cancel(s)
+		}
+	}
+}
+
+// cancel removes the given subscription, n.mu must be held.
+func (n *notifier) cancel(s *Subscription) {
+	if !n.subscriptions[s.userID][s] {
+		return
+	}
+
+	delete(n.subscriptions[s.userID], s)
+	if len(n.subscriptions[s.userID]) == 0 {
+		delete(n.subscriptions, s.userID)
+	}
+	close(s.events)
+}
+
+func (n *notifier) Notify(userID, sessionID string, event Event) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for s := range n.subscriptions[userID] {
+		if sessionID != "" && s.sessionID == sessionID {
+			continue
+		}
+
+		select {
+		case s.events <- event:
+		default:
+		}
+	}
+}
@@ -43,7 +43,7 @@ func (s *pkceService) ComputeChallenge(codeVerifier string) string {
 }
 
 func (s *pkceService) StoreChallenge(codeChallenge string) error {
-	if err := s.db.RevokeExpiredChallenges(); err != nil {
+	if _, err := s.db.RevokeExpiredChallenges(); err != nil {
 		return err
 	}
 
@@ -54,7 +54,7 @@ func (s *pkceService) StoreChallenge(codeChallenge string) error {
 }
 
 func (s *pkceService) CheckChallenge(codeChallenge string) error {
-	if err := s.db.RevokeExpiredChallenges(); err != nil {
+	if _, err := s.db.RevokeExpiredChallenges(); err != nil {
 		return err
 	}
 
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"time"
+
+	"github.com/mdouchement/standardfile/internal/database"
+	"github.com/mdouchement/standardfile/internal/model"
+	"github.com/pkg/errors"
+)
+
+type (
+	// A RevisionRetention defines how long the revisions are kept.
+	RevisionRetention struct {
+		// Count is the maximum number of revisions kept per item, 0 means unlimited.
+		Count int
+		// Age is the maximum age of a revision, 0 means unlimited.
+		Age time.Duration
+	}
+
+	// A RevisionService is a service used for managing item revisions.
+	RevisionService interface {
+		// Keep stores the given item as a revision and applies the retention count.
+		Keep(item *model.Item) error
+		// Forget deletes all the revisions of the given item.
+		Forget(item *model.Item) error
+		// Prune deletes the revisions older than the retention age and returns the number of deleted revisions.
+		Prune() (int, error)
+	}
+
+	revisionService struct {
+		db        database.Client
+		retention RevisionRetention
+	}
+)
+
+// NewRevision instantiates a new Revision service.
+func NewRevision(db database.Client, retention RevisionRetention) RevisionService {
+	return &revisionService{
+		db:        db,
+		retention: retention,
+	}
+}
+
+func (s *revisionService) Keep(item *model.Item) error {
+	if err := s.db.Save(model.NewRevision(item)); err != nil {
+		return errors.Wrap(err, "could not save revision")
+	}
+
+	if s.retention.Count <= 0 {
+		return nil
+	}
+
+	revisions, err := s.db.FindRevisionsByItemID(item.ID, item.UserID)
+	if err != nil {
+		return err
+	}
+
+	if len(revisions) <= s.retention.Count {
+		return nil
+	}
+
+	for _, revision := range revisions[s.retention.Count:] {
+		if err = s.db.Delete(revision); err != nil && !s.db.IsNotFound(err) {
+			return errors.Wrap(err, "could not delete revision")
+		}
+	}
+	return nil
+}
+
+func (s *revisionService) Forget(item *model.Item) error {
+	return s.db.DeleteRevisionsByItemID(item.ID, item.UserID)
+}
+
+func (s *revisionService) Prune() (int, error) {
+	if s.retention.Age <= 0 {
+		return 0, nil
+	}
+
+	return s.db.DeleteRevisionsBefore(time.Now().Add(-s.retention.Age))
+}
@@ -1,6 +1,9 @@
 package service
 
-import "github.com/mdouchement/standardfile/internal/model"
+import (
+	"github.com/mdouchement/standardfile/internal/model"
+	"github.com/sirupsen/logrus"
+)
 
 // M is an arbitrary map.
 type M map[string]any
@@ -10,4 +13,13 @@ type Params struct {
 	APIVersion string `json:"api"` // Since 20190520
 	UserAgent  string
 	Session    *model.Session
+	// Logger of the request, the standard logger is used when nil.
+	Logger logrus.FieldLogger `json:"-"`
+}
+
+func (p Params) logger() logrus.FieldLogger {
+	if p.Logger == nil {
+		return logrus.StandardLogger()
+	}
+	return p.Logger
 }
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/mdouchement/standardfile/internal/database"
+	"github.com/mdouchement/standardfile/internal/model"
+	"github.com/mdouchement/standardfile/internal/sferror"
+	"github.com/pkg/errors"
+)
+
+// Setting names used by the official clients.
+// https://github.com/standardnotes/server/tree/main/packages/settings
+const (
+	SettingMFASecret                    = "MFA_SECRET"
+	SettingEmailBackupFrequency         = "EMAIL_BACKUP_FREQUENCY"
+	SettingMuteFailedBackupsEmails      = "MUTE_FAILED_BACKUPS_EMAILS"
+	SettingMuteFailedCloudBackupsEmails = "MUTE_FAILED_CLOUD_BACKUPS_EMAILS"
+	SettingMuteSignInEmails             = "MUTE_SIGN_IN_EMAILS"
+	SettingMuteMarketingEmails          = "MUTE_MARKETING_EMAILS"
+	SettingLogSessionUserAgent          = "LOG_SESSION_USER_AGENT"
+	SettingListedAuthorSecrets          = "LISTED_AUTHOR_SECRETS"
+)
+
+var (
+	muteValues = []string{"muted", "not_muted"}
+
+	// settings defines the settings accepted by the server.
+	settings = map[string]struct {
+		sensitive bool
+		values    []string // Empty means any value
+	}{
+		SettingMFASecret:                    {sensitive: true},
+		SettingEmailBackupFrequency:         {values: []string{"disabled", "daily", "weekly"}},
+		SettingMuteFailedBackupsEmails:      {values: muteValues},
+		SettingMuteFailedCloudBackupsEmails: {values: muteValues},
+		SettingMuteSignInEmails:             {values: muteValues},
+		SettingMuteMarketingEmails:          {values: muteValues},
+		SettingLogSessionUserAgent:          {values: []string{"enabled", "disabled"}},
+		SettingListedAuthorSecrets:          {sensitive: true},
+	}
+)
+
+type (
+	// SettingParams are used to create or update a setting.
+	SettingParams struct {
+		Name                    string `json:"name"`
+		Value                   string `json:"value"`
+		Sensitive               bool   `json:"sensitive"`
+		ServerEncryptionVersion int    `json:"serverEncryptionVersion"`
+		// MFACode is the code of the enabled two-factor authentication required to replace the MFA_SECRET setting.
+		MFACode string `json:"mfa_code"`
+	}
+
+	// A SettingService is a service used for managing the user settings.
+	SettingService interface {
+		// List returns the settings of the given user, the sensitive ones are omitted.
+		List(user *model.User) ([]*model.Setting, error)
+		// Get returns the setting of the given user.
+		Get(user *model.User, name string) (*model.Setting, error)
+		// Update creates or updates the setting of the given user.
+		// It returns true when the setting is created.
+		Update(user *model.User, params SettingParams) (*model.Setting, bool, error)
+		// Delete deletes the setting of the given user.
+		// The code of the two-factor authentication is required to delete the MFA_SECRET setting.
+		Delete(user *model.User, name, code string) error
+	}
+
+	settingService struct {
+		db  database.Client
+		mfa MFAService
+	}
+)
+
+// NewSetting instantiates a new Setting service.
+// The MFA_SECRET setting is handled by the given MFA service.
+func NewSetting(db database.Client, mfa MFAService) SettingService {
+	return &settingService{
+		db:  db,
+		mfa: mfa,
+	}
+}
+
+func (s *settingService) List(user *model.User) ([]*model.Setting, error) {
+	settings, err := s.db.FindSettingsByUserID(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(settings, func(setting *model.Setting) bool {
+		return setting.Sensitive
+	}), nil
+}
+
+func (s *settingService) Get(user *model.User, name string) (*model.Setting, error) {
+	if name == SettingMFASecret {
+		if !s.mfa.Enabled(user) {
+			return nil, settingNotFound(user, name)
+		}
+		return mfaSetting(user), nil
+	}
+
+	setting, err := s.db.FindSettingByName(name, user.ID)
+	if err != nil {
+		if s.db.IsNotFound(err) {
+			return nil, settingNotFound(user, name)
+		}
+		return nil, errors.Wrap(err, "could not get setting")
+	}
+	return setting, nil
+}
+
+func (s *settingService) Update(user *model.User, params SettingParams) (*model.Setting, bool, error) {
+	definition, ok := settings[params.Name]
+	if !ok {
+		return nil, false, sferror.NewWithTagCode(http.StatusBadRequest, "", fmt.Sprintf("Setting name %s is invalid.", params.Name))
+	}
+
+	if len(definition.values) > 0 && !slices.Contains(definition.values, params.Value) {
+		return nil, false, sferror.NewWithTagCode(http.StatusBadRequest, "", fmt.Sprintf("Setting value %s is invalid for %s.", params.Value, params.Name))
+	}
+
+	if params.Name == SettingMFASecret {
+		created := !s.mfa.Enabled(user)
+		if !created {
+			if err := s.verifyMFA(user, params.MFACode); err != nil {
+				return nil, false, err
+			}
+		}
+
+		if err := s.mfa.Store(user, params.Value); err != nil {
+			return nil, false, err
+		}
+		return mfaSetting(user), created, nil
+	}
+
+	setting, err := s.db.FindSettingByName(params.Name, user.ID)
+	if err != nil && !s.db.IsNotFound(err) {
+		return nil, false, errors.Wrap(err, "could not get setting")
+	}
+
+	created := setting == nil
+	if created {
+		setting = &model.Setting{
+			UserID: user.ID,
+			Name:   params.Name,
+		}
+	}
+	setting.Value = params.Value
+	setting.Sensitive = definition.sensitive || params.Sensitive
+	setting.ServerEncryptionVersion = params.ServerEncryptionVersion
+
+	if err = s.db.Save(setting); err != nil {
+		return nil, false, errors.Wrap(err, "could not persist setting")
+	}
+	return setting, created, nil
+}
+
+func (s *settingService) Delete(user *model.User, name, code string) error {
+	setting, err := s.Get(user, name)
+	if err != nil {
+		return err
+	}
+
+	if name == SettingMFASecret {
+		if err = s.verifyMFA(user, code); err != nil {
+			return err
+		}
+		return s.mfa.Reset(user)
+	}
+
+	return errors.Wrap(s.db.Delete(setting), "could not delete setting")
+}
+
+// verifyMFA checks the code of the enabled two-factor authentication like the MFA endpoints.
+func (s *settingService) verifyMFA(user *model.User, code string) error {
+	return s.mfa.Verify(user, map[string]string{s.mfa.Key(user): code}, false)
+}
+
+// logSessionUserAgent returns false when the user disabled the LOG_SESSION_USER_AGENT setting.
+func logSessionUserAgent(db database.Client, userID string) bool {
+	setting, err := db.FindSettingByName(SettingLogSessionUserAgent, userID)
+	if err != nil {
+		return true
+	}
+	return setting.Value != "disabled"
+}
+
+// mfaSetting returns the MFA_SECRET setting stored on the user.
+func mfaSetting(user *model.User) *model.Setting {
+	setting := &model.Setting{
+		UserID:    user.ID,
+		Name:      SettingMFASecret,
+		Sensitive: true,
+	}
+	setting.CreatedAt = user.UpdatedAt
+	setting.UpdatedAt = user.UpdatedAt
+	return setting
+}
+
+func settingNotFound(user *model.User, name string) error {
+	return sferror.NewWithTagCode(http.StatusBadRequest, "", fmt.Sprintf("Setting %s for user %s not found!", name, user.ID))
+}
@@ -1,17 +1,22 @@
 package service
 
 import (
-	"crypto/sha256"
-	"fmt"
+	"bytes"
+	"encoding/json"
+	"io"
+	"slices"
 	"sort"
-	"strings"
 	"time"
 
 	"github.com/mdouchement/standardfile/internal/database"
 	"github.com/mdouchement/standardfile/internal/model"
 	"github.com/mdouchement/standardfile/pkg/libsf"
+	"github.com/pkg/errors"
 )
 
+// retrievedPrefix is the beginning of a marshaled sync result without retrieved items.
+const retrievedPrefix = `{"retrieved_items":[]`
+
 type (
 	// A SyncParams is used when a client want to sync items.
 	SyncParams struct {
@@ -28,12 +33,30 @@ type (
 	SyncService interface {
 		// Execute performs the synchronisation.
 		Execute() error
+		// Stats returns the number of saved and conflicted items of the performed synchronisation.
+		Stats() (saved, conflicted int)
+		// WriteJSON writes the result of the performed synchronisation to w.
+		// The retrieved items of a first sync are streamed from the database.
+		WriteJSON(w io.Writer) error
 	}
 
 	syncServiceBase struct {
-		db     database.Client
-		User   *model.User `json:"-"`
-		Params SyncParams  `json:"-"`
+		db        database.Client
+		revisions RevisionService
+		notifier  Notifier
+		User      *model.User `json:"-"`
+		Params    SyncParams  `json:"-"`
+		query     itemsQuery
+		// stream is set when the retrieved items are read from the database by writeJSON.
+		stream bool
+	}
+
+	// An itemsQuery holds the parameters of the retrieved items.
+	itemsQuery struct {
+		contentType string
+		updated     time.Time
+		strict      bool
+		noDeleted   bool
 	}
 
 	errorItem struct {
@@ -43,16 +66,18 @@ type (
 )
 
 // NewSync instantiates a new Sync service.
-func NewSync(db database.Client, user *model.User, params SyncParams) (s SyncService) {
+func NewSync(db database.Client, revisions RevisionService, notifier Notifier, user *model.User, params SyncParams) (s SyncService) {
 	switch params.APIVersion {
 	case "20200115":
 		fallthrough
 	case "20190520":
 		s = &syncService20190520{
 			Base: &syncServiceBase{
-				db:     db,
-				User:   user,
-				Params: params,
+				db:        db,
+				revisions: revisions,
+				notifier:  notifier,
+				User:      user,
+				Params:    params,
 			},
 		}
 	case "20161215":
@@ -60,9 +85,11 @@ func NewSync(db database.Client, user *model.User, params SyncParams) (s SyncSer
 	default:
 		s = &syncService20161215{
 			Base: &syncServiceBase{
-				db:     db,
-				User:   user,
-				Params: params,
+				db:        db,
+				revisions: revisions,
+				notifier:  notifier,
+				User:      user,
+				Params:    params,
 			},
 		}
 	}
@@ -71,17 +98,7 @@ func NewSync(db database.Client, user *model.User, params SyncParams) (s SyncSer
 
 // Get
 func (s *syncServiceBase) get() ([]*model.Item, bool, error) {
-	if s.Params.SyncToken == "" {
-		// If it's the first sync request, front-load all exisitng items keys
-		// so that the client can decrypt incoming items without having to wait.
-		s.Params.Limit = 0
-	}
-
-	var (
-		updated   time.Time
-		strict    bool
-		noDeleted bool
-	)
+	s.query = itemsQuery{contentType: s.Params.ContentType}
 
 	// if both are present, cursor_token takes precedence as that would eventually return all results
 	// the distinction between getting results for a cursor and a sync token is that cursor results use a
@@ -90,42 +107,198 @@ func (s *syncServiceBase) get() ([]*model.Item, bool, error) {
 	// by using >=, we don't miss those results on a subsequent call with a cursor token.
 	switch {
 	case s.Params.CursorToken != "":
-		updated = libsf.TimeFromToken(s.Params.CursorToken)
+		s.query.updated = libsf.TimeFromToken(s.Params.CursorToken)
 	case s.Params.SyncToken != "":
-		updated = libsf.TimeFromToken(s.Params.SyncToken)
-		strict = true
+		s.query.updated = libsf.TimeFromToken(s.Params.SyncToken)
+		s.query.strict = true
 	default:
 		// if no cursor token and no sync token, this is an initial sync. No need to return deleted items.
-		noDeleted = true
+		s.query.noDeleted = true
+	}
+
+	if s.Params.SyncToken == "" {
+		// If it's the first sync request, front-load all exisitng items keys
+		// so that the client can decrypt incoming items without having to wait.
+		s.Params.Limit = 0
+		// All the items can't be loaded at once, they are streamed to the response by writeJSON.
+		// Only the incoming ones are loaded to be checked for conflicts.
+		s.stream = true
+		items, err := s.getIncoming()
+		return items, false, err
 	}
 
 	return s.db.FindItemsByParams(
-		s.User.ID, s.Params.ContentType,
-		updated, strict,
-		noDeleted, s.Params.Limit)
+		s.User.ID, s.query.contentType,
+		s.query.updated, s.query.strict,
+		s.query.noDeleted, s.Params.Limit)
+}
+
+// GetIncoming returns the retrieved items that are also incoming, as they are before being saved.
+func (s *syncServiceBase) getIncoming() ([]*model.Item, error) {
+	items := make([]*model.Item, 0)
+	found := map[string]bool{}
+	for _, incoming := range s.Params.Items {
+		if found[incoming.ID] {
+			continue
+		}
+
+		item, err := s.db.FindItemByUserID(incoming.ID, s.User.ID)
+		if err != nil {
+			if s.db.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		if s.query.match(item) {
+			items = append(items, item)
+			found[item.ID] = true
+		}
+	}
+	return items, nil
+}
+
+// WriteJSON writes the marshaled result followed by the retrieved items.
+// The result's first field must be the retrieved items and they must be empty.
+func (s *syncServiceBase) writeJSON(w io.Writer, result any, retrieved []*model.Item) error {
+	payload, err := json.Marshal(result)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal sync result")
+	}
+	if !bytes.HasPrefix(payload, []byte(retrievedPrefix)) {
+		return errors.New("retrieved items must be the first field of the sync result")
+	}
+
+	sep := []byte{'['}
+	write := func(item *model.Item) error {
+		b, err := json.Marshal(item)
+		if err != nil {
+			return errors.Wrap(err, "could not marshal item")
+		}
+
+		if _, err = w.Write(sep); err != nil {
+			return err
+		}
+		sep[0] = ','
+		_, err = w.Write(b)
+		return err
+	}
+
+	if _, err = io.WriteString(w, `{"retrieved_items":`); err != nil {
+		return err
+	}
+
+	if s.stream {
+		// The incoming items have already been retrieved or removed as conflicted,
+		// they are merged with the streamed ones, most recently updated first.
+		incoming := map[string]bool{}
+		for _, item := range s.Params.Items {
+			incoming[item.ID] = true
+		}
+		retrieved = slices.Clone(retrieved)
+		sort.SliceStable(retrieved, func(i, j int) bool {
+			return retrieved[i].UpdatedAt.After(*retrieved[j].UpdatedAt)
+		})
+
+		err = s.db.ForEachItemByParams(
+			s.User.ID, s.query.contentType,
+			s.query.updated, s.query.strict,
+			s.query.noDeleted, func(item *model.Item) error {
+				if incoming[item.ID] {
+					return nil
+				}
+
+				for len(retrieved) > 0 && retrieved[0].UpdatedAt.After(*item.UpdatedAt) {
+					if err := write(retrieved[0]); err != nil {
+						return err
+					}
+					retrieved = retrieved[1:]
+				}
+				return write(item)
+			})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, item := range retrieved {
+		if err = write(item); err != nil {
+			return err
+		}
+	}
+
+	if sep[0] == '[' {
+		// No item
+		if _, err = w.Write(sep); err != nil {
+			return err
+		}
+	}
+	_, err = w.Write(payload[len(retrievedPrefix)-1:])
+	return err
+}
+
+// Match reports whether the item is selected by the query.
+func (q itemsQuery) match(item *model.Item) bool {
+	switch {
+	case q.contentType != "" && item.ContentType != q.contentType:
+		return false
+	case q.noDeleted && item.Deleted:
+		return false
+	case q.updated.IsZero():
+		return true
+	case item.UpdatedAt == nil:
+		return false
+	case q.strict:
+		return item.UpdatedAt.After(q.updated)
+	default:
+		return !item.UpdatedAt.Before(q.updated)
+	}
 }
 
 // Compute data signature for integrity check
-//
-// https://github.com/standardfile/sfjs/blob/499fd0bc7ebddfc72f8b1dc3c9cbf134e92016d3/lib/app/lib/modelManager.js#L664-L677
 func (s *syncServiceBase) computeDataSignature() (string, error) {
-	items, err := s.db.FindItemsForIntegrityCheck(s.User.ID)
-	if err != nil {
-		return "", err
+	return database.DataSignature(s.db, s.User.ID)
+}
+
+// Revise keeps the previous version of an item overwritten by the incoming one.
+// Revisions are dropped when the item is deleted.
+func (s *syncServiceBase) revise(previous, incoming *model.Item) {
+	if incoming.Deleted {
+		if err := s.revisions.Forget(incoming); err != nil {
+			s.Params.logger().WithError(err).Error("could not delete item revisions")
+		}
+		return
 	}
 
-	timestamps := []string{}
-	for _, item := range items {
-		// Unix timestamp in milliseconds (like MRI's `Time.now.to_datetime.strftime('%Q')`)
-		timestamps = append(timestamps, fmt.Sprintf("%d", item.UpdatedAt.UnixMilli()))
+	if previous == nil || previous.Deleted || previous.Content == "" || previous.Content == incoming.Content {
+		return
 	}
 
-	sort.SliceStable(timestamps, func(i, j int) bool {
-		return timestamps[j] < timestamps[i]
-	})
+	if err := s.revisions.Keep(previous); err != nil {
+		s.Params.logger().WithError(err).Error("could not keep item revision")
+	}
+}
+
+// Notify pushes the saved items to the other sessions of the user.
+func (s *syncServiceBase) notify(items []*model.Item) {
+	if len(items) == 0 {
+		return
+	}
+
+	ids := make([]string, len(items))
+	for i, item := range items {
+		ids[i] = item.ID
+	}
+
+	var sessionID string
+	if s.Params.Session != nil {
+		sessionID = s.Params.Session.ID
+	}
 
-	b := []byte(strings.Join(timestamps, ","))
-	return fmt.Sprintf("%x", sha256.Sum256(b)), nil
+	s.notifier.Notify(s.User.ID, sessionID, Event{
+		Type:  EventItemsChanged,
+		Items: ids,
+	})
 }
 
 // PrepareDelete
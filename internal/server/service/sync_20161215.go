@@ -1,6 +1,7 @@
 package service
 
 import (
+	"io"
 	"math"
 	"time"
 
@@ -89,6 +90,16 @@ func (s *syncService20161215) Execute() error {
 	return nil
 }
 
+func (s *syncService20161215) Stats() (saved, conflicted int) {
+	return len(s.Saved), len(s.Unsaved)
+}
+
+func (s *syncService20161215) WriteJSON(w io.Writer) error {
+	result := *s
+	result.Retrieved = []*model.Item{}
+	return s.Base.writeJSON(w, result, s.Retrieved)
+}
+
 // Save
 func (s *syncService20161215) save() (saved []*model.Item, unsaved []*UnsavedItem) {
 	saved = make([]*model.Item, 0)
@@ -105,7 +116,12 @@ func (s *syncService20161215) save() (saved []*model.Item, unsaved []*UnsavedIte
 			s.Base.prepareDelete(item)
 		}
 
-		err := s.Base.db.Save(item) // aka item.update(..)
+		previous, err := s.Base.db.FindItemByUserID(item.ID, s.Base.User.ID)
+		if err != nil {
+			previous = nil
+		}
+
+		err = s.Base.db.Save(item) // aka item.update(..)
 		if err != nil {
 			// TODO return an Internal Server Error?
 			unsaved = append(unsaved, &UnsavedItem{
@@ -120,6 +136,7 @@ func (s *syncService20161215) save() (saved []*model.Item, unsaved []*UnsavedIte
 			continue
 		}
 
+		s.Base.revise(previous, item)
 		saved = append(saved, item)
 	}
 
@@ -1,12 +1,12 @@
 package service
 
 import (
+	"io"
 	"math"
 	"time"
 
 	"github.com/mdouchement/standardfile/internal/model"
 	"github.com/mdouchement/standardfile/pkg/libsf"
-	"github.com/sirupsen/logrus"
 )
 
 // Ignore differences that are at most this many seconds apart
@@ -44,6 +44,7 @@ func (s *syncService20190520) Execute() error {
 
 	var retrievedToDelete map[string]bool
 	s.Saved, s.Conflicts, retrievedToDelete = s.save()
+	s.Base.notify(s.Saved)
 
 	// Remove potential conflicted items
 	var n int
@@ -93,6 +94,16 @@ func (s *syncService20190520) Execute() error {
 	return nil
 }
 
+func (s *syncService20190520) Stats() (saved, conflicted int) {
+	return len(s.Saved), len(s.Conflicts)
+}
+
+func (s *syncService20190520) WriteJSON(w io.Writer) error {
+	result := *s
+	result.Retrieved = []*model.Item{}
+	return s.Base.writeJSON(w, result, s.Retrieved)
+}
+
 // Save
 func (s *syncService20190520) save() (saved []*model.Item, conflicts []*ConflictItem, tobedeleted map[string]bool) {
 	saved = make([]*model.Item, 0)
@@ -110,7 +121,7 @@ func (s *syncService20190520) save() (saved []*model.Item, conflicts []*Conflict
 		newRecord := s.Base.db.IsNotFound(err)
 		if err != nil && !newRecord {
 			// TODO: return an Internal Server Error?
-			logrus.WithError(err).Error("could not find item")
+			s.Base.Params.logger().WithError(err).Error("could not find item")
 			conflicts = append(conflicts, &ConflictItem{
 				UnsavedItem: incomingItem,
 				Type:        "internal_error", // FIXME: do not exists in reference implementation.
@@ -157,7 +168,7 @@ func (s *syncService20190520) save() (saved []*model.Item, conflicts []*Conflict
 		if err != nil {
 			// TODO: return an Internal Server Error?
 			// Type is pretty useless because `Save` will insert or update.
-			logrus.WithError(err).Error("could not save item")
+			s.Base.Params.logger().WithError(err).Error("could not save item")
 			conflicts = append(conflicts, &ConflictItem{
 				UnsavedItem: incomingItem,
 				Type:        "uuid_conflict",
@@ -165,6 +176,10 @@ func (s *syncService20190520) save() (saved []*model.Item, conflicts []*Conflict
 			continue
 		}
 
+		if !newRecord {
+			s.Base.revise(serverItem, incomingItem)
+		}
+
 		saved = append(saved, incomingItem)
 	}
 
@@ -1,7 +1,10 @@
 package service
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	argon2 "github.com/mdouchement/simple-argon2"
@@ -22,6 +25,7 @@ type (
 		Login(params LoginParams) (Render, error)
 		Update(user *model.User, params UpdateUserParams) (Render, error)
 		Password(user *model.User, params UpdatePasswordParams) (Render, error)
+		Delete(user *model.User, params DeleteUserParams) error
 	}
 
 	// RegisterParams are used to register a user.
@@ -35,6 +39,7 @@ type (
 		Created              string `json:"created"`     // Since 20200115
 		Identifier           string `json:"identifier"`  // Since 20200115
 		Origination          string `json:"origination"` // Since 20200115
+		InviteCode           string `json:"invite_code"` // Only used by the invite-only registration
 	}
 
 	// LoginParams are used to login a user.
@@ -44,6 +49,8 @@ type (
 		Password      string `json:"password"`
 		CodeChallenge string `json:"code_challenge"`
 		CodeVerifier  string `json:"code_verifier"`
+		// MFA contains the `mfa_<id>' parameters holding the two-factor authentication code.
+		MFA map[string]string `json:"-"`
 	}
 
 	// UpdateUserParams are used to update a user.
@@ -64,6 +71,12 @@ type (
 		NewEmail        string `json:"new_email"`
 	}
 
+	// DeleteUserParams are used to delete a user.
+	DeleteUserParams struct {
+		Params
+		Password string `json:"password"`
+	}
+
 	// Success handler that generates response payload.
 	success func(u *model.User, p Params, r M) (Render, error)
 
@@ -155,6 +168,11 @@ func (s *userServiceBase) login(params LoginParams, success success, response M)
 		return nil, errors.Wrap(err, "could not validate password")
 	}
 
+	// Checked after the password so the status of the account is not disclosed.
+	if user.Disabled {
+		return nil, sferror.NewWithTagCode(http.StatusForbidden, "account-disabled", "This account has been disabled.")
+	}
+
 	return success(user, params.Params, response)
 }
 
@@ -197,6 +215,43 @@ func (s *userServiceBase) password(user *model.User, params UpdatePasswordParams
 	return success(user, params.Params, response)
 }
 
+func (s *userServiceBase) remove(user *model.User, params DeleteUserParams) error {
+	// Verify Password
+	if err := argon2.CompareHashAndPasswordString(user.Password, params.Password); err != nil {
+		if err == argon2.ErrMismatchedHashAndPassword {
+			return sferror.NewWithTagCode(http.StatusUnauthorized, "", "The current password you entered is incorrect. Please try again.")
+		}
+		return errors.Wrap(err, "could not validate password")
+	}
+
+	return errors.Wrap(s.db.DeleteUser(user.ID), "could not delete user")
+}
+
+// UnmarshalJSON implements json.Unmarshaler by also capturing the `mfa_<id>' parameters.
+func (p *LoginParams) UnmarshalJSON(data []byte) error {
+	type params LoginParams // Avoids recursion
+	if err := json.Unmarshal(data, (*params)(p)); err != nil {
+		return err
+	}
+
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	for k, v := range raw {
+		if !strings.HasPrefix(k, "mfa_") {
+			continue
+		}
+
+		if p.MFA == nil {
+			p.MFA = map[string]string{}
+		}
+		p.MFA[k] = fmt.Sprint(v)
+	}
+	return nil
+}
+
 // updates given user with given params.
 // works like strong_parameter.
 func (s *userServiceBase) apply(u *model.User, params UpdateUserParams) {
@@ -1,12 +1,12 @@
 package service
 
 import (
-	"log"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/mdouchement/standardfile/internal/model"
 	"github.com/mdouchement/standardfile/internal/server/serializer"
+	"github.com/sirupsen/logrus"
 )
 
 type userService20161215 struct {
@@ -29,6 +29,10 @@ func (s *userService20161215) Password(user *model.User, params UpdatePasswordPa
 	return s.password(user, params, s.SuccessfulAuthentication, nil)
 }
 
+func (s *userService20161215) Delete(user *model.User, params DeleteUserParams) error {
+	return s.remove(user, params)
+}
+
 func (s *userService20161215) SuccessfulAuthentication(u *model.User, _ Params, response M) (Render, error) {
 	if response == nil {
 		response = M{}
@@ -49,7 +53,7 @@ func (s *userService20161215) CreateJWT(u *model.User) string {
 
 	t, err := token.SignedString(s.sessions.JWTSigningKey())
 	if err != nil {
-		log.Fatalf("could not generate token: %s", err)
+		logrus.WithError(err).Fatal("could not generate token")
 	}
 	return t
 }
@@ -80,7 +80,9 @@ func (s *userService20200115) CreateSession(u *model.User, params Params) (*mode
 	session := s.sessions.Generate()
 	session.UserID = u.ID
 	session.APIVersion = params.APIVersion
-	session.UserAgent = params.UserAgent
+	if logSessionUserAgent(s.db, u.ID) {
+		session.UserAgent = params.UserAgent
+	}
 
 	if err := s.db.Save(session); err != nil {
 		return nil, sferror.NewWithTagCode(http.StatusBadRequest, "", "Could not create a session.")
@@ -39,6 +39,11 @@ type (
 		Regenerate(session *model.Session) error
 		// UserFromToken the user for the given token.
 		UserFromToken(token any) (*model.User, error)
+		// ValetToken generates the valet token for the given claims.
+		ValetToken(valet *Valet) (string, error)
+		// ParseValetToken parses and validates the given raw valet token.
+		// The token is no longer valid once its user is disabled or deleted, or its session is revoked.
+		ParseValetToken(token string) (*Valet, error)
 	}
 
 	manager struct {
@@ -181,6 +186,10 @@ func (m *manager) Paseto(token middlewarex.Token) (*model.User, error) {
 		return nil, errors.Wrap(err, "could not get access to database")
 	}
 
+	if user.Disabled {
+		return nil, sferror.NewWithTagCode(http.StatusUnauthorized, "invalid-auth", "Invalid login credentials.")
+	}
+
 	return user, nil
 }
 
@@ -218,6 +227,10 @@ func (m *manager) JWT(token *jwt.Token) (*model.User, error) {
 		return nil, sferror.NewWithTagCode(http.StatusUnauthorized, "invalid-auth", "Revoked token.")
 	}
 
+	if user.Disabled {
+		return nil, sferror.NewWithTagCode(http.StatusUnauthorized, "invalid-auth", "Invalid login credentials.")
+	}
+
 	return user, nil
 }
 
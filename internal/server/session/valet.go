@@ -0,0 +1,132 @@
+package session
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/mdouchement/standardfile/internal/model"
+	"github.com/mdouchement/standardfile/internal/sferror"
+	"github.com/o1egl/paseto/v2"
+	"github.com/pkg/errors"
+)
+
+// Defines valet token operations.
+const (
+	ValetRead   = "read"
+	ValetWrite  = "write"
+	ValetDelete = "delete"
+)
+
+const (
+	valetAudience       = "valet-token"
+	valetExpirationTime = 2 * time.Hour
+)
+
+type (
+	// A ValetResource is a file referenced by a valet token.
+	ValetResource struct {
+		RemoteIdentifier    string `json:"remoteIdentifier"`
+		UnencryptedFileSize int64  `json:"unencryptedFileSize"`
+	}
+
+	// A Valet holds the claims of a valet token.
+	// A valet token grants an operation on a single file to the files endpoints,
+	// as long as its user and session remain valid.
+	Valet struct {
+		Issuer           string          `json:"iss"`
+		Audience         string          `json:"aud"`
+		UserID           string          `json:"userUuid"`
+		SessionID        string          `json:"sessionUuid,omitempty"`
+		Operation        string          `json:"operation"`
+		Resources        []ValetResource `json:"resources"`
+		UploadBytesUsed  int64           `json:"uploadBytesUsed"`
+		UploadBytesLimit int64           `json:"uploadBytesLimit"`
+		IssuedAt         time.Time       `json:"iat"`
+		ExpireAt         time.Time       `json:"exp"`
+	}
+)
+
+// NewValet returns the claims of a new valet token for the given user and session.
+// The session is nil when the user is authenticated with a JWT.
+func NewValet(user *model.User, session *model.Session, operation string, resources []ValetResource) *Valet {
+	now := time.Now().UTC()
+
+	valet := &Valet{
+		Issuer:    "standardfile",
+		Audience:  valetAudience,
+		UserID:    user.ID,
+		Operation: operation,
+		Resources: resources,
+		IssuedAt:  now,
+		ExpireAt:  now.Add(valetExpirationTime),
+	}
+	if session != nil {
+		valet.SessionID = session.ID
+	}
+
+	return valet
+}
+
+// Resource returns the resource of the valet.
+func (v *Valet) Resource() string {
+	if len(v.Resources) == 0 {
+		return ""
+	}
+	return v.Resources[0].RemoteIdentifier
+}
+
+func (m *manager) ValetToken(valet *Valet) (string, error) {
+	return paseto.Encrypt(m.sessionSecret, valet, []byte{})
+}
+
+func (m *manager) ParseValetToken(token string) (*Valet, error) {
+	invalid := sferror.NewWithTagCode(http.StatusUnauthorized, "invalid-auth", "Invalid valet token.")
+
+	var valet Valet
+	if err := paseto.Decrypt(token, m.sessionSecret, &valet, nil); err != nil {
+		return nil, invalid
+	}
+
+	if valet.Issuer != "standardfile" || valet.Audience != valetAudience || len(valet.Resources) != 1 {
+		return nil, invalid
+	}
+
+	if valet.ExpireAt.Before(time.Now()) {
+		return nil, invalid
+	}
+
+	// The token is revoked along with its user and session.
+	user, err := m.db.FindUser(valet.UserID)
+	if err != nil {
+		if m.db.IsNotFound(err) {
+			return nil, invalid
+		}
+		return nil, errors.Wrap(err, "could not get access to database")
+	}
+
+	if user.Disabled {
+		return nil, invalid
+	}
+
+	if valet.SessionID == "" {
+		// Issued from a JWT, check if password has changed since token was generated.
+		if valet.IssuedAt.Unix() < user.PasswordUpdatedAt {
+			return nil, invalid
+		}
+		return &valet, nil
+	}
+
+	session, err := m.db.FindSessionByUserID(valet.SessionID, valet.UserID)
+	if err != nil {
+		if m.db.IsNotFound(err) {
+			return nil, invalid
+		}
+		return nil, errors.Wrap(err, "could not get access to database")
+	}
+
+	if m.isSessionExpired(session) {
+		return nil, invalid
+	}
+
+	return &valet, nil
+}
@@ -5,7 +5,9 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"github.com/mdouchement/standardfile/internal/database"
+	"github.com/mdouchement/standardfile/internal/model"
 	"github.com/mdouchement/standardfile/internal/server/serializer"
+	"github.com/mdouchement/standardfile/internal/server/service"
 	sessionpkg "github.com/mdouchement/standardfile/internal/server/session"
 	"github.com/mdouchement/standardfile/internal/sferror"
 	"github.com/pkg/errors"
@@ -15,6 +17,8 @@ type (
 	sess struct {
 		db       database.Client
 		sessions sessionpkg.Manager
+		notifier service.Notifier
+		audits   service.AuditService
 	}
 
 	refreshSessionParams struct {
@@ -108,6 +112,8 @@ func (s *sess) Refresh(c echo.Context) error {
 		return errors.Wrap(err, "could not generate refresh token")
 	}
 
+	record(c, s.audits, model.AuditSessionRefreshed, session.UserID, session.ID)
+
 	return c.JSON(http.StatusOK, echo.Map{
 		"session": echo.Map{
 			"access_token":       access,
@@ -151,6 +157,9 @@ func (s *sess) Delete(c echo.Context) error {
 	if err = s.db.Delete(session); err != nil {
 		return err
 	}
+	s.notifier.Disconnect(session.UserID, session.ID)
+
+	record(c, s.audits, model.AuditSessionRevoked, session.UserID, session.ID)
 	return c.NoContent(http.StatusNoContent)
 }
 
@@ -170,7 +179,9 @@ func (s *sess) DeleteAll(c echo.Context) error {
 		if err = s.db.Delete(session); err != nil {
 			return err
 		}
+		s.notifier.Disconnect(session.UserID, session.ID)
 	}
 
+	record(c, s.audits, model.AuditSessionsRevoked, current.UserID, current.ID)
 	return c.NoContent(http.StatusNoContent)
 }
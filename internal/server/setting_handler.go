@@ -0,0 +1,125 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mdouchement/standardfile/internal/model"
+	"github.com/mdouchement/standardfile/internal/server/serializer"
+	"github.com/mdouchement/standardfile/internal/server/service"
+	"github.com/mdouchement/standardfile/internal/sferror"
+)
+
+// setting contains all user setting handlers.
+type setting struct {
+	settings service.SettingService
+	audits   service.AuditService
+}
+
+// List lists the non-sensitive settings of the current user.
+func (h *setting) List(c echo.Context) error {
+	user := currentUser(c)
+	if c.Param("id") != user.ID {
+		return c.JSON(http.StatusUnauthorized, sferror.New("The given ID is not the user's one."))
+	}
+
+	settings, err := h.settings.List(user)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"success":  true,
+		"userUuid": user.ID,
+		"settings": serializer.Settings(settings),
+	})
+}
+
+// Show returns a setting of the current user.
+// Only the existence of a sensitive setting is disclosed.
+func (h *setting) Show(c echo.Context) error {
+	user := currentUser(c)
+	if c.Param("id") != user.ID {
+		return c.JSON(http.StatusUnauthorized, sferror.New("The given ID is not the user's one."))
+	}
+
+	setting, err := h.settings.Get(user, c.Param("name"))
+	if err != nil {
+		return err
+	}
+
+	if setting.Sensitive {
+		return c.JSON(http.StatusOK, echo.Map{
+			"success":   true,
+			"sensitive": true,
+		})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"success":  true,
+		"userUuid": user.ID,
+		"setting":  serializer.Setting(setting),
+	})
+}
+
+// Update creates or updates a setting of the current user.
+func (h *setting) Update(c echo.Context) error {
+	user := currentUser(c)
+	if c.Param("id") != user.ID {
+		return c.JSON(http.StatusUnauthorized, sferror.New("The given ID is not the user's one."))
+	}
+
+	var params service.SettingParams
+	if err := c.Bind(&params); err != nil {
+		logger(c).WithError(err).Warn("could not get parameters")
+		return c.JSON(http.StatusBadRequest, sferror.New("Could not get parameters."))
+	}
+
+	setting, created, err := h.settings.Update(user, params)
+	if err != nil {
+		return err
+	}
+	if params.Name == service.SettingMFASecret {
+		record(c, h.audits, model.AuditMFAEnabled, user.ID, currentSessionID(c))
+	}
+
+	code, status := http.StatusOK, "UPDATED"
+	if created {
+		code, status = http.StatusCreated, "CREATED"
+	}
+
+	return c.JSON(code, echo.Map{
+		"success":    true,
+		"setting":    serializer.Setting(setting),
+		"statusCode": status,
+	})
+}
+
+// Delete deletes a setting of the current user.
+// The MFA_SECRET setting requires the `mfa_code' of the two-factor authentication.
+func (h *setting) Delete(c echo.Context) error {
+	user := currentUser(c)
+	if c.Param("id") != user.ID {
+		return c.JSON(http.StatusUnauthorized, sferror.New("The given ID is not the user's one."))
+	}
+
+	var params struct {
+		Code string `json:"mfa_code" query:"mfa_code"`
+	}
+	if err := c.Bind(&params); err != nil {
+		logger(c).WithError(err).Warn("could not get parameters")
+		return c.JSON(http.StatusBadRequest, sferror.New("Could not get parameters."))
+	}
+
+	if err := h.settings.Delete(user, c.Param("name"), params.Code); err != nil {
+		return err
+	}
+	if c.Param("name") == service.SettingMFASecret {
+		record(c, h.audits, model.AuditMFADisabled, user.ID, currentSessionID(c))
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"success":     true,
+		"settingName": c.Param("name"),
+	})
+}
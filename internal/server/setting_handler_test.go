@@ -0,0 +1,238 @@
+package server_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gofight/v2"
+	"github.com/mdouchement/standardfile/internal/model"
+	"github.com/mdouchement/standardfile/internal/server/service"
+	"github.com/mdouchement/standardfile/internal/totp"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fastjson"
+)
+
+func TestRequestSettings(t *testing.T) {
+	engine, ctrl, r, cleanup := setup()
+	defer cleanup()
+
+	r.GET("/v1/users/42/settings").Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusUnauthorized, r.Code)
+	})
+
+	user, session := createUserWithSession(ctrl)
+	header := gofight.H{
+		"Authorization": "Bearer " + accessToken(ctrl, session),
+	}
+
+	r.GET("/v1/users/42/settings").SetHeader(header).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusUnauthorized, r.Code)
+		assert.JSONEq(t, `{"error":{"message":"The given ID is not the user's one."}}`, r.Body.String())
+	})
+
+	//
+	// Update
+	//
+
+	r.PUT("/v1/users/"+user.ID+"/settings").SetHeader(header).SetJSON(gofight.D{
+		"name":  "UNKNOWN",
+		"value": "42",
+	}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusBadRequest, r.Code)
+		assert.JSONEq(t, `{"error":{"message":"Setting name UNKNOWN is invalid."}}`, r.Body.String())
+	})
+
+	r.PUT("/v1/users/"+user.ID+"/settings").SetHeader(header).SetJSON(gofight.D{
+		"name":  "EMAIL_BACKUP_FREQUENCY",
+		"value": "hourly",
+	}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusBadRequest, r.Code)
+	})
+
+	for _, code := range []int{http.StatusCreated, http.StatusOK} {
+		r.PUT("/v1/users/"+user.ID+"/settings").SetHeader(header).SetJSON(gofight.D{
+			"name":  "EMAIL_BACKUP_FREQUENCY",
+			"value": "daily",
+		}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, code, r.Code)
+
+			v, err := fastjson.Parse(r.Body.String())
+			assert.NoError(t, err)
+			assert.Equal(t, "EMAIL_BACKUP_FREQUENCY", string(v.GetStringBytes("setting", "name")))
+			assert.Equal(t, "daily", string(v.GetStringBytes("setting", "value")))
+		})
+	}
+
+	r.PUT("/v1/users/"+user.ID+"/settings").SetHeader(header).SetJSON(gofight.D{
+		"name":      "LISTED_AUTHOR_SECRETS",
+		"value":     "secret",
+		"sensitive": false,
+	}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusCreated, r.Code)
+		assert.Equal(t, fastjson.TypeNull, fastjson.MustParse(r.Body.String()).Get("setting", "value").Type())
+	})
+
+	//
+	// Read
+	//
+
+	r.GET("/v1/users/"+user.ID+"/settings").SetHeader(header).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+
+		v, err := fastjson.Parse(r.Body.String())
+		assert.NoError(t, err)
+		assert.Len(t, v.GetArray("settings"), 1) // Sensitive settings are omitted
+		assert.Equal(t, "EMAIL_BACKUP_FREQUENCY", string(v.GetStringBytes("settings", "0", "name")))
+	})
+
+	r.GET("/v1/users/"+user.ID+"/settings/EMAIL_BACKUP_FREQUENCY").SetHeader(header).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+		assert.Equal(t, "daily", string(fastjson.MustParse(r.Body.String()).GetStringBytes("setting", "value")))
+	})
+
+	r.GET("/v1/users/"+user.ID+"/settings/LISTED_AUTHOR_SECRETS").SetHeader(header).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+		assert.JSONEq(t, `{"success":true,"sensitive":true}`, r.Body.String())
+	})
+
+	r.GET("/v1/users/"+user.ID+"/settings/MFA_SECRET").SetHeader(header).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusBadRequest, r.Code)
+	})
+
+	//
+	// MFA secret is stored on the user
+	//
+
+	r.PUT("/v1/users/"+user.ID+"/settings").SetHeader(header).SetJSON(gofight.D{
+		"name":                    "MFA_SECRET",
+		"value":                   "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+		"sensitive":               true,
+		"serverEncryptionVersion": 1,
+	}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusCreated, r.Code)
+	})
+
+	u, err := ctrl.Database.FindUser(user.ID)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, u.MFASecret)
+
+	r.GET("/v1/users/"+user.ID+"/settings/MFA_SECRET").SetHeader(header).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+		assert.JSONEq(t, `{"success":true,"sensitive":true}`, r.Body.String())
+	})
+
+	// The enabled two-factor authentication is required to replace the secret.
+	u.MFARecoveryCodes = []string{"recovery"}
+	assert.NoError(t, ctrl.Database.Save(u))
+
+	mfaKey := `{"mfa_key":"` + service.NewMFA(ctrl.Database, ctrl.MFASecretKey).Key(user) + `"}`
+	replace := gofight.D{
+		"name":  "MFA_SECRET",
+		"value": "MFRGGZDFMZTWQ2LKNNWG23TPOBYXE43U",
+	}
+
+	r.PUT("/v1/users/"+user.ID+"/settings").SetHeader(header).SetJSON(replace).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusUnauthorized, r.Code)
+		assert.JSONEq(t, `{"error":{"tag":"mfa-required","message":"Please enter your two-factor authentication code.","payload":`+mfaKey+`}}`, r.Body.String())
+	})
+
+	code, err := totp.Code("GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", time.Now())
+	assert.NoError(t, err)
+	replace["mfa_code"] = code
+
+	r.PUT("/v1/users/"+user.ID+"/settings").SetHeader(header).SetJSON(replace).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+	})
+
+	u, err = ctrl.Database.FindUser(user.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, u.MFARecoveryCodes)
+
+	r.DELETE("/v1/users/"+user.ID+"/settings/MFA_SECRET").SetHeader(header).SetJSON(gofight.D{}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusUnauthorized, r.Code)
+		assert.JSONEq(t, `{"error":{"tag":"mfa-required","message":"Please enter your two-factor authentication code.","payload":`+mfaKey+`}}`, r.Body.String())
+	})
+
+	r.DELETE("/v1/users/"+user.ID+"/settings/MFA_SECRET").SetHeader(header).SetJSON(gofight.D{"mfa_code": code}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusUnauthorized, r.Code)
+		assert.JSONEq(t, `{"error":{"tag":"mfa-invalid","message":"The two-factor authentication code you entered is incorrect. Please try again.","payload":`+mfaKey+`}}`, r.Body.String())
+	})
+
+	code, err = totp.Code("MFRGGZDFMZTWQ2LKNNWG23TPOBYXE43U", time.Now())
+	assert.NoError(t, err)
+
+	r.DELETE("/v1/users/"+user.ID+"/settings/MFA_SECRET").SetHeader(header).SetJSON(gofight.D{"mfa_code": code}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+	})
+
+	u, err = ctrl.Database.FindUser(user.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, u.MFASecret)
+
+	//
+	// Delete
+	//
+
+	r.DELETE("/v1/users/"+user.ID+"/settings/EMAIL_BACKUP_FREQUENCY").SetHeader(header).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+		assert.JSONEq(t, `{"success":true,"settingName":"EMAIL_BACKUP_FREQUENCY"}`, r.Body.String())
+	})
+
+	r.DELETE("/v1/users/"+user.ID+"/settings/EMAIL_BACKUP_FREQUENCY").SetHeader(header).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusBadRequest, r.Code)
+	})
+}
+
+func TestRequestSettingLogSessionUserAgent(t *testing.T) {
+	engine, ctrl, r, cleanup := setup()
+	defer cleanup()
+
+	user := createUser(ctrl)
+	user.Version = "004"
+	assert.NoError(t, ctrl.Database.Save(user))
+	assert.NoError(t, ctrl.Database.Save(&model.Setting{UserID: user.ID, Name: "LOG_SESSION_USER_AGENT", Value: "disabled"}))
+
+	r.POST("/v1/login").SetJSON(gofight.D{
+		"api":      "20200115",
+		"email":    user.Email,
+		"password": "password42",
+	}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+	})
+
+	sessions, err := ctrl.Database.FindSessionsByUserID(user.ID)
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 1)
+	assert.Empty(t, sessions[0].UserAgent)
+}
+
+func TestRequestUserParams(t *testing.T) {
+	engine, ctrl, r, cleanup := setup()
+	defer cleanup()
+
+	user, session := createUserWithSession(ctrl)
+	header := gofight.H{
+		"Authorization": "Bearer " + accessToken(ctrl, session),
+	}
+
+	r.GET("/v1/users/"+user.ID+"/params").SetHeader(header).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+		assert.JSONEq(t, `{"identifier":"george.abitbol@nowhere.lan", "pw_nonce":"nonce42", "version":"004"}`, r.Body.String())
+	})
+
+	r.PATCH("/v1/users/42").SetHeader(header).SetJSON(gofight.D{
+		"api":      "20200115",
+		"pw_nonce": "nonce43",
+	}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusUnauthorized, r.Code)
+	})
+
+	r.PATCH("/v1/users/"+user.ID).SetHeader(header).SetJSON(gofight.D{
+		"api":      "20200115",
+		"pw_nonce": "nonce43",
+	}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+		assert.Equal(t, "nonce43", string(fastjson.MustParse(r.Body.String()).GetStringBytes("user", "pw_nonce")))
+	})
+}
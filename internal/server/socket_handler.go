@@ -0,0 +1,73 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mdouchement/standardfile/internal/server/service"
+	sessionpkg "github.com/mdouchement/standardfile/internal/server/session"
+	"github.com/mdouchement/standardfile/internal/sferror"
+	"golang.org/x/net/websocket"
+)
+
+// socket contains all real-time notification handlers.
+type socket struct {
+	notifier service.Notifier
+	sessions sessionpkg.Manager
+}
+
+// Connect upgrades the connection to a WebSocket and pushes the events of the current user.
+// The events emitted by the current session are not sent back.
+// The connection is closed when the access token expires or when the session is terminated.
+func (h *socket) Connect(c echo.Context) error {
+	session := currentSession(c)
+	if session == nil {
+		return c.JSON(http.StatusUnauthorized, sferror.New("A session is required to receive notifications."))
+	}
+
+	subscription := h.notifier.Subscribe(currentUser(c).ID, session.ID)
+	defer h.notifier.Unsubscribe(subscription)
+
+	expiration := time.NewTimer(time.Until(h.sessions.AccessTokenExprireAt(session)))
+	defer expiration.Stop()
+
+	// The Origin header is not checked, the connection is authenticated by the access token.
+	server := websocket.Server{
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+
+			// The clients are not expected to send messages, reading only detects the closed connections.
+			closed := make(chan struct{})
+			go func() {
+				defer close(closed)
+
+				var discard string
+				for {
+					if err := websocket.Message.Receive(ws, &discard); err != nil {
+						return
+					}
+				}
+			}()
+
+			for {
+				select {
+				case <-closed:
+					return
+				case <-expiration.C:
+					return
+				case event, ok := <-subscription.Events:
+					if !ok {
+						return
+					}
+					if err := websocket.JSON.Send(ws, event); err != nil {
+						return
+					}
+				}
+			}
+		},
+	}
+	server.ServeHTTP(c.Response(), c.Request())
+
+	return nil
+}
@@ -0,0 +1,139 @@
+package server_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gofight/v2"
+	"github.com/mdouchement/standardfile/internal/model"
+	"github.com/mdouchement/standardfile/internal/server"
+	"github.com/mdouchement/standardfile/internal/server/service"
+	sessionpkg "github.com/mdouchement/standardfile/internal/server/session"
+	"github.com/mdouchement/standardfile/pkg/libsf"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+)
+
+func TestRequestSocket(t *testing.T) {
+	engine, ctrl, r, cleanup := setup()
+	defer cleanup()
+
+	ts := httptest.NewServer(engine)
+	defer ts.Close()
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/v1/sockets"
+
+	_, err := websocket.Dial(url, "", ts.URL)
+	assert.Error(t, err)
+
+	user, session := createUserWithSession(ctrl)
+	other := &model.Session{
+		APIVersion:   "20200115",
+		UserID:       user.ID,
+		ExpireAt:     time.Now().Add(ctrl.RefreshTokenExpirationTime).UTC(),
+		AccessToken:  sessionpkg.SecureToken(8),
+		RefreshToken: sessionpkg.SecureToken(8),
+	}
+	assert.NoError(t, ctrl.Database.Save(other))
+
+	ws, err := websocket.Dial(url+"?authToken="+accessToken(ctrl, session), "", ts.URL)
+	assert.NoError(t, err)
+	defer ws.Close()
+
+	sync := func(s *model.Session, item *model.Item) {
+		r.POST("/v1/items").SetHeader(gofight.H{
+			"Authorization": "Bearer " + accessToken(ctrl, s),
+		}).SetJSON(gofight.D{
+			"api":   "20200115",
+			"items": []*model.Item{item},
+		}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+	}
+
+	// Changes made by the listening session are not sent back.
+	sync(session, &model.Item{Content: "004:mine", ContentType: libsf.ContentTypeNote})
+
+	item := &model.Item{Content: "004:other", ContentType: libsf.ContentTypeNote}
+	assert.NoError(t, ctrl.Database.Save(item))
+	sync(other, item)
+
+	assert.NoError(t, ws.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+	var event service.Event
+	assert.NoError(t, websocket.JSON.Receive(ws, &event))
+	assert.Equal(t, service.EventItemsChanged, event.Type)
+	assert.Equal(t, []string{item.ID}, event.Items)
+}
+
+func TestRequestSocketDisconnect(t *testing.T) {
+	engine, ctrl, r, cleanup := setup()
+	defer cleanup()
+
+	ctrl.AdminToken = adminToken
+	engine = server.EchoEngine(ctrl)
+
+	ts := httptest.NewServer(engine)
+	defer ts.Close()
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/v1/sockets?authToken="
+
+	user, session := createUserWithSession(ctrl)
+	other := &model.Session{
+		APIVersion:   "20200115",
+		UserID:       user.ID,
+		ExpireAt:     time.Now().Add(ctrl.RefreshTokenExpirationTime).UTC(),
+		AccessToken:  sessionpkg.SecureToken(8),
+		RefreshToken: sessionpkg.SecureToken(8),
+	}
+	assert.NoError(t, ctrl.Database.Save(other))
+
+	closed := func(ws *websocket.Conn, timeout time.Duration) {
+		assert.NoError(t, ws.SetReadDeadline(time.Now().Add(timeout)))
+
+		var event service.Event
+		err := websocket.JSON.Receive(ws, &event)
+		assert.ErrorIs(t, err, io.EOF)
+	}
+
+	// Terminated by the revocation of its session.
+	ws, err := websocket.Dial(url+accessToken(ctrl, other), "", ts.URL)
+	assert.NoError(t, err)
+	defer ws.Close()
+
+	r.DELETE("/v1/sessions/"+other.ID).SetHeader(gofight.H{
+		"Authorization": "Bearer " + accessToken(ctrl, session),
+	}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusNoContent, r.Code)
+	})
+	closed(ws, time.Second)
+
+	// Terminated by the admin.
+	ws, err = websocket.Dial(url+accessToken(ctrl, session), "", ts.URL)
+	assert.NoError(t, err)
+	defer ws.Close()
+
+	r.DELETE("/admin/users/"+user.ID+"/sessions").SetHeader(gofight.H{
+		"Authorization": "Bearer " + adminToken,
+	}).Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+		assert.Equal(t, http.StatusOK, r.Code)
+	})
+	closed(ws, time.Second)
+
+	// Terminated by the expiration of the access token, in 2 seconds.
+	session = &model.Session{
+		APIVersion:   "20200115",
+		UserID:       user.ID,
+		ExpireAt:     time.Now().Add(ctrl.RefreshTokenExpirationTime - ctrl.AccessTokenExpirationTime + 2*time.Second).UTC(),
+		AccessToken:  sessionpkg.SecureToken(8),
+		RefreshToken: sessionpkg.SecureToken(8),
+	}
+	assert.NoError(t, ctrl.Database.Save(session))
+
+	ws, err = websocket.Dial(url+accessToken(ctrl, session), "", ts.URL)
+	assert.NoError(t, err)
+	defer ws.Close()
+	closed(ws, 5*time.Second)
+}
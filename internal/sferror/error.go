@@ -15,6 +15,7 @@ type (
 	err struct {
 		Tag     string `json:"tag,omitempty"`
 		Message string `json:"message"`
+		Payload any    `json:"payload,omitempty"`
 	}
 )
 
@@ -36,6 +37,11 @@ func NewWithTagCode(code int, tag, message string) *SFError {
 	return &SFError{HTTPCode: code, FieldError: err{Tag: tag, Message: message}}
 }
 
+// NewWithPayload returns a new SFError with the given code, tag, message and payload.
+func NewWithPayload(code int, tag, message string, payload any) *SFError {
+	return &SFError{HTTPCode: code, FieldError: err{Tag: tag, Message: message, Payload: payload}}
+}
+
 // Error implements error interface.
 func (e *SFError) Error() string {
 	return e.FieldError.Message
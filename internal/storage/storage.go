@@ -0,0 +1,337 @@
+// Package storage stores the encrypted files uploaded by the clients on the local disk.
+//
+// The files are stored as `<root>/<user_id>/<resource_id>` and the chunks of the pending uploads
+// as `<root>/.uploads/<user_id>/<resource_id>/<chunk_id>`.
+// The server never sees the plaintext, chunks are encrypted by the clients.
+package storage
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+)
+
+const uploads = ".uploads"
+
+var (
+	// ErrInvalidIdentifier is returned when a user or resource identifier is not an UUID.
+	ErrInvalidIdentifier = errors.New("invalid identifier")
+	// ErrQuotaExceeded is returned when a chunk exceeds the remaining quota.
+	ErrQuotaExceeded = errors.New("quota exceeded")
+)
+
+type (
+	// A Local is a file storage on the local disk.
+	Local struct {
+		root  string
+		mu    sync.Mutex
+		users map[string]*userMutex // Serializes the quota checks of each user
+	}
+
+	userMutex struct {
+		sync.Mutex
+		refs int
+	}
+)
+
+// NewLocal returns a new Local storage in the given root directory.
+func NewLocal(root string) (*Local, error) {
+	if err := os.MkdirAll(filepath.Join(root, uploads), 0o700); err != nil {
+		return nil, errors.Wrap(err, "could not create storage directory")
+	}
+
+	return &Local{
+		root:  root,
+		users: map[string]*userMutex{},
+	}, nil
+}
+
+// Lock serializes the writes of the given user so the usage does not change between a quota check and a write.
+// The returned function releases the lock.
+func (s *Local) Lock(userID string) func() {
+	s.mu.Lock()
+	m, ok := s.users[userID]
+	if !ok {
+		m = &userMutex{}
+		s.users[userID] = m
+	}
+	m.refs++
+	s.mu.Unlock()
+
+	m.Lock()
+	return func() {
+		m.Unlock()
+
+		s.mu.Lock()
+		m.refs--
+		if m.refs == 0 {
+			delete(s.users, userID)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// CreateUpload starts a new upload of the given resource, discarding any previous pending upload.
+func (s *Local) CreateUpload(userID, resourceID string) error {
+	dir, err := s.path(uploads, userID, resourceID)
+	if err != nil {
+		return err
+	}
+
+	if err = os.RemoveAll(dir); err != nil {
+		return errors.Wrap(err, "could not reset upload")
+	}
+
+	return errors.Wrap(os.MkdirAll(dir, 0o700), "could not create upload")
+}
+
+// WriteChunk stores the chunk read from r and returns its size.
+// At most max bytes are read, ErrQuotaExceeded is returned if the chunk is greater.
+// A negative max means unlimited.
+func (s *Local) WriteChunk(userID, resourceID string, chunkID int, r io.Reader, max int64) (int64, error) {
+	dir, err := s.path(uploads, userID, resourceID)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err = os.Stat(dir); err != nil {
+		return 0, errors.Wrap(err, "could not find upload")
+	}
+
+	f, err := os.Create(filepath.Join(dir, strconv.Itoa(chunkID)))
+	if err != nil {
+		return 0, errors.Wrap(err, "could not create chunk")
+	}
+	defer f.Close()
+
+	if max >= 0 {
+		r = io.LimitReader(r, max+1)
+	}
+
+	n, err := io.Copy(f, r)
+	if err != nil {
+		return n, errors.Wrap(err, "could not write chunk")
+	}
+
+	if max >= 0 && n > max {
+		os.Remove(f.Name())
+		return n, ErrQuotaExceeded
+	}
+
+	return n, errors.Wrap(f.Sync(), "could not write chunk")
+}
+
+// CloseUpload assembles the uploaded chunks into the final file and returns its size.
+func (s *Local) CloseUpload(userID, resourceID string) (int64, error) {
+	dir, err := s.path(uploads, userID, resourceID)
+	if err != nil {
+		return 0, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not find upload")
+	}
+	if len(entries) == 0 {
+		return 0, errors.New("no chunk uploaded")
+	}
+
+	chunks := make([]int, 0, len(entries))
+	for _, entry := range entries {
+		id, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		chunks = append(chunks, id)
+	}
+	sort.Ints(chunks)
+
+	filename, err := s.path(userID, resourceID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(filename), 0o700); err != nil {
+		return 0, errors.Wrap(err, "could not create user directory")
+	}
+
+	// Assemble in a temporary file so a download never reads a partial file.
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "."+resourceID+".*")
+	if err != nil {
+		return 0, errors.Wrap(err, "could not create file")
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	var size int64
+	for _, id := range chunks {
+		n, err := appendFile(tmp, filepath.Join(dir, strconv.Itoa(id)))
+		if err != nil {
+			return 0, err
+		}
+		size += n
+	}
+
+	if err = tmp.Sync(); err != nil {
+		return 0, errors.Wrap(err, "could not write file")
+	}
+
+	if err = os.Rename(tmp.Name(), filename); err != nil {
+		return 0, errors.Wrap(err, "could not write file")
+	}
+
+	return size, errors.Wrap(os.RemoveAll(dir), "could not remove upload")
+}
+
+// Open opens the given resource for reading.
+func (s *Local) Open(userID, resourceID string) (*os.File, error) {
+	filename, err := s.path(userID, resourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(filename)
+	return f, errors.Wrap(err, "could not open file")
+}
+
+// Remove removes the given resource.
+func (s *Local) Remove(userID, resourceID string) error {
+	filename, err := s.path(userID, resourceID)
+	if err != nil {
+		return err
+	}
+
+	return errors.Wrap(os.Remove(filename), "could not remove file")
+}
+
+// RemoveAll removes all the files and pending uploads of the given user.
+func (s *Local) RemoveAll(userID string) error {
+	for _, parts := range [][]string{{userID}, {uploads, userID}} {
+		dir, err := s.path(parts...)
+		if err != nil {
+			return err
+		}
+
+		if err = os.RemoveAll(dir); err != nil {
+			return errors.Wrap(err, "could not remove user files")
+		}
+	}
+
+	return nil
+}
+
+// Usage returns the number of bytes used by the given user, pending uploads included.
+func (s *Local) Usage(userID string) (int64, error) {
+	var usage int64
+	for _, parts := range [][]string{{userID}, {uploads, userID}} {
+		dir, err := s.path(parts...)
+		if err != nil {
+			return 0, err
+		}
+
+		n, err := du(dir)
+		if err != nil {
+			return 0, err
+		}
+		usage += n
+	}
+
+	return usage, nil
+}
+
+// CleanupUploads removes the pending uploads not modified since the given duration.
+// It returns the number of removed uploads.
+func (s *Local) CleanupUploads(olderThan time.Duration) (int, error) {
+	users, err := os.ReadDir(filepath.Join(s.root, uploads))
+	if err != nil {
+		return 0, errors.Wrap(err, "could not list uploads")
+	}
+
+	var n int
+	deadline := time.Now().Add(-olderThan)
+	for _, user := range users {
+		dir := filepath.Join(s.root, uploads, user.Name())
+
+		resources, err := os.ReadDir(dir)
+		if err != nil {
+			return n, errors.Wrap(err, "could not list uploads")
+		}
+
+		for _, resource := range resources {
+			info, err := resource.Info()
+			if err != nil || info.ModTime().After(deadline) {
+				continue
+			}
+
+			if err = os.RemoveAll(filepath.Join(dir, resource.Name())); err != nil {
+				return n, errors.Wrap(err, "could not remove upload")
+			}
+			n++
+		}
+
+		// Only removes the user directory if empty.
+		os.Remove(dir)
+	}
+
+	return n, nil
+}
+
+// path returns the path of the given UUID parts (the `.uploads` directory name is allowed).
+// Checking the identifiers prevents any path traversal.
+func (s *Local) path(parts ...string) (string, error) {
+	elems := []string{s.root}
+	for _, part := range parts {
+		if part != uploads {
+			if _, err := uuid.FromString(part); err != nil {
+				return "", ErrInvalidIdentifier
+			}
+		}
+		elems = append(elems, part)
+	}
+
+	return filepath.Join(elems...), nil
+}
+
+func appendFile(w io.Writer, filename string) (int64, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not open chunk")
+	}
+	defer f.Close()
+
+	n, err := io.Copy(w, f)
+	return n, errors.Wrap(err, "could not append chunk")
+}
+
+func du(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+
+	return size, errors.Wrap(err, "could not compute disk usage")
+}
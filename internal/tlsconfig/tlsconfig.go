@@ -0,0 +1,126 @@
+// Package tlsconfig provides TLS configurations reloading their certificates from disk when they change.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+type reloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+
+	mu          sync.Mutex
+	modTimes    map[string]time.Time
+	certificate *tls.Certificate
+	clientCAs   *x509.CertPool
+}
+
+// New returns a TLS configuration serving the given certificate.
+// When clientCAFile is defined, clients must present a certificate signed by one of its CAs (mTLS).
+// The files are checked on each handshake and reloaded when they are modified,
+// the previous certificates are kept if the new ones can't be loaded.
+func New(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	r := &reloader{
+		certFile:     certFile,
+		keyFile:      keyFile,
+		clientCAFile: clientCAFile,
+	}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			certificate, _ := r.current()
+			return certificate, nil
+		},
+	}
+
+	if clientCAFile != "" {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+		base := config.Clone()
+		config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			_, clientCAs := r.current()
+
+			c := base.Clone()
+			c.ClientCAs = clientCAs
+			return c, nil
+		}
+	}
+
+	return config, nil
+}
+
+// current returns the certificates, reloaded if the files have been modified.
+func (r *reloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.modified() {
+		if err := r.reload(); err != nil {
+			logrus.WithError(err).Error("could not reload TLS certificates")
+		}
+	}
+
+	return r.certificate, r.clientCAs
+}
+
+// modified returns true when one of the files has been modified since the last load.
+func (r *reloader) modified() bool {
+	for filename, modTime := range r.modTimes {
+		stat, err := os.Stat(filename)
+		if err == nil && !stat.ModTime().Equal(modTime) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *reloader) reload() error {
+	// Modification times are taken before reading the files, so a modification during the load is detected on the next handshake.
+	// They are also updated on failure to not retry on each handshake until the files are fixed.
+	r.modTimes = map[string]time.Time{}
+	for _, filename := range []string{r.certFile, r.keyFile, r.clientCAFile} {
+		if filename == "" {
+			continue
+		}
+
+		var modTime time.Time // Zero when the file is missing
+		if stat, err := os.Stat(filename); err == nil {
+			modTime = stat.ModTime()
+		}
+		r.modTimes[filename] = modTime
+	}
+
+	certificate, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return errors.Wrap(err, "could not load certificate")
+	}
+
+	var clientCAs *x509.CertPool
+	if r.clientCAFile != "" {
+		payload, err := os.ReadFile(r.clientCAFile)
+		if err != nil {
+			return errors.Wrap(err, "could not read client CA file")
+		}
+
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(payload) {
+			return errors.New("could not parse client CA file")
+		}
+	}
+
+	r.certificate = &certificate
+	r.clientCAs = clientCAs
+	return nil
+}
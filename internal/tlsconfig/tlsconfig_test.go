@@ -0,0 +1,91 @@
+package tlsconfig_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mdouchement/standardfile/internal/tlsconfig"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	_, err := tlsconfig.New(certFile, keyFile, "")
+	assert.Error(t, err)
+
+	writeCertificate(t, certFile, keyFile, "first")
+
+	config, err := tlsconfig.New(certFile, keyFile, "")
+	assert.NoError(t, err)
+	assert.Equal(t, tls.NoClientCert, config.ClientAuth)
+	assert.Equal(t, "first", commonName(t, config))
+
+	// Reloaded when modified.
+	writeCertificate(t, certFile, keyFile, "second")
+	assert.NoError(t, os.Chtimes(certFile, time.Now().Add(time.Minute), time.Now().Add(time.Minute)))
+	assert.Equal(t, "second", commonName(t, config))
+
+	// Previous certificate is kept when the new one is invalid.
+	assert.NoError(t, os.WriteFile(keyFile, []byte("invalid"), 0600))
+	assert.NoError(t, os.Chtimes(keyFile, time.Now().Add(2*time.Minute), time.Now().Add(2*time.Minute)))
+	assert.Equal(t, "second", commonName(t, config))
+
+	//
+	// mTLS
+	//
+
+	writeCertificate(t, certFile, keyFile, "third")
+	config, err = tlsconfig.New(certFile, keyFile, certFile)
+	assert.NoError(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, config.ClientAuth)
+
+	c, err := config.GetConfigForClient(&tls.ClientHelloInfo{})
+	assert.NoError(t, err)
+	assert.NotNil(t, c.ClientCAs)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, c.ClientAuth)
+}
+
+func commonName(t *testing.T, config *tls.Config) string {
+	certificate, err := config.GetCertificate(&tls.ClientHelloInfo{})
+	assert.NoError(t, err)
+
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+	assert.NoError(t, err)
+	return leaf.Subject.CommonName
+}
+
+func writeCertificate(t *testing.T, certFile, keyFile, name string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}), 0600))
+}
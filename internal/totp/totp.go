@@ -0,0 +1,108 @@
+// Package totp implements the Time-Based One-Time Password algorithm (RFC 6238)
+// with the parameters used by the authenticator applications (SHA1, 6 digits, 30 seconds period).
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	digits = 6
+	period = 30
+	// skew is the number of periods accepted before and after the current one to tolerate clock drift.
+	skew = 1
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a new random base32 encoded secret.
+func GenerateSecret() (string, error) {
+	secret := make([]byte, 20) // Size recommended by RFC 4226
+	if _, err := rand.Read(secret); err != nil {
+		return "", errors.Wrap(err, "could not generate secret")
+	}
+	return encoding.EncodeToString(secret), nil
+}
+
+// URI returns the otpauth URI of the secret used to generate a QR code.
+func URI(issuer, account, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+
+	return (&url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: query.Encode(),
+	}).String()
+}
+
+// Code returns the code of the given secret at t.
+func Code(secret string, t time.Time) (string, error) {
+	key, err := decode(secret)
+	if err != nil {
+		return "", err
+	}
+	return code(key, uint64(t.Unix()/period)), nil
+}
+
+// Validate returns true if the given code is valid at t.
+func Validate(secret, passcode string, t time.Time) bool {
+	key, err := decode(secret)
+	if err != nil {
+		return false
+	}
+
+	passcode = strings.TrimSpace(passcode)
+	if len(passcode) != digits {
+		return false
+	}
+
+	counter := t.Unix() / period
+	for i := -skew; i <= skew; i++ {
+		if subtle.ConstantTimeCompare([]byte(code(key, uint64(counter+int64(i)))), []byte(passcode)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func decode(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(secret), " ", ""))
+	key, err := encoding.DecodeString(strings.TrimRight(secret, "="))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid secret")
+	}
+	if len(key) == 0 {
+		return nil, errors.New("empty secret")
+	}
+	return key, nil
+}
+
+// code implements the HOTP algorithm (RFC 4226).
+func code(key []byte, counter uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", digits, value%1_000_000)
+}
@@ -0,0 +1,49 @@
+package totp_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mdouchement/standardfile/internal/totp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCode(t *testing.T) {
+	// RFC 6238 Appendix B test vectors truncated to 6 digits.
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" // 12345678901234567890
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+
+	for ts, expected := range vectors {
+		code, err := totp.Code(secret, time.Unix(ts, 0))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, code, ts)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := totp.GenerateSecret()
+	assert.NoError(t, err)
+	assert.Len(t, secret, 32)
+
+	now := time.Now()
+	code, err := totp.Code(secret, now)
+	assert.NoError(t, err)
+
+	assert.True(t, totp.Validate(secret, code, now))
+	assert.True(t, totp.Validate(secret, code, now.Add(30*time.Second)))
+	assert.False(t, totp.Validate(secret, code, now.Add(90*time.Second)))
+	assert.False(t, totp.Validate(secret, "", now))
+	assert.False(t, totp.Validate("invalid!", code, now))
+}
+
+func TestURI(t *testing.T) {
+	uri := totp.URI("StandardFile", "george.abitbol@nowhere.lan", "GEZDGNBV")
+	assert.Equal(t, "otpauth://totp/StandardFile:george.abitbol@nowhere.lan?issuer=StandardFile&secret=GEZDGNBV", uri)
+}